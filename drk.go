@@ -1,41 +1,129 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	neturl "net/url"
 	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
+	"github.com/codingconcepts/drk/pkg/control"
 	"github.com/codingconcepts/drk/pkg/model"
 	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/codingconcepts/drk/pkg/tui"
 	"github.com/codingconcepts/ring"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"gopkg.in/yaml.v3"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "ctl":
+			if err := ctl(os.Args[2:]); err != nil {
+				log.Fatalf("error: %v", err)
+			}
+			return
+
+		case "validate":
+			if err := validate(os.Args[2:]); err != nil {
+				log.Fatalf("error: %v", err)
+			}
+			return
+
+		case "schema":
+			if err := schema(os.Args[2:]); err != nil {
+				log.Fatalf("error: %v", err)
+			}
+			return
+		}
+	}
+
 	config := flag.String("config", "drk.yaml", "absolute or relative path to config file")
-	url := flag.String("url", "", "database connection string")
-	driver := flag.String("driver", "pgx", "database driver to use [pgx]")
+	var urls urlsFlag
+	flag.Var(&urls, "url", "database connection string, repeated to balance across multiple nodes")
+	driver := flag.String("driver", "pgx", "database driver to use [pgx, mysql]")
 	dryRun := flag.Bool("dry-run", false, "if specified, prints config and exits")
+	graph := flag.String("graph", "", "with --dry-run, prints the dependency graph of each workflow's activities [dot, mermaid]")
 	debug := flag.Bool("debug", false, "enable verbose logging")
 	duration := flag.Duration("duration", time.Minute*10, "total duration of simulation")
+	backend := flag.String("backend", "sql", "connection pool implementation to use [sql, pgxpool]")
+	loadBalancing := flag.String("load-balancing", "", "strategy for balancing across multiple urls [round_robin, random, locality] (overrides config)")
+	summaryOut := flag.String("summary-out", "", "path to write an end-of-run summary to, as JSON or CSV depending on its extension [.json, .csv]")
+	timeSeriesOut := flag.String("timeseries-out", "", "path to write per-interval metrics to as the run progresses, as CSV or JSON lines depending on its extension [.csv, .jsonl]")
+	timeSeriesInterval := flag.Duration("timeseries-interval", time.Second, "interval to bucket time series metrics by")
+	eventsOut := flag.String("events-out", "", "path to write each event to as a line of JSON")
+	metricsAddr := flag.String("metrics-addr", "", "address to serve Prometheus metrics on at /metrics (e.g. :9090)")
+	traceOTLP := flag.String("trace-otlp", "", "OTLP/HTTP endpoint to export traces of activities and statements to (e.g. http://localhost:4318)")
+	traceFile := flag.String("trace-file", "", "path to write traces of activities and statements to as JSON")
+	traceSampleRatio := flag.Float64("trace-sample-ratio", 1, "fraction of activity runs to trace")
+	serveCtl := flag.Bool("control", false, "serve the control API on a unix socket at "+strings.TrimPrefix(control.DefaultAddr, "unix:"))
+	controlAddr := flag.String("control-addr", "", "address to serve the control API on instead, as unix:/path/to/socket or a loopback host:port (e.g. localhost:7070)")
+	seed := flag.Uint64("seed", 0, "seed for generated arg values (random if not specified)")
+
+	var pool repo.PoolConfig
+	flag.IntVar(&pool.MaxConns, "max-conns", 0, "maximum number of open connections (overrides config)")
+	flag.IntVar(&pool.MinConns, "min-conns", 0, "minimum number of idle connections, pgxpool backend only (overrides config)")
+	flag.DurationVar(&pool.MaxConnLifetime, "max-conn-lifetime", 0, "maximum lifetime of a connection (overrides config)")
+	flag.DurationVar(&pool.MaxConnIdleTime, "max-conn-idle-time", 0, "maximum idle time of a connection (overrides config)")
+	flag.DurationVar(&pool.HealthCheckPeriod, "health-check-period", 0, "interval between connection health checks (overrides config)")
 	flag.Parse()
 
-	if *url == "" || *driver == "" || *config == "" {
+	if *driver == "" || *config == "" {
 		flag.Usage()
 		os.Exit(2)
 	}
 
+	if *summaryOut != "" {
+		if _, err := summaryFormat(*summaryOut); err != nil {
+			log.Fatalf("invalid summary output: %v", err)
+		}
+	}
+
+	if *timeSeriesOut != "" {
+		if _, err := timeSeriesFormat(*timeSeriesOut); err != nil {
+			log.Fatalf("invalid time series output: %v", err)
+		}
+	}
+
+	switch *graph {
+	case "", "dot", "mermaid":
+	default:
+		log.Fatalf("invalid graph format: %q", *graph)
+	}
+	if *graph != "" && !*dryRun {
+		log.Fatalf("--graph requires --dry-run")
+	}
+
+	if *seed == 0 {
+		*seed = rand.Uint64()
+	}
+	model.Seed(*seed)
+
 	logger := zerolog.New(zerolog.ConsoleWriter{
 		Out: os.Stdout,
 		PartsExclude: []string{
@@ -43,108 +131,907 @@ func main() {
 		},
 	}).Level(lo.Ternary(*debug, zerolog.DebugLevel, zerolog.WarnLevel))
 
-	cfg, err := loadConfig(*config)
+	cfg, err := loadConfig(*config, *driver)
 	if err != nil {
 		log.Fatalf("error loading config: %v", err)
 	}
 
+	configHash, err := hashFile(*config)
+	if err != nil {
+		log.Fatalf("error hashing config: %v", err)
+	}
+
+	graphs := cfg.Graph()
+	blocked := warnBlocked(graphs, &logger)
+
 	printConfig(cfg, &logger)
 
 	if *dryRun {
+		if err = printGraph(*graph, graphs); err != nil {
+			log.Fatalf("error printing dependency graph: %v", err)
+		}
+		if blocked {
+			os.Exit(1)
+		}
 		return
 	}
 
-	db, err := sql.Open(*driver, *url)
+	nodes := parseURLs(urls, cfg.URLs)
+	if len(nodes) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	queryer, err := newClusterQueryer(
+		*backend,
+		*driver,
+		nodes,
+		lo.Ternary(*loadBalancing != "", *loadBalancing, cfg.LoadBalancing),
+		mergePoolConfig(cfg.Pool, pool),
+		&logger,
+	)
 	if err != nil {
 		log.Fatalf("connecting to database: %v", err)
 	}
-	queryer := repo.NewDBRepo(db)
+	queryers := []repo.Queryer{queryer}
 
-	runner, err := model.NewRunner(cfg, queryer, *url, *driver, *duration, &logger)
+	runner, err := model.NewRunner(cfg, queryer, urls.String(), *driver, *duration, &logger)
 	if err != nil {
 		log.Fatalf("error creating runner: %v", err)
 	}
 
-	if !*debug {
-		go monitor(runner)
+	for name, conn := range cfg.Connections {
+		connQueryer, err := newClusterQueryer(
+			*backend,
+			lo.Ternary(conn.Driver != "", conn.Driver, *driver),
+			conn.Nodes(),
+			conn.LoadBalancing,
+			mergePoolConfig(conn.Pool, pool),
+			&logger,
+		)
+		if err != nil {
+			log.Fatalf("connecting to database for connection %q: %v", name, err)
+		}
+		queryers = append(queryers, connQueryer)
+
+		runner.AddConnection(name, connQueryer)
+	}
+
+	flushTraces := func() {}
+	if *traceOTLP != "" || *traceFile != "" {
+		tp, err := newTracerProvider(*traceOTLP, *traceFile, *traceSampleRatio)
+		if err != nil {
+			log.Fatalf("error configuring tracing: %v", err)
+		}
+
+		flushTraces = func() {
+			if err := tp.Shutdown(context.Background()); err != nil {
+				log.Printf("error flushing traces: %v", err)
+			}
+		}
+
+		runner.SetTracerProvider(tp)
 	}
 
-	if err = runner.Run(); err != nil {
+	if *eventsOut != "" {
+		file, err := os.Create(*eventsOut)
+		if err != nil {
+			log.Fatalf("error creating events output: %v", err)
+		}
+		defer file.Close()
+
+		addSink(runner, "events", model.NewJSONSink(file), model.SinkOptions{Buffer: 10000})
+	}
+
+	if *metricsAddr != "" {
+		if err = serveMetrics(*metricsAddr, model.NewMetrics(runner)); err != nil {
+			log.Fatalf("error serving metrics: %v", err)
+		}
+	}
+
+	if *serveCtl || *controlAddr != "" {
+		addr := *controlAddr
+		if addr == "" {
+			addr = control.DefaultAddr
+		}
+
+		server, err := serveControl(addr, runner)
+		if err != nil {
+			log.Fatalf("error serving control api: %v", err)
+		}
+
+		// Stop changes being made to the run once it's finished, waiting
+		// for those in flight to be published.
+		runner.OnStop(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := server.Shutdown(ctx); err != nil {
+				log.Printf("error stopping control api: %v", err)
+			}
+		})
+	}
+
+	start := time.Now()
+
+	// The terminal is only put into raw mode once everything that can
+	// fail has been set up, so that it's always restored.
+	closeTerminal := func() {}
+	quitting := make(chan struct{})
+	var quitOnce sync.Once
+	switch {
+	case *debug:
+		// Debug logs are written to the terminal in place of a monitor.
+
+	case tui.IsTerminal():
+		terminal, err := tui.OpenTerminal()
+		if err != nil {
+			log.Fatalf("error opening terminal: %v", err)
+		}
+
+		closeTerminal = func() {
+			if err := terminal.Close(); err != nil {
+				log.Printf("error closing terminal: %v", err)
+			}
+		}
+
+		quit := func() {
+			quitOnce.Do(func() { close(quitting) })
+		}
+
+		addSink(runner, "monitor", tui.New(runner, terminal, terminal.Keys(), quit, start), model.SinkOptions{})
+
+	default:
+		addSink(runner, "monitor", model.SinkFunc(func(events <-chan model.Event) error {
+			monitor(runner, events)
+			return nil
+		}), model.SinkOptions{})
+	}
+
+	watchDone := make(chan struct{})
+	aborted := runner.WatchThresholds(cfg.Thresholds, time.Second, watchDone)
+
+	finished := make(chan error, 1)
+	go func() {
+		finished <- runner.Run()
+	}()
+
+	// The time series harvests the runner's results, so it's written
+	// until the run finishes rather than consuming events.
+	timeSeriesDone := make(chan struct{})
+	timeSeriesErr := make(chan error, 1)
+	if *timeSeriesOut != "" {
+		go func() {
+			timeSeriesErr <- writeTimeSeries(*timeSeriesOut, runner, start, *timeSeriesInterval, timeSeriesDone)
+		}()
+	} else {
+		timeSeriesErr <- nil
+	}
+
+	// Runs stopped early, from the terminal or by a failed threshold,
+	// still wait for their VUs and sinks to finish, so that nothing is
+	// running against the connections once they're closed.
+	var results []model.ThresholdResult
+	select {
+	case err = <-finished:
+
+	case results = <-aborted:
+		log.Printf("aborting run: threshold failed")
+		runner.Stop()
+		err = <-finished
+
+	case <-quitting:
+		runner.Stop()
+		err = <-finished
+	}
+	close(watchDone)
+
+	end := time.Now()
+	closeTerminal()
+
+	if err != nil {
+		closeQueryers(queryers)
 		log.Fatalf("error running config: %v", err)
 	}
+
+	if results == nil {
+		stats, elapsed := runner.Results(end)
+		results = model.EvaluateThresholds(cfg.Thresholds, stats, elapsed)
+	}
+
+	flushTraces()
+
+	close(timeSeriesDone)
+	if err = <-timeSeriesErr; err != nil {
+		log.Printf("error writing time series: %v", err)
+	}
+
+	for name, n := range runner.DroppedEvents() {
+		if n > 0 {
+			log.Printf("sink %q dropped %d events", name, n)
+		}
+	}
+
+	printThresholds(results)
+
+	if *summaryOut != "" {
+		stats, _ := runner.Results(end)
+
+		summary := model.NewSummary(model.RunInfo{
+			ConfigHash: configHash,
+			Seed:       *seed,
+			Driver:     *driver,
+			Duration:   duration.String(),
+			Start:      start,
+			End:        end,
+		}, stats, results)
+
+		if err = writeSummary(*summaryOut, summary); err != nil {
+			log.Fatalf("error writing summary: %v", err)
+		}
+	}
+
+	closeQueryers(queryers)
+
+	select {
+	case <-quitting:
+		log.Printf("run stopped early")
+		os.Exit(130)
+	default:
+	}
+
+	if !lo.EveryBy(results, func(r model.ThresholdResult) bool { return r.Pass }) {
+		os.Exit(1)
+	}
+}
+
+// closeQueryers closes the connection pools behind each Queryer.
+func closeQueryers(queryers []repo.Queryer) {
+	for _, q := range queryers {
+		closer, ok := q.(io.Closer)
+		if !ok {
+			continue
+		}
+
+		if err := closer.Close(); err != nil {
+			log.Printf("error closing database: %v", err)
+		}
+	}
+}
+
+// summaryFormat returns the format to write a summary in, based on the
+// extension of the file it's written to.
+func summaryFormat(path string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json", ".csv":
+		return ext[1:], nil
+	default:
+		return "", fmt.Errorf("unsupported summary format: %q", ext)
+	}
 }
 
-func monitor(r *model.Runner) {
-	events := r.GetEventStream()
+func writeSummary(path string, summary model.Summary) error {
+	format, err := summaryFormat(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating file: %w", err)
+	}
+	defer file.Close()
+
+	switch format {
+	case "json":
+		err = summary.WriteJSON(file)
+	default:
+		err = summary.WriteCSV(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// hashFile returns the hex-encoded SHA-256 hash of a file's contents.
+func hashFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading file: %w", err)
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// newTracerProvider returns a tracer provider that exports spans to an
+// OTLP/HTTP endpoint, a JSON file, or both.
+func newTracerProvider(otlpEndpoint, path string, sampleRatio float64) (*sdktrace.TracerProvider, error) {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "drk"))),
+	}
+
+	if otlpEndpoint != "" {
+		exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(otlpEndpoint))
+		if err != nil {
+			return nil, fmt.Errorf("creating otlp exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("creating file: %w", err)
+		}
+
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			return nil, fmt.Errorf("creating file exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	return sdktrace.NewTracerProvider(opts...), nil
+}
+
+func addSink(runner *model.Runner, name string, sink model.Sink, opts model.SinkOptions) {
+	if err := runner.AddSink(name, sink, opts); err != nil {
+		log.Fatalf("error adding sink: %v", err)
+	}
+}
+
+// serveMetrics listens on the given address and serves metrics from it in
+// the background.
+func serveMetrics(addr string, metrics *model.Metrics) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening on %q: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Printf("error serving metrics: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// serveControl listens on the given address and serves the control API
+// from it in the background, until the returned server is shut down.
+func serveControl(addr string, runner *model.Runner) (*http.Server, error) {
+	listener, err := control.Listen(addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %q: %w", addr, err)
+	}
+
+	server := &http.Server{Handler: control.Handler(runner)}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("error serving control api: %v", err)
+		}
+	}()
+
+	return server, nil
+}
+
+// ctl drives the control API of a running drk.
+func ctl(args []string) error {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	addr := fs.String("addr", control.DefaultAddr, "address of the control API, as unix:/path/to/socket or host:port")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: drk ctl [flags] <command>\n\n")
+		fmt.Fprintln(fs.Output(), "Commands:")
+		fmt.Fprintln(fs.Output(), "  workflows                              list running workflows")
+		fmt.Fprintln(fs.Output(), "  vus <workflow> <n>                     set the number of VUs running a workflow")
+		fmt.Fprintln(fs.Output(), "  rate <workflow> <query> <multiplier>   scale the rate a workflow's query runs at")
+		fmt.Fprintln(fs.Output(), "  pause <workflow>                       pause a workflow")
+		fmt.Fprintln(fs.Output(), "  resume <workflow>                      resume a paused workflow")
+		fmt.Fprintln(fs.Output(), "  ddl [statement]                        run a schema change, or show schema changes")
+		fmt.Fprintf(fs.Output(), "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	client := control.NewClient(*addr)
+
+	switch cmd, rest := fs.Arg(0), fs.Args()[min(1, fs.NArg()):]; {
+	case cmd == "workflows" && len(rest) == 0:
+		workflows, err := client.Workflows()
+		if err != nil {
+			return err
+		}
+		printWorkflows(workflows)
+		return nil
+
+	case cmd == "vus" && len(rest) == 2:
+		n, err := strconv.Atoi(rest[1])
+		if err != nil {
+			return fmt.Errorf("parsing vus: %w", err)
+		}
+		return client.SetVUs(rest[0], n)
+
+	case cmd == "rate" && len(rest) == 3:
+		m, err := strconv.ParseFloat(rest[2], 64)
+		if err != nil {
+			return fmt.Errorf("parsing multiplier: %w", err)
+		}
+		return client.ScaleRate(rest[0], rest[1], m)
+
+	case cmd == "pause" && len(rest) == 1:
+		return client.PauseWorkflow(rest[0])
+
+	case cmd == "resume" && len(rest) == 1:
+		return client.ResumeWorkflow(rest[0])
+
+	case cmd == "ddl" && len(rest) == 1:
+		return client.RunDDL(rest[0])
+
+	case cmd == "ddl" && len(rest) == 0:
+		status, err := client.DDL()
+		if err != nil {
+			return err
+		}
+		printDDL(status)
+		return nil
+
+	default:
+		fs.Usage()
+		os.Exit(2)
+		return nil
+	}
+}
+
+func printWorkflows(workflows []model.WorkflowStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "Workflow\tVUs\tActive VUs\tPaused\tQuery\tRate\tMultiplier")
+	fmt.Fprintln(w, "--------\t---\t----------\t------\t-----\t----\t----------")
+
+	for _, wf := range workflows {
+		if len(wf.Queries) == 0 {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%t\t-\t-\t-\n", wf.Name, wf.VUs, wf.ActiveVUs, wf.Paused)
+		}
+
+		for i, q := range wf.Queries {
+			if i == 0 {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%t\t", wf.Name, wf.VUs, wf.ActiveVUs, wf.Paused)
+			} else {
+				fmt.Fprint(w, "\t\t\t\t")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%v\n", q.Name, q.Rate, q.Multiplier)
+		}
+	}
+}
+
+func printDDL(status control.DDLStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "Schema change\tStarted\tStatus")
+	fmt.Fprintln(w, "-------------\t-------\t------")
+
+	for _, d := range status.Running {
+		fmt.Fprintf(w, "%s.%s\t%s\trunning\n", d.Workflow, d.Name, d.Start.Format(time.TimeOnly))
+	}
+
+	if d := status.Last; d != nil {
+		result := fmt.Sprintf("completed in %vms", d.DurationMs)
+		if d.Error != "" {
+			result = "failed: " + d.Error
+		}
+		fmt.Fprintf(w, "%s.%s\t%s\t%s\n", d.Workflow, d.Name, d.Start.Format(time.TimeOnly), result)
+	}
+}
+
+func validate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	config := fs.String("config", "drk.yaml", "absolute or relative path to config file")
+	driver := fs.String("driver", "pgx", "database driver the config will be run with [pgx, mysql]")
+	url := fs.String("url", "", "optional database connection string, used to check the columns referenced from each query's results")
+	fs.Parse(args)
+
+	data, err := os.ReadFile(*config)
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+
+	var doc yaml.Node
+	if err = yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing config: %w", err)
+	}
+
+	opts := model.ValidateOptions{Driver: *driver}
+
+	if *url != "" {
+		if *driver != "pgx" {
+			return fmt.Errorf("checking columns against a database is only supported by the pgx driver")
+		}
+
+		logger := zerolog.Nop()
+		queryer, err := newQueryer("sql", *driver, *url, repo.PoolConfig{}, &logger)
+		if err != nil {
+			return fmt.Errorf("connecting to database: %w", err)
+		}
+		defer closeQueryers([]repo.Queryer{queryer})
+
+		describer, ok := queryer.(repo.Describer)
+		if !ok {
+			return fmt.Errorf("describing queries isn't supported by driver %q", *driver)
+		}
+		opts.Describe = describer.Columns
+	}
+
+	problems := model.Validate(&doc, opts)
+	if len(problems) == 0 {
+		fmt.Printf("%s is valid\n", *config)
+		return nil
+	}
+
+	for _, p := range problems {
+		fmt.Printf("%s:%s\n", *config, p)
+	}
+	fmt.Printf("\n%d problem(s) found\n", len(problems))
+	os.Exit(1)
+
+	return nil
+}
+
+// schema prints the JSON Schema for config files, for editors to
+// validate and complete them with.
+func schema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	out := fs.String("out", "", "optional path to write the schema to, instead of stdout")
+	fs.Parse(args)
+
+	if *out == "" {
+		return model.WriteSchema(os.Stdout)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("creating schema file: %w", err)
+	}
+	defer f.Close()
+
+	if err = model.WriteSchema(f); err != nil {
+		return fmt.Errorf("writing schema: %w", err)
+	}
+
+	return f.Close()
+}
+
+// timeSeriesFormat returns the format to write time series metrics in,
+// based on the extension of the file they're written to.
+func timeSeriesFormat(path string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".csv", ".jsonl":
+		return ext[1:], nil
+	default:
+		return "", fmt.Errorf("unsupported time series format: %q", ext)
+	}
+}
+
+func writeTimeSeries(path string, runner *model.Runner, start time.Time, interval time.Duration, done <-chan struct{}) error {
+	format, err := timeSeriesFormat(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating file: %w", err)
+	}
+	defer file.Close()
+
+	writer, err := model.NewBucketWriter(file, format)
+	if err != nil {
+		return err
+	}
+
+	ticks := time.NewTicker(interval)
+	defer ticks.Stop()
+
+	ts := model.NewTimeSeries(writer, runner.Harvest, runner.ActiveVUs)
+	if err = ts.Run(start, ticks.C, done); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func printThresholds(results []model.ThresholdResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "\n\n")
+	fmt.Fprintln(w, "Thresholds")
+	fmt.Fprintf(w, "==========\n\n")
+
+	fmt.Fprintln(w, "Threshold\tQuery\tActual\tResult")
+	fmt.Fprintln(w, "---------\t-----\t------\t------")
+
+	for _, r := range results {
+		query := lo.Ternary(r.Workflow != "", r.Workflow+"."+r.Name, "-")
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Threshold, query, r.Actual, lo.Ternary(r.Pass, "pass", "FAIL"))
+	}
+}
+
+// urlsFlag collects the connection strings of a repeated --url flag.
+// They aren't split on commas, as multi-host PostgreSQL URLs contain
+// them, e.g. postgres://h1,h2/db.
+type urlsFlag []string
+
+func (f *urlsFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *urlsFlag) Set(value string) error {
+	*f = append(*f, strings.TrimSpace(value))
+	return nil
+}
+
+// parseURLs returns the nodes to connect to, taking those provided as
+// flags in preference to those in the config file.
+func parseURLs(flagURLs []string, cfgURLs []model.NodeURL) []model.NodeURL {
+	if len(flagURLs) == 0 {
+		return cfgURLs
+	}
+
+	return lo.Map(flagURLs, func(u string, _ int) model.NodeURL {
+		return model.NodeURL{URL: u}
+	})
+}
+
+func newClusterQueryer(backend, driver string, nodes []model.NodeURL, strategy string, pool repo.PoolConfig, logger *zerolog.Logger) (repo.Queryer, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no urls provided")
+	}
+
+	// Even a single node is run as a cluster, so that the statements run
+	// against it are attributed to it by name.
+	var clusterNodes []repo.Node
+	for _, n := range nodes {
+		queryer, err := newQueryer(backend, driver, n.URL, pool, logger)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to %q: %w", nodeName(n), err)
+		}
+
+		clusterNodes = append(clusterNodes, repo.Node{
+			Name:     nodeName(n),
+			Locality: n.Locality,
+			Queryer:  queryer,
+		})
+	}
+
+	return repo.NewCluster(lo.Ternary(strategy != "", strategy, repo.BalanceRoundRobin), clusterNodes...)
+}
+
+// nodeName returns the name of a node if it has one, falling back to the
+// host of its URL, or the URL itself if it can't be parsed.
+func nodeName(n model.NodeURL) string {
+	if n.Name != "" {
+		return n.Name
+	}
+
+	if u, err := neturl.Parse(n.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+
+	return n.URL
+}
+
+func newQueryer(backend, driver, url string, pool repo.PoolConfig, logger *zerolog.Logger) (repo.Queryer, error) {
+	switch backend {
+	case "sql":
+		db, err := sql.Open(driver, url)
+		if err != nil {
+			return nil, fmt.Errorf("opening database: %w", err)
+		}
+
+		r, err := repo.NewDBRepo(db, pool, logger)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return r, nil
+
+	case "pgxpool":
+		if driver != "pgx" {
+			return nil, fmt.Errorf("pgxpool backend requires the pgx driver (got: %q)", driver)
+		}
+		return repo.NewPgxRepo(url, pool)
+
+	default:
+		return nil, fmt.Errorf("unsupported backend: %q", backend)
+	}
+}
+
+// mergePoolConfig returns the pool settings from the config file, with
+// any settings provided as flags taking precedence.
+func mergePoolConfig(cfg, flags repo.PoolConfig) repo.PoolConfig {
+	return repo.PoolConfig{
+		MaxConns:          lo.Ternary(flags.MaxConns > 0, flags.MaxConns, cfg.MaxConns),
+		MinConns:          lo.Ternary(flags.MinConns > 0, flags.MinConns, cfg.MinConns),
+		MaxConnLifetime:   lo.Ternary(flags.MaxConnLifetime > 0, flags.MaxConnLifetime, cfg.MaxConnLifetime),
+		MaxConnIdleTime:   lo.Ternary(flags.MaxConnIdleTime > 0, flags.MaxConnIdleTime, cfg.MaxConnIdleTime),
+		HealthCheckPeriod: lo.Ternary(flags.HealthCheckPeriod > 0, flags.HealthCheckPeriod, cfg.HealthCheckPeriod),
+	}
+}
+
+// monitor prints the results of each query, harvested from the runner,
+// along with the requests served by each connection and node, which are
+// taken from its events.
+func monitor(runner *model.Runner, events <-chan model.Event) {
 	printTicks := time.Tick(time.Second)
 
-	eventCounts := map[string]int{}
-	eventLatencies := map[string]*ring.Ring[time.Duration]{}
+	nodeCounts := map[string]int{}
+	connectionCounts := map[string]int{}
+	connectionLatencies := map[string]*ring.Ring[time.Duration]{}
 
 	for {
 		select {
-		case event := <-events:
-			key := fmt.Sprintf("%s.%s", event.Workflow, event.Name)
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if event.Err != nil {
+				var assertionErr model.AssertionErr
+				if !errors.As(event.Err, &assertionErr) {
+					continue
+				}
+			}
 
-			// Add to event count.
-			eventCounts[key]++
+			// Add to node count.
+			if event.Node != "" {
+				nodeCounts[event.Node]++
+			}
+
+			// Add to connection count and latencies.
+			if event.Connection != "" {
+				connectionCounts[event.Connection]++
 
-			// Add to event latencies.
-			if _, ok := eventLatencies[key]; !ok {
-				eventLatencies[key] = ring.New[time.Duration](1000)
+				if _, ok := connectionLatencies[event.Connection]; !ok {
+					connectionLatencies[event.Connection] = ring.New[time.Duration](1000)
+				}
+				connectionLatencies[event.Connection].Add(event.Duration)
 			}
-			eventLatencies[key].Add(event.Duration)
 
 		case <-printTicks:
+			stats := runner.Harvest()
+
 			fmt.Print("\033[H\033[2J")
 
 			w := tabwriter.NewWriter(os.Stdout, 1, 1, 3, ' ', 0)
 
 			fmt.Fprintln(w, "Setup queries")
 			fmt.Fprintf(w, "=============\n\n")
-			writeEvent(w, eventCounts, eventLatencies, func(s string, _ int) bool {
-				return strings.HasPrefix(s, "*")
-			})
+			writeQueries(w, lo.Filter(stats, func(qs model.QueryStats, _ int) bool {
+				return strings.HasPrefix(qs.Workflow, "*")
+			}))
 
 			fmt.Fprintf(w, "\n\n")
 
 			fmt.Fprintln(w, "Queries")
 			fmt.Fprintf(w, "=======\n\n")
-			writeEvent(w, eventCounts, eventLatencies, func(s string, _ int) bool {
-				return !strings.HasPrefix(s, "*")
+			writeQueries(w, lo.Filter(stats, func(qs model.QueryStats, _ int) bool {
+				return !strings.HasPrefix(qs.Workflow, "*") && !qs.Stale
+			}))
+
+			stale := lo.Filter(stats, func(qs model.QueryStats, _ int) bool {
+				return !strings.HasPrefix(qs.Workflow, "*") && qs.Stale
 			})
+			if len(stale) > 0 {
+				fmt.Fprintf(w, "\n\n")
+
+				fmt.Fprintln(w, "Historical queries (AS OF SYSTEM TIME)")
+				fmt.Fprintf(w, "======================================\n\n")
+				writeQueries(w, stale)
+			}
+
+			if len(connectionCounts) > 0 {
+				fmt.Fprintf(w, "\n\n")
+
+				fmt.Fprintln(w, "Connections")
+				fmt.Fprintf(w, "===========\n\n")
+				writeConnections(w, connectionCounts, connectionLatencies)
+			}
+
+			if len(nodeCounts) > 0 {
+				fmt.Fprintf(w, "\n\n")
+
+				fmt.Fprintln(w, "Nodes")
+				fmt.Fprintf(w, "=====\n\n")
+				writeNodes(w, nodeCounts)
+			}
 
 			w.Flush()
 		}
 	}
 }
 
-type filter func(string, int) bool
+func writeQueries(w io.Writer, stats []model.QueryStats) {
+	fmt.Fprintln(w, "Query\tRequests\tErrors\tFailed Assertions\tSkipped (Dependencies)\tAverage Latency\tAverage Pool Wait")
+	fmt.Fprintln(w, "-----\t--------\t------\t-----------------\t----------------------\t---------------\t-----------------")
 
-func writeEvent(w io.Writer, counts map[string]int, latencies map[string]*ring.Ring[time.Duration], f filter) {
+	for _, qs := range stats {
+		fmt.Fprintf(
+			w,
+			"%s.%s\t%d\t%d\t%d\t%d\t%s\t%s\n",
+			strings.TrimPrefix(qs.Workflow, "*"),
+			qs.Name,
+			qs.Count,
+			qs.Errors,
+			qs.AssertionFailures,
+			qs.Skipped,
+			qs.Mean(),
+			qs.Wait.Mean(),
+		)
+	}
+}
+
+func writeConnections(w io.Writer, counts map[string]int, latencies map[string]*ring.Ring[time.Duration]) {
 	keys := lo.Keys(counts)
 	sort.Strings(keys)
 
-	fmt.Fprintln(w, "Query\tRequests\tAverage Latency")
-	fmt.Fprintln(w, "-----\t--------\t---------------")
+	fmt.Fprintln(w, "Connection\tRequests\tAverage Latency")
+	fmt.Fprintln(w, "----------\t--------\t---------------")
 
-	for _, key := range lo.Filter(keys, f) {
+	for _, key := range keys {
 		latencies := latencies[key].Slice()
 
 		fmt.Fprintf(
 			w,
 			"%s\t%d\t%s\n",
-			strings.TrimPrefix(key, "*"),
+			key,
 			counts[key],
 			lo.Sum(latencies)/time.Duration(len(latencies)),
 		)
 	}
 }
 
+func writeNodes(w io.Writer, counts map[string]int) {
+	keys := lo.Keys(counts)
+	sort.Strings(keys)
+
+	fmt.Fprintln(w, "Node\tRequests")
+	fmt.Fprintln(w, "----\t--------")
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s\t%d\n", key, counts[key])
+	}
+}
+
 func printConfig(cfg *model.Drk, logger *zerolog.Logger) {
 	for name, workflow := range cfg.Workflows {
 		logger.Info().Msgf("workflow: %s...", name)
 		logger.Info().Msgf("\tvus: %d", workflow.Vus)
+		if workflow.Connection != "" {
+			logger.Info().Msgf("\tconnection: %s", workflow.Connection)
+		}
+		if workflow.Session != "" {
+			logger.Info().Msgf("\tsession: %s", workflow.Session)
+		}
+
+		logger.Info().Msgf("\tvars:")
+		for name := range workflow.Vars {
+			logger.Info().Msgf("\t\t- %s", name)
+		}
 
 		logger.Info().Msgf("\tsetup queries:")
 		for _, query := range workflow.SetupQueries {
@@ -153,12 +1040,44 @@ func printConfig(cfg *model.Drk, logger *zerolog.Logger) {
 
 		logger.Info().Msgf("\tworkflow queries:")
 		for _, query := range workflow.Queries {
+			if asOf := cfg.Activities[query.Name].AsOf; asOf != "" {
+				logger.Info().Msgf("\t\t- %s (%s) as of %s", query.Name, query.Rate, asOf)
+				continue
+			}
 			logger.Info().Msgf("\t\t- %s (%s)", query.Name, query.Rate)
 		}
 	}
 }
 
-func loadConfig(path string) (*model.Drk, error) {
+// warnBlocked logs each activity whose dependencies can never be met,
+// returning true if there are any.
+func warnBlocked(graphs []model.WorkflowGraph, logger *zerolog.Logger) bool {
+	var blocked bool
+	for _, g := range graphs {
+		activities := lo.Keys(g.Blocked)
+		sort.Strings(activities)
+
+		for _, act := range activities {
+			logger.Warn().Str("workflow", g.Workflow).Str("activity", act).Msgf("activity will never run: %s", g.Blocked[act])
+			blocked = true
+		}
+	}
+
+	return blocked
+}
+
+func printGraph(format string, graphs []model.WorkflowGraph) error {
+	switch format {
+	case "dot":
+		return model.WriteDOT(os.Stdout, graphs)
+	case "mermaid":
+		return model.WriteMermaid(os.Stdout, graphs)
+	default:
+		return nil
+	}
+}
+
+func loadConfig(path, driver string) (*model.Drk, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("opening file: %w", err)
@@ -167,8 +1086,23 @@ func loadConfig(path string) (*model.Drk, error) {
 
 	var cfg model.Drk
 	if err = yaml.NewDecoder(file).Decode(&cfg); err != nil {
+		var errs model.ConfigErrs
+		if errors.As(err, &errs) {
+			return nil, fmt.Errorf("parsing file:\n%w", errs.InFile(path))
+		}
 		return nil, fmt.Errorf("parsing file: %w", err)
 	}
 
+	drivers := []string{driver}
+	for _, conn := range cfg.Connections {
+		if conn.Driver != "" {
+			drivers = append(drivers, conn.Driver)
+		}
+	}
+
+	if err = cfg.Prepare(lo.Uniq(drivers)...); err != nil {
+		return nil, fmt.Errorf("preparing config: %w", err)
+	}
+
 	return &cfg, nil
 }
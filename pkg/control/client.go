@@ -0,0 +1,132 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/model"
+)
+
+// Client calls the control API of a running drk.
+type Client struct {
+	base string
+	http *http.Client
+}
+
+// NewClient returns a client for the control API served on a TCP address
+// or, if prefixed with "unix:", a unix socket.
+func NewClient(addr string) *Client {
+	c := Client{
+		base: "http://" + addr,
+		http: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		c.base = "http://drk"
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	}
+
+	return &c
+}
+
+// Workflows returns the status of each running workflow.
+func (c *Client) Workflows() ([]model.WorkflowStatus, error) {
+	var out []model.WorkflowStatus
+	if err := c.do(http.MethodGet, "/workflows", nil, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// SetVUs sets the number of VUs running a workflow.
+func (c *Client) SetVUs(workflow string, n int) error {
+	return c.do(http.MethodPut, "/workflows/"+url.PathEscape(workflow)+"/vus", VUsRequest{VUs: n}, nil)
+}
+
+// ScaleRate sets the multiplier applied to the rate of a workflow's
+// query.
+func (c *Client) ScaleRate(workflow, query string, m float64) error {
+	path := "/workflows/" + url.PathEscape(workflow) + "/queries/" + url.PathEscape(query) + "/rate"
+	return c.do(http.MethodPut, path, RateRequest{Multiplier: m}, nil)
+}
+
+// PauseWorkflow stops a workflow's VUs from running activities.
+func (c *Client) PauseWorkflow(workflow string) error {
+	return c.do(http.MethodPost, "/workflows/"+url.PathEscape(workflow)+"/pause", nil, nil)
+}
+
+// ResumeWorkflow lets a paused workflow's VUs run activities again.
+func (c *Client) ResumeWorkflow(workflow string) error {
+	return c.do(http.MethodPost, "/workflows/"+url.PathEscape(workflow)+"/resume", nil, nil)
+}
+
+// RunDDL starts a schema change.
+func (c *Client) RunDDL(stmt string) error {
+	return c.do(http.MethodPost, "/ddl", DDLRequest{Statement: stmt}, nil)
+}
+
+// DDL returns the schema changes that are running and the last one to
+// finish.
+func (c *Client) DDL() (DDLStatus, error) {
+	var out DDLStatus
+	if err := c.do(http.MethodGet, "/ddl", nil, &out); err != nil {
+		return DDLStatus{}, err
+	}
+
+	return out, nil
+}
+
+func (c *Client) do(method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.base+path, r)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("calling control api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var e errorResponse
+		if err = json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			return fmt.Errorf("control api returned %s", resp.Status)
+		}
+		return fmt.Errorf("control api: %s", e.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+
+	return nil
+}
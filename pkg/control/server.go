@@ -0,0 +1,217 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/model"
+)
+
+const unixPrefix = "unix:"
+
+// DefaultAddr is the unix socket the control API is served on and
+// reached at if no other address is given.
+var DefaultAddr = unixPrefix + filepath.Join(os.TempDir(), "drk.sock")
+
+// Run is the part of a run the control API changes, implemented by
+// model.Runner.
+type Run interface {
+	Workflows() []model.WorkflowStatus
+	SetVUs(workflow string, n int) error
+	ScaleRate(workflow, query string, m float64) error
+	PauseWorkflow(workflow string) error
+	ResumeWorkflow(workflow string) error
+	RunDDL(stmt string) error
+	DDL() ([]model.DDL, *model.DDL)
+}
+
+// VUsRequest sets the number of VUs running a workflow.
+type VUsRequest struct {
+	VUs int `json:"vus"`
+}
+
+// RateRequest sets the multiplier applied to a query's rate.
+type RateRequest struct {
+	Multiplier float64 `json:"multiplier"`
+}
+
+// DDLRequest starts a schema change.
+type DDLRequest struct {
+	Statement string `json:"statement"`
+}
+
+// DDLStatus lists the schema changes that are running and the last one
+// to finish.
+type DDLStatus struct {
+	Running []DDL `json:"running"`
+	Last    *DDL  `json:"last,omitempty"`
+}
+
+// DDL describes a schema change.
+type DDL struct {
+	Workflow   string    `json:"workflow"`
+	Name       string    `json:"name"`
+	Start      time.Time `json:"start"`
+	DurationMs float64   `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler returns an HTTP handler that serves the control API for a run.
+func Handler(run Run) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /workflows", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, run.Workflows())
+	})
+
+	mux.HandleFunc("PUT /workflows/{workflow}/vus", func(w http.ResponseWriter, r *http.Request) {
+		var req VUsRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		writeResult(w, run.SetVUs(r.PathValue("workflow"), req.VUs))
+	})
+
+	mux.HandleFunc("PUT /workflows/{workflow}/queries/{query}/rate", func(w http.ResponseWriter, r *http.Request) {
+		var req RateRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		writeResult(w, run.ScaleRate(r.PathValue("workflow"), r.PathValue("query"), req.Multiplier))
+	})
+
+	mux.HandleFunc("POST /workflows/{workflow}/pause", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, run.PauseWorkflow(r.PathValue("workflow")))
+	})
+
+	mux.HandleFunc("POST /workflows/{workflow}/resume", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, run.ResumeWorkflow(r.PathValue("workflow")))
+	})
+
+	mux.HandleFunc("GET /ddl", func(w http.ResponseWriter, r *http.Request) {
+		running, last := run.DDL()
+
+		status := DDLStatus{Running: make([]DDL, 0, len(running))}
+		for _, d := range running {
+			status.Running = append(status.Running, newDDL(d))
+		}
+		if last != nil {
+			d := newDDL(*last)
+			status.Last = &d
+		}
+
+		writeJSON(w, http.StatusOK, status)
+	})
+
+	mux.HandleFunc("POST /ddl", func(w http.ResponseWriter, r *http.Request) {
+		var req DDLRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		if err := run.RunDDL(req.Statement); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	return mux
+}
+
+func newDDL(d model.DDL) DDL {
+	out := DDL{
+		Workflow: d.Workflow,
+		Name:     d.Name,
+		Start:    d.Start,
+	}
+
+	if !d.End.IsZero() {
+		out.DurationMs = float64(d.End.Sub(d.Start).Microseconds()) / 1000
+	}
+	if d.Err != nil {
+		out.Error = d.Err.Error()
+	}
+
+	return out
+}
+
+// Listen listens on a TCP address or, if prefixed with "unix:", a unix
+// socket, removing a stale socket left by a previous run. The control
+// API isn't authenticated, so TCP addresses must be on the loopback
+// interface.
+func Listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixPrefix)
+	if !ok {
+		if err := checkLoopback(addr); err != nil {
+			return nil, err
+		}
+		return net.Listen("tcp", addr)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket in use: %q", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket: %w", err)
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+// checkLoopback returns an error unless a TCP address's host is
+// localhost or a loopback IP. An empty host would listen on every
+// interface, so it's rejected too.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("parsing address: %w", err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return fmt.Errorf("control api can only listen on a loopback address (e.g. localhost:7070) or a unix socket, got %q", addr)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+		return false
+	}
+
+	return true
+}
+
+func writeResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(v)
+}
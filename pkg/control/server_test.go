@@ -0,0 +1,152 @@
+package control
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockRun struct {
+	calls []string
+}
+
+func (m *mockRun) Workflows() []model.WorkflowStatus {
+	return []model.WorkflowStatus{
+		{Name: "shop", VUs: 2, ActiveVUs: 2, Queries: []model.QueryStatus{{Name: "browse", Rate: "10/1s", Multiplier: 1}}},
+	}
+}
+
+func (m *mockRun) SetVUs(workflow string, n int) error {
+	if workflow != "shop" {
+		return errors.New("workflow isn't running: " + `"` + workflow + `"`)
+	}
+	m.calls = append(m.calls, "vus "+workflow)
+	return nil
+}
+
+func (m *mockRun) ScaleRate(workflow, query string, multiplier float64) error {
+	m.calls = append(m.calls, "rate "+workflow+"."+query)
+	return nil
+}
+
+func (m *mockRun) PauseWorkflow(workflow string) error {
+	m.calls = append(m.calls, "pause "+workflow)
+	return nil
+}
+
+func (m *mockRun) ResumeWorkflow(workflow string) error {
+	m.calls = append(m.calls, "resume "+workflow)
+	return nil
+}
+
+func (m *mockRun) RunDDL(stmt string) error {
+	m.calls = append(m.calls, "ddl "+stmt)
+	return nil
+}
+
+func (m *mockRun) DDL() ([]model.DDL, *model.DDL) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return []model.DDL{{Workflow: "ctl", Name: "ddl", Start: start}},
+		&model.DDL{Workflow: "shop", Name: "add_index", Start: start, End: start.Add(1500 * time.Millisecond), Err: errors.New("boom")}
+}
+
+func TestControl(t *testing.T) {
+	run := &mockRun{}
+
+	server := httptest.NewServer(Handler(run))
+	defer server.Close()
+
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	workflows, err := client.Workflows()
+	assert.NoError(t, err)
+	assert.Equal(t, run.Workflows(), workflows)
+
+	assert.NoError(t, client.SetVUs("shop", 4))
+	assert.NoError(t, client.ScaleRate("shop", "browse", 2))
+	assert.NoError(t, client.PauseWorkflow("shop"))
+	assert.NoError(t, client.ResumeWorkflow("shop"))
+	assert.NoError(t, client.RunDDL("CREATE INDEX ON product (name)"))
+
+	assert.Equal(t, []string{
+		"vus shop",
+		"rate shop.browse",
+		"pause shop",
+		"resume shop",
+		"ddl CREATE INDEX ON product (name)",
+	}, run.calls)
+
+	assert.Equal(t, errors.New(`control api: workflow isn't running: "missing"`), client.SetVUs("missing", 1))
+
+	status, err := client.DDL()
+	assert.NoError(t, err)
+	assert.Len(t, status.Running, 1)
+	assert.Equal(t, "ddl", status.Running[0].Name)
+	assert.Equal(t, &DDL{Workflow: "shop", Name: "add_index", Start: status.Last.Start, DurationMs: 1500, Error: "boom"}, status.Last)
+}
+
+func TestControlInvalidRequest(t *testing.T) {
+	server := httptest.NewServer(Handler(&mockRun{}))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/ddl", "application/json", strings.NewReader("{"))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestUnixSocket(t *testing.T) {
+	addr := "unix:" + filepath.Join(t.TempDir(), "drk.sock")
+
+	listener, err := Listen(addr)
+	assert.NoError(t, err)
+
+	go http.Serve(listener, Handler(&mockRun{}))
+
+	// A socket that's in use isn't replaced.
+	_, err = Listen(addr)
+	assert.ErrorContains(t, err, "socket in use")
+
+	workflows, err := NewClient(addr).Workflows()
+	assert.NoError(t, err)
+	assert.Len(t, workflows, 1)
+
+	listener.Close()
+}
+
+func TestListenTCP(t *testing.T) {
+	cases := []struct {
+		name   string
+		addr   string
+		expErr bool
+	}{
+		{name: "localhost", addr: "localhost:0"},
+		{name: "ipv4 loopback", addr: "127.0.0.1:0"},
+		{name: "every interface", addr: ":0", expErr: true},
+		{name: "unspecified ip", addr: "0.0.0.0:0", expErr: true},
+		{name: "remote host", addr: "example.com:7070", expErr: true},
+		{name: "missing port", addr: "localhost", expErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			listener, err := Listen(c.addr)
+			if c.expErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			listener.Close()
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package model
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+)
+
+// aggregator accumulates the results of a query run by a single VU.
+// It's recorded to by the VU and harvested concurrently, using atomics
+// so that neither has to wait for the other.
+type aggregator struct {
+	workflow string
+	name     string
+	stale    bool
+
+	count             atomic.Int64
+	connectionErrors  atomic.Int64
+	statementErrors   atomic.Int64
+	assertionFailures atomic.Int64
+	skipped           atomic.Int64
+
+	latency atomicHistogram
+	wait    atomicHistogram
+}
+
+// record adds the outcome of running a query.
+func (a *aggregator) record(stats repo.Stats, err error) {
+	a.count.Add(1)
+
+	if err != nil {
+		switch errorClass(err) {
+		case ErrorClassConnection:
+			a.connectionErrors.Add(1)
+			return
+		case ErrorClassStatement:
+			a.statementErrors.Add(1)
+			return
+		case ErrorClassAssertion:
+			a.assertionFailures.Add(1)
+		}
+	}
+
+	a.latency.record(stats.Query)
+	a.wait.record(stats.Wait)
+}
+
+// skip records a tick on which the query wasn't run, because its
+// dependencies hadn't produced data yet.
+func (a *aggregator) skip() {
+	a.skipped.Add(1)
+}
+
+// QueryStats are the aggregated results of a query within a workflow.
+type QueryStats struct {
+	Workflow string
+	Name     string
+
+	// Stale is true if the query is a historical read.
+	Stale bool
+
+	// Count is the number of times the query was run, including those
+	// that failed.
+	Count int
+
+	// Errors is the number of times the statement failed to run, of
+	// which ConnectionErrors failed to acquire a connection.
+	Errors           int
+	ConnectionErrors int
+
+	// AssertionFailures is the number of times the statement ran but
+	// its results didn't match the activity's expectations.
+	AssertionFailures int
+
+	// Skipped is the number of times the query was due to run but
+	// didn't, because the data its args depend on wasn't available.
+	Skipped int
+
+	// Latency and Wait hold the time taken to run, and to acquire a
+	// connection for, each statement that ran, whether or not its
+	// results matched expectations.
+	Latency Histogram
+	Wait    Histogram
+}
+
+func (qs *QueryStats) merge(a *aggregator) {
+	// Outcomes are recorded after the count, so reading them first
+	// means a concurrent harvest never sees more outcomes than runs.
+	connectionErrors := a.connectionErrors.Load()
+	statementErrors := a.statementErrors.Load()
+	assertionFailures := a.assertionFailures.Load()
+	latency := a.latency.snapshot()
+	wait := a.wait.snapshot()
+
+	qs.Count += int(a.count.Load())
+	qs.ConnectionErrors += int(connectionErrors)
+	qs.Errors += int(connectionErrors + statementErrors)
+	qs.AssertionFailures += int(assertionFailures)
+	qs.Skipped += int(a.skipped.Load())
+	qs.Latency.merge(latency)
+	qs.Wait.merge(wait)
+}
+
+// Sub returns the results recorded since an earlier snapshot of the
+// same query.
+func (qs QueryStats) Sub(prev QueryStats) QueryStats {
+	d := qs
+	d.Count -= prev.Count
+	d.Errors -= prev.Errors
+	d.ConnectionErrors -= prev.ConnectionErrors
+	d.AssertionFailures -= prev.AssertionFailures
+	d.Skipped -= prev.Skipped
+	d.Latency = qs.Latency.Sub(prev.Latency)
+	d.Wait = qs.Wait.Sub(prev.Wait)
+
+	return d
+}
+
+// Percentile returns the latency below which the given percentage of
+// statements completed.
+func (qs QueryStats) Percentile(p float64) time.Duration {
+	return qs.Latency.Quantile(p)
+}
+
+// Min returns the lowest statement latency.
+func (qs QueryStats) Min() time.Duration {
+	return qs.Latency.Min
+}
+
+// Max returns the highest statement latency.
+func (qs QueryStats) Max() time.Duration {
+	return qs.Latency.Max
+}
+
+// Mean returns the average statement latency.
+func (qs QueryStats) Mean() time.Duration {
+	return qs.Latency.Mean()
+}
+
+// ErrorRate returns the fraction of runs that either failed or didn't
+// match expectations.
+func (qs QueryStats) ErrorRate() float64 {
+	if qs.Count == 0 {
+		return 0
+	}
+	return float64(qs.Errors+qs.AssertionFailures) / float64(qs.Count)
+}
+
+// Throughput returns the number of statements that ran per second.
+func (qs QueryStats) Throughput(elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(qs.Count-qs.Errors) / elapsed.Seconds()
+}
+
+// newAggregator registers an aggregator for a query run by a VU.
+func (r *Runner) newAggregator(workflowName, queryName string, query Query) *aggregator {
+	a := &aggregator{
+		workflow: workflowName,
+		name:     queryName,
+		stale:    query.AsOf != "",
+	}
+
+	r.aggregatorsMu.Lock()
+	defer r.aggregatorsMu.Unlock()
+
+	r.aggregators = append(r.aggregators, a)
+	return a
+}
+
+// Harvest returns the results of each query run so far, across all VUs,
+// ordered by workflow and query name. Setup queries are included, with
+// their workflow names prefixed with "*".
+func (r *Runner) Harvest() []QueryStats {
+	r.aggregatorsMu.Lock()
+	aggregators := r.aggregators[:len(r.aggregators):len(r.aggregators)]
+	r.aggregatorsMu.Unlock()
+
+	byKey := map[string]*QueryStats{}
+	for _, a := range aggregators {
+		key := a.workflow + "." + a.name
+
+		qs, ok := byKey[key]
+		if !ok {
+			qs = &QueryStats{Workflow: a.workflow, Name: a.name, Stale: a.stale}
+			byKey[key] = qs
+		}
+		qs.merge(a)
+	}
+
+	out := make([]QueryStats, 0, len(byKey))
+	for _, qs := range byKey {
+		out = append(out, *qs)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Workflow != out[j].Workflow {
+			return out[i].Workflow < out[j].Workflow
+		}
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+// Results returns the results of each query run so far, excluding setup
+// queries, and the time elapsed since the run started.
+func (r *Runner) Results(now time.Time) ([]QueryStats, time.Duration) {
+	var elapsed time.Duration
+	if start := r.started.Load(); start != nil {
+		elapsed = now.Sub(*start)
+	}
+
+	return withoutSetup(r.Harvest()), elapsed
+}
+
+func withoutSetup(stats []QueryStats) []QueryStats {
+	var out []QueryStats
+	for _, qs := range stats {
+		if !strings.HasPrefix(qs.Workflow, "*") {
+			out = append(out, qs)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,138 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvest(t *testing.T) {
+	var r Runner
+
+	// Two VUs running the same query, plus a setup query.
+	vu1 := r.newAggregator("shop", "browse", Query{})
+	vu2 := r.newAggregator("shop", "browse", Query{})
+	stale := r.newAggregator("shop", "history", Query{AsOf: "-10s"})
+	setup := r.newAggregator("*shop", "setup", Query{})
+
+	vu1.record(repo.Stats{Query: time.Millisecond, Wait: time.Microsecond}, nil)
+	vu2.record(repo.Stats{Query: 3 * time.Millisecond}, nil)
+	vu2.record(repo.Stats{}, repo.ConnErr{Err: errors.New("refused")})
+	vu2.record(repo.Stats{}, errors.New("syntax error"))
+	vu1.record(repo.Stats{Query: 2 * time.Millisecond}, AssertionErr{})
+	vu1.skip()
+	vu2.skip()
+	stale.record(repo.Stats{Query: time.Millisecond}, nil)
+	setup.record(repo.Stats{Query: time.Millisecond}, nil)
+
+	stats := r.Harvest()
+	assert.Len(t, stats, 3)
+
+	assert.Equal(t, "*shop", stats[0].Workflow)
+	assert.Equal(t, "setup", stats[0].Name)
+
+	browse := stats[1]
+	assert.Equal(t, "browse", browse.Name)
+	assert.False(t, browse.Stale)
+	assert.Equal(t, 5, browse.Count)
+	assert.Equal(t, 2, browse.Errors)
+	assert.Equal(t, 1, browse.ConnectionErrors)
+	assert.Equal(t, 1, browse.AssertionFailures)
+	assert.Equal(t, 2, browse.Skipped)
+	assert.Equal(t, int64(3), browse.Latency.Count)
+	assert.Equal(t, time.Millisecond, browse.Min())
+	assert.Equal(t, 3*time.Millisecond, browse.Max())
+	assert.Equal(t, 2*time.Millisecond, browse.Mean())
+	assert.Equal(t, time.Microsecond, browse.Wait.Max)
+
+	assert.Equal(t, "history", stats[2].Name)
+	assert.True(t, stats[2].Stale)
+
+	r.started.Store(&time.Time{})
+	results, _ := r.Results(time.Time{}.Add(time.Second))
+	assert.Len(t, results, 2)
+}
+
+func TestHarvestConcurrent(t *testing.T) {
+	var r Runner
+
+	const vus, records = 8, 1000
+
+	var wg sync.WaitGroup
+	for range vus {
+		a := r.newAggregator("shop", "browse", Query{})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range records {
+				a.record(repo.Stats{Query: time.Duration(i) * time.Microsecond}, nil)
+			}
+		}()
+	}
+
+	// Harvests taken while VUs are recording are consistent.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			for _, qs := range r.Harvest() {
+				assert.LessOrEqual(t, qs.Latency.Count, int64(qs.Count))
+			}
+		}
+	}()
+
+	wg.Wait()
+	<-done
+
+	stats := r.Harvest()
+	assert.Equal(t, vus*records, stats[0].Count)
+	assert.Equal(t, int64(vus*records), stats[0].Latency.Count)
+}
+
+func BenchmarkAggregatorRecord(b *testing.B) {
+	var r Runner
+	a := r.newAggregator("shop", "browse", Query{})
+	stats := repo.Stats{Query: 3 * time.Millisecond, Wait: 50 * time.Microsecond}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		a.record(stats, nil)
+	}
+}
+
+func BenchmarkAggregatorRecordParallel(b *testing.B) {
+	var r Runner
+	stats := repo.Stats{Query: 3 * time.Millisecond, Wait: 50 * time.Microsecond}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	// Each goroutine records to its own aggregator, as VUs do.
+	b.RunParallel(func(pb *testing.PB) {
+		a := r.newAggregator("shop", "browse", Query{})
+		for pb.Next() {
+			a.record(stats, nil)
+		}
+	})
+}
+
+func BenchmarkEmit(b *testing.B) {
+	r := Runner{events: make(chan Event, 1000)}
+	e := Event{Workflow: "shop", Name: "browse", Duration: 3 * time.Millisecond}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	// Nothing consumes the events, so once the stream fills each is
+	// dropped rather than blocking.
+	for range b.N {
+		r.emit(e)
+	}
+}
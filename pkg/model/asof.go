@@ -0,0 +1,71 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	followerReadTimestamp = "follower_read_timestamp()"
+)
+
+// asOfDrivers are the drivers whose databases support AS OF SYSTEM TIME.
+// The pgx driver is assumed to be connected to CockroachDB.
+var asOfDrivers = map[string]bool{
+	"pgx": true,
+}
+
+// resolveAsOf returns the AS OF SYSTEM TIME expression a query should run
+// at. Whether the driver it runs against supports it is checked per
+// workflow, by validateAsOf, as only the workflows that run the query
+// need to.
+func (q Query) resolveAsOf() (string, error) {
+	if q.Type != "query" {
+		return "", fmt.Errorf("AS OF SYSTEM TIME is only supported by query activities (got: %q)", q.Type)
+	}
+
+	if q.AsOf == followerReadTimestamp {
+		return q.AsOf, nil
+	}
+
+	d, err := time.ParseDuration(q.AsOf)
+	if err != nil {
+		return "", fmt.Errorf("expected %s or a duration: %w", followerReadTimestamp, err)
+	}
+
+	if d >= 0 {
+		return "", fmt.Errorf("duration must be negative (got: %s)", q.AsOf)
+	}
+
+	return fmt.Sprintf("'%s'", q.AsOf), nil
+}
+
+// validateAsOf checks that every workflow running an activity with as_of,
+// as a query or setup query, targets a driver that supports AS OF SYSTEM
+// TIME.
+func (r *Runner) validateAsOf() error {
+	for name, workflow := range r.cfg.Workflows {
+		_, driver, err := r.target(workflow)
+		if err != nil {
+			return fmt.Errorf("validating as_of for workflow %q: %w", name, err)
+		}
+
+		if asOfDrivers[driver] {
+			continue
+		}
+
+		names := slices.Clone(workflow.SetupQueries)
+		for _, query := range workflow.Queries {
+			names = append(names, query.Name)
+		}
+
+		for _, act := range names {
+			if r.cfg.Activities[act].AsOf != "" {
+				return fmt.Errorf("validating as_of for workflow %q: activity %q: AS OF SYSTEM TIME isn't supported by driver %q", name, act, driver)
+			}
+		}
+	}
+
+	return nil
+}
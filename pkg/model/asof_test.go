@@ -0,0 +1,137 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveAsOf(t *testing.T) {
+	cases := []struct {
+		name   string
+		query  Query
+		exp    string
+		expErr error
+	}{
+		{
+			name:  "follower read timestamp",
+			query: Query{Type: "query", AsOf: "follower_read_timestamp()"},
+			exp:   "follower_read_timestamp()",
+		},
+		{
+			name:  "negative duration",
+			query: Query{Type: "query", AsOf: "-10s"},
+			exp:   "'-10s'",
+		},
+		{
+			name:   "positive duration",
+			query:  Query{Type: "query", AsOf: "10s"},
+			expErr: errors.New("duration must be negative (got: 10s)"),
+		},
+		{
+			name:   "invalid value",
+			query:  Query{Type: "query", AsOf: "now()"},
+			expErr: errors.New(`expected follower_read_timestamp() or a duration: time: invalid duration "now()"`),
+		},
+		{
+			name:   "exec activity",
+			query:  Query{Type: "exec", AsOf: "-10s"},
+			expErr: errors.New(`AS OF SYSTEM TIME is only supported by query activities (got: "exec")`),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act, err := c.query.resolveAsOf()
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr.Error(), err.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestRunQueryAsOf(t *testing.T) {
+	var stmts []string
+	sess := mockSession{
+		mockQueryer: mockQueryer{
+			query: func(query string, args ...any) ([]map[string]any, repo.Stats, error) {
+				stmts = append(stmts, query)
+				return nil, repo.Stats{}, nil
+			},
+			exec: func(query string, args ...any) (repo.Stats, error) {
+				stmts = append(stmts, query)
+				return repo.Stats{}, nil
+			},
+		},
+	}
+	db := mockSessioner{
+		session: func() (repo.Session, error) {
+			return &sess, nil
+		},
+	}
+
+	cfg := Drk{
+		Activities: map[string]Query{
+			"browse": {
+				Type:  "query",
+				Query: "SELECT * FROM product",
+				AsOf:  "follower_read_timestamp()",
+			},
+		},
+	}
+	assert.NoError(t, cfg.Prepare("pgx"))
+
+	r, err := NewRunner(&cfg, &db, "", "pgx", 0, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	vu := NewVU(&zerolog.Logger{})
+	vu.driver = "pgx"
+
+	_, _, err = r.runQuery(context.Background(), vu, cfg.Activities["browse"])
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"BEGIN AS OF SYSTEM TIME follower_read_timestamp()",
+		"SELECT * FROM product",
+		"COMMIT",
+	}, stmts)
+}
+
+func TestValidateAsOf(t *testing.T) {
+	cfg := Drk{
+		Connections: map[string]Connection{
+			"crdb":  {Driver: "pgx"},
+			"mysql": {Driver: "mysql"},
+		},
+		Workflows: map[string]Workflow{
+			"reporting": {Connection: "crdb", Queries: []WorkflowQuery{{Name: "history"}}},
+			"shopper":   {Connection: "mysql", Queries: []WorkflowQuery{{Name: "browse"}}},
+		},
+		Activities: map[string]Query{
+			"history": {Type: "query", Query: "SELECT 1", AsOf: "-10s"},
+			"browse":  {Type: "query", Query: "SELECT 1"},
+		},
+	}
+	assert.NoError(t, cfg.Prepare("mysql", "pgx"))
+
+	r, err := NewRunner(&cfg, &mockQueryer{}, "", "mysql", 0, &zerolog.Logger{})
+	assert.NoError(t, err)
+	r.AddConnection("crdb", &mockQueryer{})
+	r.AddConnection("mysql", &mockQueryer{})
+
+	// Workflows that don't run the query aren't affected by its driver.
+	assert.NoError(t, r.validateAsOf())
+	assert.Equal(t, "", cfg.Activities["history"].statement("mysql").asOf)
+	assert.Equal(t, "'-10s'", cfg.Activities["history"].statement("pgx").asOf)
+
+	cfg.Workflows["shopper"] = Workflow{Connection: "mysql", Queries: []WorkflowQuery{{Name: "history"}}}
+	assert.Equal(t, `validating as_of for workflow "shopper": activity "history": AS OF SYSTEM TIME isn't supported by driver "mysql"`, r.validateAsOf().Error())
+}
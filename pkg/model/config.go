@@ -1,11 +1,13 @@
 package model
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/codingconcepts/drk/pkg/repo"
 	"gopkg.in/yaml.v3"
 )
 
@@ -18,6 +20,47 @@ func dependencyFuncNoop(*VU) bool { return true }
 type Drk struct {
 	Workflows  map[string]Workflow `yaml:"workflows"`
 	Activities map[string]Query    `yaml:"activities"`
+	Pool       repo.PoolConfig     `yaml:"pool"`
+
+	// Nodes to balance statements across, using the LoadBalancing
+	// strategy.
+	URLs          []NodeURL `yaml:"urls"`
+	LoadBalancing string    `yaml:"load_balancing"`
+
+	// Named connection targets that workflows can run against instead
+	// of the default connection.
+	Connections map[string]Connection `yaml:"connections"`
+
+	// Conditions the run must meet to pass, e.g. "create_purchase.p99 <
+	// 250ms".
+	Thresholds []Threshold `yaml:"thresholds"`
+}
+
+// Connection is a database target with its own driver and pool settings.
+type Connection struct {
+	URL           string          `yaml:"url"`
+	URLs          []NodeURL       `yaml:"urls"`
+	LoadBalancing string          `yaml:"load_balancing"`
+	Driver        string          `yaml:"driver"`
+	Pool          repo.PoolConfig `yaml:"pool"`
+}
+
+// Nodes returns the nodes of a connection, whether provided as a single
+// URL or a list of URLs.
+func (c Connection) Nodes() []NodeURL {
+	if c.URL == "" {
+		return c.URLs
+	}
+
+	return append([]NodeURL{{URL: c.URL}}, c.URLs...)
+}
+
+// NodeURL is the connection string of a database node, with an optional
+// name to report it as and locality to match workflows against.
+type NodeURL struct {
+	URL      string `yaml:"url"`
+	Name     string `yaml:"name"`
+	Locality string `yaml:"locality"`
 }
 
 type WorkflowQuery struct {
@@ -26,9 +69,31 @@ type WorkflowQuery struct {
 }
 
 type Query struct {
-	Type  string `yaml:"type"`
-	Args  []Arg  `yaml:"args"`
-	Query string `yaml:"query"`
+	Type   string `yaml:"type"`
+	Args   []Arg  `yaml:"args"`
+	Query  string `yaml:"query"`
+	Retain Retain `yaml:"retain"`
+
+	// Map of driver names to queries that replace Query when running
+	// against that driver.
+	QueryByDriver map[string]string `yaml:"query_by_driver"`
+
+	// Map of VU variable names to the result columns captured into them,
+	// from a query that returns at most one row.
+	Capture map[string]string `yaml:"capture"`
+
+	// Session variables applied to the transaction the query runs in.
+	SessionSettings map[string]string `yaml:"session_settings"`
+
+	// Timestamp to run query activities AS OF SYSTEM TIME, either as
+	// follower_read_timestamp() or a negative duration like -10s.
+	AsOf string `yaml:"as_of"`
+
+	// Assertions made against the results of each execution.
+	Expect Expect `yaml:"expect"`
+
+	// Map of driver names to the statement prepared for them.
+	prepared map[string]statement
 }
 
 type Rate struct {
@@ -39,16 +104,25 @@ type Rate struct {
 }
 
 func (r *Rate) UnmarshalYAML(node *yaml.Node) error {
-	parts := strings.Split(node.Value, "/")
+	times, interval, ok := strings.Cut(node.Value, "/")
+	if !ok {
+		return fmt.Errorf("invalid rate: %q (expected <times>/<interval>, e.g. 10/1s)", node.Value)
+	}
 
 	var err error
-	if r.Times, err = strconv.Atoi(parts[0]); err != nil {
+	if r.Times, err = strconv.Atoi(times); err != nil {
 		return fmt.Errorf("parsing times: %w", err)
 	}
+	if r.Times <= 0 {
+		return fmt.Errorf("times must be positive (got: %d)", r.Times)
+	}
 
-	if r.Interval, err = time.ParseDuration(parts[1]); err != nil {
+	if r.Interval, err = time.ParseDuration(interval); err != nil {
 		return fmt.Errorf("parsing interval: %w", err)
 	}
+	if r.Interval <= 0 {
+		return fmt.Errorf("interval must be positive (got: %s)", r.Interval)
+	}
 
 	r.tickerInterval = r.Interval / time.Duration(r.Times)
 
@@ -61,54 +135,141 @@ func (r Rate) String() string {
 
 type Workflow struct {
 	Vus          int             `yaml:"vus"`
+	Vars         map[string]Arg  `yaml:"vars"`
 	SetupQueries []string        `yaml:"setup_queries"`
 	Queries      []WorkflowQuery `yaml:"queries"`
+
+	Connection string `yaml:"connection"`
+	Locality   string `yaml:"locality"`
+	Session    string `yaml:"session"`
+
+	// Statements run against each VU's connection when it's opened, if
+	// the workflow uses sticky sessions. Occurrences of {workflow} and
+	// {vu} are replaced with the workflow name and VU number.
+	SessionInit []string `yaml:"session_init"`
+
+	// Session variables applied to the connection used by the workflow's
+	// VUs, with application_name defaulting to drk/<workflow>.
+	SessionSettings map[string]string `yaml:"session_settings"`
 }
 
 type Arg struct {
 	Type string `yaml:"type"`
+	Name string `yaml:"name"`
 
 	generator       genFunc
 	dependencyCheck dependencyFunc
+
+	// Activity and column a ref arg takes its values from, or the VU
+	// variable a var arg reads, used to build the dependency graph.
+	refQuery  string
+	refColumn string
+	varName   string
 }
 
-func (a *Arg) UnmarshalYAML(unmarshal func(any) error) error {
+// argFields are the fields each type of arg may have, in addition to its
+// type and name.
+var argFields = map[string][]string{
+	"gen":       {"value"},
+	"ref":       {"query", "column"},
+	"set":       {"values", "weights"},
+	"const":     {"value"},
+	"var":       {"value"},
+	"int":       {"min", "max"},
+	"float":     {"min", "max"},
+	"timestamp": {"min", "max"},
+	"interval":  {"min", "max"},
+	"duration":  {"min", "max"},
+}
+
+func (a *Arg) UnmarshalYAML(node *yaml.Node) error {
 	var raw map[string]any
-	if err := unmarshal(&raw); err != nil {
+	if err := node.Decode(&raw); err != nil {
 		return err
 	}
 
 	argType, err := parseField[string](raw, "type")
 	if err != nil {
-		return fmt.Errorf("parsing type: %w", err)
+		return argErr(node, fmt.Errorf("parsing type: %w", err))
+	}
+
+	// Types are case-insensitive, so they're matched in lower case
+	// everywhere args are read.
+	argType = strings.ToLower(argType)
+	a.Type = argType
+
+	fields, ok := argFields[argType]
+	if !ok {
+		_, typeNode := mappingValue(node, "type")
+		return nodeErr(typeNode, "type", fmt.Errorf("invalid arg type: %q", argType))
+	}
+	if err = checkKeys(node, append([]string{"type", "name"}, fields...)...); err != nil {
+		return err
+	}
+
+	if _, ok := raw["name"]; ok {
+		if a.Name, err = parseField[string](raw, "name"); err != nil {
+			return argErr(node, fmt.Errorf("parsing name: %w", err))
+		}
 	}
 
 	switch argType {
 	case "gen":
 		if a.generator, a.dependencyCheck, err = parseArgTypeGen(raw); err != nil {
-			return fmt.Errorf("parsing gen arg type: %w", err)
+			return argErr(node, fmt.Errorf("parsing gen arg type: %w", err))
 		}
 
 	case "ref":
 		if a.generator, a.dependencyCheck, err = parseArgTypeRef(raw); err != nil {
-			return fmt.Errorf("parsing ref arg type: %w", err)
+			return argErr(node, fmt.Errorf("parsing ref arg type: %w", err))
 		}
+		a.refQuery, _ = raw["query"].(string)
+		a.refColumn, _ = raw["column"].(string)
 
 	case "set":
 		if a.generator, a.dependencyCheck, err = parseArgTypeSet(raw); err != nil {
-			return fmt.Errorf("parsing set arg type: %w", err)
+			return argErr(node, fmt.Errorf("parsing set arg type: %w", err))
 		}
 
 	case "const":
 		if a.generator, a.dependencyCheck, err = parseArgTypeConst(raw); err != nil {
-			return fmt.Errorf("parsing const arg type: %w", err)
+			return argErr(node, fmt.Errorf("parsing const arg type: %w", err))
 		}
 
+	case "var":
+		if a.generator, a.dependencyCheck, err = parseArgTypeVar(raw); err != nil {
+			return argErr(node, fmt.Errorf("parsing var arg type: %w", err))
+		}
+		a.varName, _ = raw["value"].(string)
+
 	default:
 		if a.generator, a.dependencyCheck, err = parseArgTypeScalar(argType, raw); err != nil {
-			return fmt.Errorf("parsing scalar arg type: %w", err)
+			return argErr(node, fmt.Errorf("parsing scalar arg type: %w", err))
 		}
 	}
 
 	return nil
 }
+
+// argErr returns an error parsing an arg at the position of the field it
+// relates to, or of the arg itself if the field is missing.
+func argErr(node *yaml.Node, err error) error {
+	var name string
+
+	var missing FieldMissingErr
+	var mismatch FieldTypeErr
+	var invalid FieldValueErr
+	switch {
+	case errors.As(err, &mismatch):
+		name = mismatch.Name
+	case errors.As(err, &invalid):
+		name = invalid.Name
+	case errors.As(err, &missing):
+		return nodeErr(node, "", err)
+	}
+
+	if _, value := mappingValue(node, name); value != nil {
+		return nodeErr(value, name, err)
+	}
+	return nodeErr(node, "", err)
+}
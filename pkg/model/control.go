@@ -0,0 +1,157 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ddlStatements are the leading keywords of statements that change a
+// database's schema.
+var ddlStatements = map[string]bool{
+	"ALTER":    true,
+	"COMMENT":  true,
+	"CREATE":   true,
+	"DROP":     true,
+	"RENAME":   true,
+	"TRUNCATE": true,
+}
+
+// Pause stops VUs from running activities until Resume is called. The
+// run's duration is unaffected.
+func (r *Runner) Pause() {
+	r.paused.Store(true)
+}
+
+// Resume lets paused VUs run activities again.
+func (r *Runner) Resume() {
+	r.paused.Store(false)
+}
+
+// Paused returns true if the run is paused.
+func (r *Runner) Paused() bool {
+	return r.paused.Load()
+}
+
+// Stop ends the run early. VUs finish their current activities and the
+// run then finishes as it would once its duration had elapsed, so Run
+// returns once they have.
+func (r *Runner) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopped)
+	})
+}
+
+// SetRateMultiplier scales the rate at which every activity runs, taking
+// effect from each activity's next tick.
+func (r *Runner) SetRateMultiplier(m float64) error {
+	if m <= 0 || math.IsInf(m, 0) || math.IsNaN(m) {
+		return fmt.Errorf("invalid rate multiplier: %v", m)
+	}
+
+	r.rateMultiplier.Store(math.Float64bits(m))
+	return nil
+}
+
+// RateMultiplier returns the multiplier applied to the rate of every
+// activity, defaulting to 1.
+func (r *Runner) RateMultiplier() float64 {
+	bits := r.rateMultiplier.Load()
+	if bits == 0 {
+		return 1
+	}
+
+	return math.Float64frombits(bits)
+}
+
+// scaleInterval returns the interval between an activity's ticks at the
+// given rate multiplier.
+func scaleInterval(interval time.Duration, m float64) time.Duration {
+	return max(time.Duration(float64(interval)/m), time.Microsecond)
+}
+
+// DDL is the status of a schema change run by a VU.
+type DDL struct {
+	Workflow string
+	Name     string
+	Start    time.Time
+
+	// End is zero while the statement is running.
+	End time.Time
+	Err error
+}
+
+// ddlTracker records the schema changes that are running and the last
+// one that finished.
+type ddlTracker struct {
+	mu      sync.Mutex
+	nextID  int
+	running map[int]DDL
+	last    *DDL
+}
+
+func isDDL(query string) bool {
+	keyword, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	return ddlStatements[strings.ToUpper(keyword)]
+}
+
+// trackDDL records the start of an activity if it's a schema change,
+// returning a function to record its end.
+func (r *Runner) trackDDL(workflowName, queryName string, query Query) func(error) {
+	if query.Type != "exec" || !isDDL(query.Query) {
+		return func(error) {}
+	}
+
+	t := &r.ddl
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.running == nil {
+		t.running = map[int]DDL{}
+	}
+
+	id := t.nextID
+	t.nextID++
+	t.running[id] = DDL{Workflow: workflowName, Name: queryName, Start: time.Now()}
+
+	return func(err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		d := t.running[id]
+		delete(t.running, id)
+
+		d.End = time.Now()
+		d.Err = err
+		t.last = &d
+	}
+}
+
+// DDL returns the schema changes currently running, oldest first, and the
+// last one to finish, if any.
+func (r *Runner) DDL() ([]DDL, *DDL) {
+	t := &r.ddl
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	running := make([]DDL, 0, len(t.running))
+	for _, d := range t.running {
+		running = append(running, d)
+	}
+	sort.Slice(running, func(i, j int) bool {
+		return running[i].Start.Before(running[j].Start)
+	})
+
+	var last *DDL
+	if t.last != nil {
+		d := *t.last
+		last = &d
+	}
+
+	return running, last
+}
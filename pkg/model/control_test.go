@@ -0,0 +1,80 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPause(t *testing.T) {
+	var r Runner
+	assert.False(t, r.Paused())
+
+	r.Pause()
+	assert.True(t, r.Paused())
+
+	r.Resume()
+	assert.False(t, r.Paused())
+}
+
+func TestRateMultiplier(t *testing.T) {
+	var r Runner
+	assert.Equal(t, 1.0, r.RateMultiplier())
+
+	assert.NoError(t, r.SetRateMultiplier(2.5))
+	assert.Equal(t, 2.5, r.RateMultiplier())
+
+	assert.Equal(t, errors.New("invalid rate multiplier: 0"), r.SetRateMultiplier(0))
+	assert.Equal(t, 2.5, r.RateMultiplier())
+
+	assert.Equal(t, 50*time.Millisecond, scaleInterval(100*time.Millisecond, 2))
+	assert.Equal(t, 200*time.Millisecond, scaleInterval(100*time.Millisecond, 0.5))
+}
+
+func TestIsDDL(t *testing.T) {
+	cases := []struct {
+		query string
+		exp   bool
+	}{
+		{query: "CREATE INDEX ON product (name)", exp: true},
+		{query: "\n  alter table product add column sku STRING", exp: true},
+		{query: "DROP TABLE IF EXISTS product", exp: true},
+		{query: "SELECT * FROM product", exp: false},
+		{query: "INSERT INTO product (name) VALUES ($1)", exp: false},
+		{query: "", exp: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			assert.Equal(t, c.exp, isDDL(c.query))
+		})
+	}
+}
+
+func TestTrackDDL(t *testing.T) {
+	var r Runner
+
+	// Statements that don't change the schema aren't tracked.
+	r.trackDDL("shop", "browse", Query{Type: "query", Query: "SELECT 1"})(nil)
+	running, finished := r.DDL()
+	assert.Empty(t, running)
+	assert.Nil(t, finished)
+
+	done := r.trackDDL("shop", "add_index", Query{Type: "exec", Query: "CREATE INDEX ON product (name)"})
+
+	running, finished = r.DDL()
+	assert.Len(t, running, 1)
+	assert.Equal(t, "add_index", running[0].Name)
+	assert.True(t, running[0].End.IsZero())
+	assert.Nil(t, finished)
+
+	done(errors.New("boom"))
+
+	running, finished = r.DDL()
+	assert.Empty(t, running)
+	assert.Equal(t, "add_index", finished.Name)
+	assert.False(t, finished.End.IsZero())
+	assert.Equal(t, errors.New("boom"), finished.Err)
+}
@@ -0,0 +1,312 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigErr is a problem decoding a config file, at the position of the
+// node it was found at and the path to that node from the root of the
+// file, e.g. activities.create_purchase.args[1].
+type ConfigErr struct {
+	File   string
+	Line   int
+	Column int
+	Path   string
+	Err    error
+}
+
+func (e ConfigErr) Error() string {
+	var b strings.Builder
+
+	if e.File != "" {
+		b.WriteString(e.File + ":")
+	}
+	fmt.Fprintf(&b, "%d:%d: ", e.Line, e.Column)
+	if e.Path != "" {
+		b.WriteString(e.Path + ": ")
+	}
+	b.WriteString(e.Err.Error())
+
+	return b.String()
+}
+
+func (e ConfigErr) Unwrap() error {
+	return e.Err
+}
+
+// ConfigErrs are every problem found decoding a config file.
+type ConfigErrs []ConfigErr
+
+func (errs ConfigErrs) Error() string {
+	return strings.Join(lo.Map(errs, func(e ConfigErr, _ int) string {
+		return e.Error()
+	}), "\n")
+}
+
+// InFile returns the errors, reported against the given file.
+func (errs ConfigErrs) InFile(path string) ConfigErrs {
+	return lo.Map(errs, func(e ConfigErr, _ int) ConfigErr {
+		e.File = path
+		return e
+	})
+}
+
+// UnknownFieldErr is returned when a config file contains a field that
+// isn't part of the config.
+type UnknownFieldErr struct {
+	Name string
+
+	// Fields that are allowed, if there are few enough to list.
+	Allowed []string
+}
+
+func (err UnknownFieldErr) Error() string {
+	if len(err.Allowed) == 0 {
+		return fmt.Sprintf("unknown field %q", err.Name)
+	}
+	return fmt.Sprintf("unknown field %q (expected one of: %s)", err.Name, strings.Join(err.Allowed, ", "))
+}
+
+// rawDrk has the fields of Drk, without its strict decoding.
+type rawDrk Drk
+
+// UnmarshalYAML decodes a config strictly, rejecting unknown fields and
+// reporting every problem found, rather than the first, as ConfigErrs.
+func (d *Drk) UnmarshalYAML(node *yaml.Node) error {
+	c := fieldChecker{decode: true}
+	c.check(node, reflect.TypeOf(rawDrk{}), "")
+	if len(c.errs) > 0 {
+		return c.errs
+	}
+
+	var raw rawDrk
+	if err := node.Decode(&raw); err != nil {
+		return ConfigErrs{nodeErr(node, "", err)}
+	}
+
+	if errs := checkPools(node); len(errs) > 0 {
+		return errs
+	}
+
+	*d = Drk(raw)
+	return nil
+}
+
+// checkPools checks that the pool sizes of the config and each of its
+// connections fit the int32s pgxpool sizes its pools with.
+func checkPools(node *yaml.Node) ConfigErrs {
+	var errs ConfigErrs
+
+	check := func(path string, pool *yaml.Node) {
+		for _, field := range []string{"max_conns", "min_conns"} {
+			_, value := mappingValue(pool, field)
+			if value == nil {
+				continue
+			}
+
+			var n int
+			if err := value.Decode(&n); err == nil && n > math.MaxInt32 {
+				errs = append(errs, nodeErr(value, joinPath(path, field), fmt.Errorf("must be at most %d (got: %d)", math.MaxInt32, n)))
+			}
+		}
+	}
+
+	_, pool := mappingValue(node, "pool")
+	check("pool", pool)
+
+	_, connections := mappingValue(node, "connections")
+	for _, entry := range mappingEntries(connections) {
+		_, pool := mappingValue(entry[1], "pool")
+		check(joinPath(joinPath("connections", entry[0].Value), "pool"), pool)
+	}
+
+	return errs
+}
+
+// fieldChecker walks a node alongside the type it's decoded into,
+// collecting an error for each field that the type doesn't have and, if
+// decode is set, for each value that doesn't decode into its field.
+type fieldChecker struct {
+	decode bool
+	errs   ConfigErrs
+}
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+func (c *fieldChecker) check(n *yaml.Node, t reflect.Type, path string) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Tag == "!!null" {
+		return
+	}
+
+	// Types that decode themselves are checked by decoding them.
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		c.decodeInto(n, t, path)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		c.check(n, t.Elem(), path)
+
+	case reflect.Interface:
+		// Any value is allowed.
+
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			c.decodeInto(n, t, path)
+			return
+		}
+
+		fields := yamlFields(t)
+		for _, entry := range mappingEntries(n) {
+			key, value := entry[0], entry[1]
+			if key.Tag == "!!merge" {
+				c.checkMerge(value, t, path)
+				continue
+			}
+
+			ft, ok := fields[key.Value]
+			if !ok {
+				c.errs = append(c.errs, nodeErr(key, path, UnknownFieldErr{Name: key.Value}))
+				continue
+			}
+			c.check(value, ft, joinPath(path, key.Value))
+		}
+
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			c.decodeInto(n, t, path)
+			return
+		}
+
+		for _, entry := range mappingEntries(n) {
+			c.check(entry[1], t.Elem(), joinPath(path, entry[0].Value))
+		}
+
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			c.decodeInto(n, t, path)
+			return
+		}
+
+		for i, item := range n.Content {
+			c.check(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+
+	default:
+		c.decodeInto(n, t, path)
+	}
+}
+
+// checkMerge checks the mappings merged into a struct with "<<".
+func (c *fieldChecker) checkMerge(n *yaml.Node, t reflect.Type, path string) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+
+	if n.Kind == yaml.SequenceNode {
+		for _, item := range n.Content {
+			c.checkMerge(item, t, path)
+		}
+		return
+	}
+
+	c.check(n, t, path)
+}
+
+func (c *fieldChecker) decodeInto(n *yaml.Node, t reflect.Type, path string) {
+	if !c.decode {
+		return
+	}
+
+	if err := n.Decode(reflect.New(t).Interface()); err != nil {
+		c.errs = append(c.errs, nodeErr(n, path, err))
+	}
+}
+
+// yamlFields returns the types of a struct's fields, by the names they're
+// decoded from.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = strings.ToLower(f.Name)
+		}
+
+		fields[name] = f.Type
+	}
+
+	return fields
+}
+
+var yamlLinePrefix = regexp.MustCompile(`^line \d+: `)
+
+// nodeErr returns an error at the position of a node, unless the error
+// already has a more precise position within it.
+func nodeErr(n *yaml.Node, path string, err error) ConfigErr {
+	var ce ConfigErr
+	if errors.As(err, &ce) {
+		ce.Path = joinPath(path, ce.Path)
+		return ce
+	}
+
+	// The decoder's own errors only have line numbers, which the node's
+	// position replaces.
+	var te *yaml.TypeError
+	if errors.As(err, &te) {
+		err = errors.New(strings.Join(lo.Map(te.Errors, func(msg string, _ int) string {
+			return yamlLinePrefix.ReplaceAllString(msg, "")
+		}), "; "))
+	}
+
+	return ConfigErr{Line: n.Line, Column: n.Column, Path: path, Err: err}
+}
+
+func joinPath(path, key string) string {
+	switch {
+	case path == "":
+		return key
+	case key == "":
+		return path
+	case strings.HasPrefix(key, "["):
+		return path + key
+	default:
+		return path + "." + key
+	}
+}
+
+// checkKeys returns an error for the first key in a mapping that isn't
+// one of the allowed keys.
+func checkKeys(n *yaml.Node, allowed ...string) error {
+	for _, entry := range mappingEntries(n) {
+		if !lo.Contains(allowed, entry[0].Value) {
+			sorted := append([]string{}, allowed...)
+			sort.Strings(sorted)
+
+			return nodeErr(entry[0], "", UnknownFieldErr{Name: entry[0].Value, Allowed: sorted})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDrkUnmarshalYAML(t *testing.T) {
+	cases := []struct {
+		name   string
+		config string
+		exp    []string
+	}{
+		{
+			name: "valid",
+			config: `
+workflows:
+  w:
+    vus: 1
+    queries:
+      - name: a
+        rate: 1/1s
+activities:
+  a:
+    type: query
+    args:
+      - type: float
+        min: 1
+        max: 2.5
+    query: SELECT $1`,
+		},
+		{
+			name: "mixed case arg types",
+			config: `
+activities:
+  a:
+    type: query
+    args:
+      - type: GEN
+        value: email
+      - type: Const
+        value: 1
+      - type: INT
+        min: 1
+        max: 2
+    query: SELECT $1, $2, $3`,
+		},
+		{
+			name: "unknown fields",
+			config: `
+workflows:
+  w:
+    vu: 1
+activities:
+  a:
+    type: query
+    qeury: SELECT 1
+    retain:
+      mod: append`,
+			exp: []string{
+				`4:5: workflows.w: unknown field "vu"`,
+				`8:5: activities.a: unknown field "qeury"`,
+				`10:7: activities.a.retain: unknown field "mod" (expected one of: eviction, mode, size)`,
+			},
+		},
+		{
+			name: "unknown arg fields",
+			config: `
+activities:
+  a:
+    args:
+      - type: int
+        min: 1
+        max: 2
+        step: 1
+      - type: ref
+        query: b
+        value: id`,
+			exp: []string{
+				`8:9: activities.a.args[0]: unknown field "step" (expected one of: max, min, name, type)`,
+				`11:9: activities.a.args[1]: unknown field "value" (expected one of: column, name, query, type)`,
+			},
+		},
+		{
+			name: "pool sizes beyond int32",
+			config: `
+pool:
+  max_conns: 2147483648
+connections:
+  eu:
+    url: postgres://eu
+    pool:
+      max_conns: 10
+      min_conns: 2147483648`,
+			exp: []string{
+				`3:14: pool.max_conns: must be at most 2147483647 (got: 2147483648)`,
+				`9:18: connections.eu.pool.min_conns: must be at most 2147483647 (got: 2147483648)`,
+			},
+		},
+		{
+			name: "invalid values",
+			config: `
+workflows:
+  w:
+    vus: many
+    queries:
+      - name: a
+        rate: 10
+activities:
+  a:
+    args:
+      - type: gen
+        value: 1
+      - type: flaot
+      - type: set
+        values: [a, b]
+        weights: [1, heavy]`,
+			exp: []string{
+				"4:10: workflows.w.vus: cannot unmarshal !!str `many` into int",
+				`7:15: workflows.w.queries[0].rate: invalid rate: "10" (expected <times>/<interval>, e.g. 10/1s)`,
+				`12:16: activities.a.args[0].value: parsing gen arg type: parsing value: field type mismatch (got: int exp: string)`,
+				`13:15: activities.a.args[1].type: invalid arg type: "flaot"`,
+				`16:18: activities.a.args[2].weights: parsing set arg type: parsing weights: field type mismatch (got: string exp: int)`,
+			},
+		},
+		{
+			name: "invalid scalar range",
+			config: `
+activities:
+  a:
+    args:
+      - type: timestamp
+        min: yesterday
+        max: 2025-01-01T00:00:00Z
+      - type: interval
+        min: 1m
+        max: 1 hour`,
+			exp: []string{
+				`6:14: activities.a.args[0].min: parsing scalar arg type: parsing min as timestamp: parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`,
+				`10:14: activities.a.args[1].max: parsing scalar arg type: parsing max as duration: time: unknown unit " hour" in duration "1 hour"`,
+			},
+		},
+		{
+			name: "missing arg field",
+			config: `
+activities:
+  a:
+    args:
+      - type: var`,
+			exp: []string{
+				`5:9: activities.a.args[0]: parsing var arg type: parsing value: "value" field is missing:`,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var cfg Drk
+			err := yaml.Unmarshal([]byte(c.config), &cfg)
+
+			if len(c.exp) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var errs ConfigErrs
+			assert.True(t, errors.As(err, &errs))
+
+			var act []string
+			for _, e := range errs {
+				act = append(act, e.Error())
+			}
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestConfigErrsInFile(t *testing.T) {
+	errs := ConfigErrs{
+		{Line: 1, Column: 2, Path: "workflows.w", Err: UnknownFieldErr{Name: "vu"}},
+		{Line: 3, Column: 4, Err: errors.New("boom")},
+	}
+
+	assert.Equal(t, "drk.yaml:1:2: workflows.w: unknown field \"vu\"\ndrk.yaml:3:4: boom", errs.InFile("drk.yaml").Error())
+}
+
+func TestCoerceNumber(t *testing.T) {
+	f, err := parseField[float64](map[string]any{"min": 1}, "min")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, f)
+
+	i, err := parseField[int](map[string]any{"min": 2.0}, "min")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, i)
+
+	_, err = parseField[int](map[string]any{"min": 2.5}, "min")
+	assert.Equal(t, FieldTypeErr{Name: "min", Got: "float64", Exp: "int"}, err)
+
+	// Whole floats beyond the range of an int32 are still ints.
+	i, err = parseField[int](map[string]any{"max": 1e10}, "max")
+	assert.NoError(t, err)
+	assert.Equal(t, 10000000000, i)
+
+	_, err = parseField[int](map[string]any{"max": 1e19}, "max")
+	assert.Equal(t, FieldTypeErr{Name: "max", Got: "float64", Exp: "int"}, err)
+
+	// Integers a float64 can't hold exactly aren't converted.
+	f, err = parseField[float64](map[string]any{"max": 1 << 53}, "max")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1<<53), f)
+
+	_, err = parseField[float64](map[string]any{"max": 1<<53 + 1}, "max")
+	assert.Equal(t, FieldTypeErr{Name: "max", Got: "int", Exp: "float64"}, err)
+}
@@ -11,3 +11,40 @@ type FieldMissingErr struct {
 func (err FieldMissingErr) Error() string {
 	return fmt.Sprintf("%q field is missing:", err.Name)
 }
+
+// FieldTypeErr is returned when a field in the config file isn't of
+// the type expected, and can't be converted to it.
+type FieldTypeErr struct {
+	Name string
+	Got  string
+	Exp  string
+}
+
+func (err FieldTypeErr) Error() string {
+	return fmt.Sprintf("field type mismatch (got: %s exp: %s)", err.Got, err.Exp)
+}
+
+// FieldValueErr is returned when a field in the config file is of the
+// type expected, but its value is invalid.
+type FieldValueErr struct {
+	Name string
+	Err  error
+}
+
+func (err FieldValueErr) Error() string {
+	return err.Err.Error()
+}
+
+func (err FieldValueErr) Unwrap() error {
+	return err.Err
+}
+
+// AssertionErr is returned when a statement succeeds but its results
+// don't match an activity's expectations.
+type AssertionErr struct {
+	Reason string
+}
+
+func (err AssertionErr) Error() string {
+	return fmt.Sprintf("assertion failed: %s", err.Reason)
+}
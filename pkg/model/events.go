@@ -7,4 +7,29 @@ type Event struct {
 	Workflow string
 	Name     string
 	Duration time.Duration
+
+	// Wait is the time spent waiting for a connection from the pool,
+	// which isn't included in Duration.
+	Wait time.Duration
+
+	// Node is the name of the node that served the operation, if
+	// statements are being balanced across nodes.
+	Node string
+
+	// Connection is the name of the connection the operation was run
+	// against, if the workflow targets one.
+	Connection string
+
+	// Stale is true if the operation was a historical read, run AS OF
+	// SYSTEM TIME.
+	Stale bool
+
+	// Err is the error the operation failed with, if any. Operations
+	// whose results didn't match their activity's expectations fail
+	// with an AssertionErr.
+	Err error
+
+	// Control describes a change made to the run through the control
+	// API, if the event records one rather than an operation.
+	Control string
 }
@@ -0,0 +1,273 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"gopkg.in/yaml.v3"
+)
+
+// Expect describes the results an activity is expected to return. Each
+// execution whose results don't match is reported as an AssertionErr.
+type Expect struct {
+	// Number of rows returned by a query activity.
+	Rows *Count `yaml:"rows"`
+
+	// Columns every row returned by a query activity must have.
+	Columns []string `yaml:"columns"`
+
+	// Columns that must be non-null in every row returned by a query
+	// activity.
+	NotNull []string `yaml:"not_null"`
+
+	// Column values every row returned by a query activity must have.
+	Values []ExpectValue `yaml:"values"`
+
+	// Number of rows changed by an exec activity.
+	RowsAffected *Count `yaml:"rows_affected"`
+}
+
+// ExpectValue asserts that a column is equal to either one of the
+// activity's args, referenced by name or index, or a constant value.
+type ExpectValue struct {
+	Column string `yaml:"column"`
+	Arg    string `yaml:"arg"`
+	Value  any    `yaml:"value"`
+
+	argIndex int
+}
+
+// Count is an inclusive range of counts, provided either as an exact
+// number or as a mapping with optional min and max fields.
+type Count struct {
+	Min int64
+	Max int64
+}
+
+func (c *Count) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var n int64
+		if err := node.Decode(&n); err != nil {
+			return fmt.Errorf("parsing count: %w", err)
+		}
+
+		*c = Count{Min: n, Max: n}
+		return nil
+	}
+
+	if err := checkKeys(node, "min", "max"); err != nil {
+		return err
+	}
+
+	var raw struct {
+		Min *int64 `yaml:"min"`
+		Max *int64 `yaml:"max"`
+	}
+	if err := node.Decode(&raw); err != nil {
+		return fmt.Errorf("parsing count: %w", err)
+	}
+
+	*c = Count{Min: 0, Max: math.MaxInt64}
+	if raw.Min != nil {
+		c.Min = *raw.Min
+	}
+	if raw.Max != nil {
+		c.Max = *raw.Max
+	}
+
+	if c.Min > c.Max {
+		return fmt.Errorf("min %d is greater than max %d", c.Min, c.Max)
+	}
+
+	return nil
+}
+
+func (c Count) contains(n int64) bool {
+	return n >= c.Min && n <= c.Max
+}
+
+func (c Count) String() string {
+	switch {
+	case c.Min == c.Max:
+		return strconv.FormatInt(c.Min, 10)
+	case c.Max == math.MaxInt64:
+		return fmt.Sprintf("at least %d", c.Min)
+	default:
+		return fmt.Sprintf("between %d and %d", c.Min, c.Max)
+	}
+}
+
+// prepare checks the assertions are valid for an activity and resolves
+// the args its values reference.
+func (e Expect) prepare(q Query) error {
+	if q.Type == "exec" && (e.Rows != nil || len(e.Columns) > 0 || len(e.NotNull) > 0 || len(e.Values) > 0) {
+		return fmt.Errorf("exec activities only support rows_affected")
+	}
+	if q.Type == "query" && e.RowsAffected != nil {
+		return fmt.Errorf("rows_affected is only supported by exec activities")
+	}
+
+	for i, v := range e.Values {
+		if v.Column == "" {
+			return fmt.Errorf("missing column for value %d", i)
+		}
+
+		if v.Arg == "" {
+			if v.Value == nil {
+				return fmt.Errorf("missing arg or value for %q, use not_null to check for non-null values", v.Column)
+			}
+			continue
+		}
+
+		index, err := argIndex(q.Args, v.Arg)
+		if err != nil {
+			return fmt.Errorf("parsing value for %q: %w", v.Column, err)
+		}
+		e.Values[i].argIndex = index
+	}
+
+	return nil
+}
+
+// argIndex returns the index of the arg with the given name or, if none
+// is named, the arg at the given index.
+func argIndex(args []Arg, ref string) (int, error) {
+	for i, arg := range args {
+		if arg.Name == ref {
+			return i, nil
+		}
+	}
+
+	index, err := strconv.Atoi(ref)
+	if err != nil || index < 0 || index >= len(args) {
+		return 0, fmt.Errorf("missing arg: %q", ref)
+	}
+
+	return index, nil
+}
+
+// check returns an AssertionErr if the results of a statement don't
+// match the expectations. Args are the values generated for the
+// activity's args, in the order they're declared.
+func (e Expect) check(data []map[string]any, stats repo.Stats, args []any) error {
+	if e.Rows != nil && !e.Rows.contains(int64(len(data))) {
+		return AssertionErr{Reason: fmt.Sprintf("expected %s rows, got %d", e.Rows, len(data))}
+	}
+
+	if e.RowsAffected != nil && !e.RowsAffected.contains(stats.RowsAffected) {
+		return AssertionErr{Reason: fmt.Sprintf("expected %s rows affected, got %d", e.RowsAffected, stats.RowsAffected)}
+	}
+
+	for i, row := range data {
+		for _, col := range e.Columns {
+			if _, ok := row[col]; !ok {
+				return AssertionErr{Reason: fmt.Sprintf("row %d: missing column %q", i, col)}
+			}
+		}
+
+		for _, col := range e.NotNull {
+			if v, ok := row[col]; !ok || v == nil {
+				return AssertionErr{Reason: fmt.Sprintf("row %d: column %q is null", i, col)}
+			}
+		}
+
+		for _, v := range e.Values {
+			exp := v.Value
+			if v.Arg != "" {
+				exp = args[v.argIndex]
+			}
+
+			act, ok := row[v.Column]
+			if !ok {
+				return AssertionErr{Reason: fmt.Sprintf("row %d: missing column %q", i, v.Column)}
+			}
+
+			if !valuesEqual(exp, act) {
+				return AssertionErr{Reason: fmt.Sprintf("row %d: expected %q to be %v, got %v", i, v.Column, exp, act)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// valuesEqual compares an expected value against one returned by the
+// database. As drivers return values as a variety of types, they're
+// normalised first, then compared as numbers or timestamps if both can
+// be read as one, and by their string representation otherwise.
+func valuesEqual(exp, act any) bool {
+	exp, act = normaliseValue(exp), normaliseValue(act)
+
+	if exp == nil || act == nil {
+		return exp == nil && act == nil
+	}
+
+	if e, ok := numberValue(exp); ok {
+		if a, ok := numberValue(act); ok {
+			return e.Cmp(a) == 0
+		}
+	}
+
+	if e, ok := timeValue(exp); ok {
+		if a, ok := timeValue(act); ok {
+			return e.Equal(a)
+		}
+	}
+
+	return fmt.Sprint(exp) == fmt.Sprint(act)
+}
+
+// normaliseValue converts driver-specific types into the basic types
+// they represent, e.g. pgx's [16]byte UUIDs into their string form and
+// pgtype values into their driver.Value.
+func normaliseValue(v any) any {
+	switch t := v.(type) {
+	case []byte:
+		return string(t)
+
+	case [16]byte:
+		return fmt.Sprintf("%x-%x-%x-%x-%x", t[0:4], t[4:6], t[6:8], t[8:10], t[10:16])
+
+	case driver.Valuer:
+		dv, err := t.Value()
+		if err != nil {
+			return v
+		}
+		if _, ok := dv.(driver.Valuer); ok {
+			return dv
+		}
+		return normaliseValue(dv)
+	}
+
+	return v
+}
+
+// numberValue returns a value as an exact number, if it's numeric or a
+// string holding a number (as returned for DECIMAL columns).
+func numberValue(v any) (*big.Rat, bool) {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, string:
+		return new(big.Rat).SetString(fmt.Sprint(v))
+	}
+
+	return nil, false
+}
+
+// timeValue returns a value as a time, if it's a time or an RFC3339
+// timestamp.
+func timeValue(v any) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		return parsed, err == nil
+	}
+
+	return time.Time{}, false
+}
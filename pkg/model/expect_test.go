@@ -0,0 +1,254 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCountUnmarshalYAML(t *testing.T) {
+	cases := []struct {
+		name   string
+		yaml   string
+		exp    Count
+		expErr error
+	}{
+		{
+			name: "exact",
+			yaml: `1`,
+			exp:  Count{Min: 1, Max: 1},
+		},
+		{
+			name: "range",
+			yaml: `{min: 1, max: 10}`,
+			exp:  Count{Min: 1, Max: 10},
+		},
+		{
+			name: "min only",
+			yaml: `{min: 1}`,
+			exp:  Count{Min: 1, Max: math.MaxInt64},
+		},
+		{
+			name: "max only",
+			yaml: `{max: 10}`,
+			exp:  Count{Min: 0, Max: 10},
+		},
+		{
+			name:   "min greater than max",
+			yaml:   `{min: 10, max: 1}`,
+			expErr: errors.New("min 10 is greater than max 1"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var act Count
+			err := yaml.Unmarshal([]byte(c.yaml), &act)
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr.Error(), err.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestExpectPrepare(t *testing.T) {
+	cases := []struct {
+		name        string
+		query       Query
+		expArgIndex []int
+		expErr      error
+	}{
+		{
+			name: "named arg",
+			query: Query{
+				Type:   "query",
+				Args:   []Arg{{Name: "a"}, {Name: "b"}},
+				Expect: Expect{Values: []ExpectValue{{Column: "b", Arg: "b"}}},
+			},
+			expArgIndex: []int{1},
+		},
+		{
+			name: "positional arg",
+			query: Query{
+				Type:   "query",
+				Args:   []Arg{{}, {}},
+				Expect: Expect{Values: []ExpectValue{{Column: "b", Arg: "1"}, {Column: "c", Value: "c"}}},
+			},
+			expArgIndex: []int{1, 0},
+		},
+		{
+			name: "missing arg",
+			query: Query{
+				Type:   "query",
+				Args:   []Arg{{}},
+				Expect: Expect{Values: []ExpectValue{{Column: "b", Arg: "1"}}},
+			},
+			expErr: errors.New(`parsing value for "b": missing arg: "1"`),
+		},
+		{
+			name: "missing column",
+			query: Query{
+				Type:   "query",
+				Expect: Expect{Values: []ExpectValue{{Value: 1}}},
+			},
+			expErr: errors.New("missing column for value 0"),
+		},
+		{
+			name: "missing arg and value",
+			query: Query{
+				Type:   "query",
+				Expect: Expect{Values: []ExpectValue{{Column: "deleted_at"}}},
+			},
+			expErr: errors.New(`missing arg or value for "deleted_at", use not_null to check for non-null values`),
+		},
+		{
+			name: "rows on exec",
+			query: Query{
+				Type:   "exec",
+				Expect: Expect{Rows: &Count{}},
+			},
+			expErr: errors.New("exec activities only support rows_affected"),
+		},
+		{
+			name: "rows affected on query",
+			query: Query{
+				Type:   "query",
+				Expect: Expect{RowsAffected: &Count{}},
+			},
+			expErr: errors.New("rows_affected is only supported by exec activities"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.query.Expect.prepare(c.query)
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr.Error(), err.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+			for i, exp := range c.expArgIndex {
+				assert.Equal(t, exp, c.query.Expect.Values[i].argIndex)
+			}
+		})
+	}
+}
+
+func TestExpectCheck(t *testing.T) {
+	cases := []struct {
+		name   string
+		expect Expect
+		data   []map[string]any
+		stats  repo.Stats
+		args   []any
+		expErr error
+	}{
+		{
+			name:   "no expectations",
+			expect: Expect{},
+			data:   []map[string]any{{"id": 1}},
+		},
+		{
+			name:   "rows in range",
+			expect: Expect{Rows: &Count{Min: 1, Max: 2}},
+			data:   []map[string]any{{"id": 1}, {"id": 2}},
+		},
+		{
+			name:   "rows out of range",
+			expect: Expect{Rows: &Count{Min: 1, Max: 2}},
+			data:   []map[string]any{{"id": 1}, {"id": 2}, {"id": 3}},
+			expErr: AssertionErr{Reason: "expected between 1 and 2 rows, got 3"},
+		},
+		{
+			name:   "rows below minimum",
+			expect: Expect{Rows: &Count{Min: 1, Max: math.MaxInt64}},
+			expErr: AssertionErr{Reason: "expected at least 1 rows, got 0"},
+		},
+		{
+			name:   "rows affected",
+			expect: Expect{RowsAffected: &Count{Min: 1, Max: 1}},
+			stats:  repo.Stats{RowsAffected: 1},
+		},
+		{
+			name:   "missing column",
+			expect: Expect{Columns: []string{"id", "name"}},
+			data:   []map[string]any{{"id": 1}},
+			expErr: AssertionErr{Reason: `row 0: missing column "name"`},
+		},
+		{
+			name:   "null column",
+			expect: Expect{NotNull: []string{"name"}},
+			data:   []map[string]any{{"name": "a"}, {"name": nil}},
+			expErr: AssertionErr{Reason: `row 1: column "name" is null`},
+		},
+		{
+			name:   "value matches constant",
+			expect: Expect{Values: []ExpectValue{{Column: "status", Value: "pending"}}},
+			data:   []map[string]any{{"status": []byte("pending")}},
+		},
+		{
+			name:   "value matches arg",
+			expect: Expect{Values: []ExpectValue{{Column: "id", Arg: "id", argIndex: 1}}},
+			data:   []map[string]any{{"id": int64(2)}},
+			args:   []any{"a", 2},
+		},
+		{
+			name:   "value doesn't match",
+			expect: Expect{Values: []ExpectValue{{Column: "status", Value: "pending"}}},
+			data:   []map[string]any{{"status": "shipped"}},
+			expErr: AssertionErr{Reason: `row 0: expected "status" to be pending, got shipped`},
+		},
+		{
+			name:   "null value",
+			expect: Expect{Values: []ExpectValue{{Column: "status", Value: "pending"}}},
+			data:   []map[string]any{{"status": nil}},
+			expErr: AssertionErr{Reason: `row 0: expected "status" to be pending, got <nil>`},
+		},
+		{
+			name:   "uuid matches arg",
+			expect: Expect{Values: []ExpectValue{{Column: "id", Arg: "id"}}},
+			data:   []map[string]any{{"id": [16]byte{0x6b, 0xa7, 0xb8, 0x10, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}}},
+			args:   []any{"6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+		},
+		{
+			name:   "numeric matches constant",
+			expect: Expect{Values: []ExpectValue{{Column: "price", Value: 12.5}}},
+			data:   []map[string]any{{"price": pgtype.Numeric{Int: big.NewInt(1250), Exp: -2, Valid: true}}},
+		},
+		{
+			name:   "decimal string matches constant",
+			expect: Expect{Values: []ExpectValue{{Column: "price", Value: 12.5}}},
+			data:   []map[string]any{{"price": []byte("12.50")}},
+		},
+		{
+			name:   "large ints are compared exactly",
+			expect: Expect{Values: []ExpectValue{{Column: "id", Value: int64(9007199254740993)}}},
+			data:   []map[string]any{{"id": int64(9007199254740992)}},
+			expErr: AssertionErr{Reason: `row 0: expected "id" to be 9007199254740993, got 9007199254740992`},
+		},
+		{
+			name:   "timestamp matches constant",
+			expect: Expect{Values: []ExpectValue{{Column: "ts", Value: "2024-01-01T00:00:00Z"}}},
+			data:   []map[string]any{{"ts": time.Date(2024, 1, 1, 1, 0, 0, 0, time.FixedZone("CET", 3600))}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.expect.check(c.data, c.stats, c.args)
+			assert.Equal(t, c.expErr, err)
+		})
+	}
+}
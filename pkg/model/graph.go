@@ -0,0 +1,324 @@
+package model
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// Dependency is an activity's need for data produced by another, either
+// the rows of a query it refs or a var the other captures.
+type Dependency struct {
+	// Activity that depends on the data.
+	Activity string
+
+	// On is the activity that produces the data, or empty if nothing in
+	// the workflow does.
+	On string
+
+	// Kind is "ref" or "var", and Via the column or var name read.
+	Kind string
+	Via  string
+}
+
+// WorkflowGraph is the dependency graph of a workflow's activities.
+type WorkflowGraph struct {
+	Workflow     string
+	SetupQueries []string
+	Queries      []string
+	Dependencies []Dependency
+
+	// Blocked maps each activity whose dependencies can never be met to
+	// the reason why. Workflow queries that are blocked are skipped on
+	// every tick, and setup queries that are blocked fail their VU.
+	Blocked map[string]string
+}
+
+// Graph returns the dependency graph of each workflow's activities,
+// ordered by workflow name.
+func (d *Drk) Graph() []WorkflowGraph {
+	names := lo.Keys(d.Workflows)
+	sort.Strings(names)
+
+	return lo.Map(names, func(name string, _ int) WorkflowGraph {
+		return d.workflowGraph(name, d.Workflows[name])
+	})
+}
+
+func (d *Drk) workflowGraph(name string, workflow Workflow) WorkflowGraph {
+	g := WorkflowGraph{
+		Workflow:     name,
+		SetupQueries: lo.Uniq(workflow.SetupQueries),
+		Queries: lo.Uniq(lo.Map(workflow.Queries, func(q WorkflowQuery, _ int) string {
+			return q.Name
+		})),
+		Blocked: map[string]string{},
+	}
+
+	// Activities that capture each var.
+	captures := map[string][]string{}
+	for _, act := range g.activities() {
+		for varName := range d.Activities[act].Capture {
+			captures[varName] = append(captures[varName], act)
+		}
+	}
+	for varName := range captures {
+		sort.Strings(captures[varName])
+	}
+
+	for _, act := range g.activities() {
+		for _, arg := range d.Activities[act].Args {
+			switch arg.Type {
+			case "ref":
+				g.Dependencies = append(g.Dependencies, Dependency{Activity: act, On: arg.refQuery, Kind: "ref", Via: arg.refColumn})
+
+			case "var":
+				if _, ok := workflow.Vars[arg.varName]; ok {
+					continue
+				}
+				providers := captures[arg.varName]
+				if len(providers) == 0 {
+					g.Dependencies = append(g.Dependencies, Dependency{Activity: act, Kind: "var", Via: arg.varName})
+				}
+				for _, p := range providers {
+					g.Dependencies = append(g.Dependencies, Dependency{Activity: act, On: p, Kind: "var", Via: arg.varName})
+				}
+			}
+		}
+	}
+
+	// Setup queries run once, in order, so can only use the data of
+	// those before them.
+	var ran []string
+	for _, act := range g.SetupQueries {
+		if reason, ok := d.unmet(g, act, ran, workflow); !ok {
+			g.Blocked[act] = reason
+		}
+		ran = append(ran, act)
+	}
+
+	// Workflow queries run once their dependencies have produced data,
+	// so find those that ever can, adding them until none are left.
+	runnable := append([]string{}, g.SetupQueries...)
+	pending := append([]string{}, g.Queries...)
+	for {
+		var next []string
+		for _, act := range pending {
+			if _, ok := d.unmet(g, act, runnable, workflow); ok {
+				runnable = append(runnable, act)
+				continue
+			}
+			next = append(next, act)
+		}
+
+		if len(next) == len(pending) {
+			break
+		}
+		pending = next
+	}
+
+	for _, act := range pending {
+		if cycle := g.cycle(act, pending); len(cycle) > 0 {
+			g.Blocked[act] = fmt.Sprintf("dependency cycle: %s", strings.Join(cycle, " -> "))
+			continue
+		}
+
+		reason, _ := d.unmet(g, act, runnable, workflow)
+		g.Blocked[act] = reason
+	}
+
+	return g
+}
+
+// unmet returns the reason an activity's dependencies aren't met by the
+// given activities having run, or false if they are.
+func (d *Drk) unmet(g WorkflowGraph, act string, ran []string, workflow Workflow) (string, bool) {
+	if _, ok := d.Activities[act]; !ok {
+		return fmt.Sprintf("missing activity: %q", act), false
+	}
+
+	inWorkflow := g.activities()
+
+	for _, arg := range d.Activities[act].Args {
+		switch arg.Type {
+		case "ref":
+			ref, ok := d.Activities[arg.refQuery]
+			switch {
+			case !ok:
+				return fmt.Sprintf("refs missing activity: %q", arg.refQuery), false
+			case ref.Type != "query":
+				return fmt.Sprintf("refs %q, which returns no rows", arg.refQuery), false
+			case !lo.Contains(inWorkflow, arg.refQuery):
+				return fmt.Sprintf("refs %q, which the workflow doesn't run", arg.refQuery), false
+			case !lo.Contains(ran, arg.refQuery):
+				return fmt.Sprintf("refs %q, which never runs before it", arg.refQuery), false
+			}
+
+		case "var":
+			if _, ok := workflow.Vars[arg.varName]; ok {
+				continue
+			}
+
+			providers := lo.Filter(g.Dependencies, func(dep Dependency, _ int) bool {
+				return dep.Activity == act && dep.Kind == "var" && dep.Via == arg.varName && dep.On != ""
+			})
+			if len(providers) == 0 {
+				return fmt.Sprintf("reads var %q, which isn't defined or captured", arg.varName), false
+			}
+			if !lo.SomeBy(providers, func(dep Dependency) bool { return lo.Contains(ran, dep.On) }) {
+				return fmt.Sprintf("reads var %q, which is never captured before it", arg.varName), false
+			}
+		}
+	}
+
+	return "", true
+}
+
+// cycle returns a path of dependencies among the given activities that
+// leads from an activity back to itself, or nil if there isn't one.
+func (g WorkflowGraph) cycle(act string, among []string) []string {
+	visited := map[string]bool{}
+
+	var walk func(path []string) []string
+	walk = func(path []string) []string {
+		from := path[len(path)-1]
+		for _, dep := range g.Dependencies {
+			if dep.Activity != from || !lo.Contains(among, dep.On) {
+				continue
+			}
+			if dep.On == act {
+				return append(path, act)
+			}
+			if visited[dep.On] {
+				continue
+			}
+			visited[dep.On] = true
+
+			if cycle := walk(append(path[:len(path):len(path)], dep.On)); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+
+	return walk([]string{act})
+}
+
+// WriteDOT writes the dependency graphs in Graphviz DOT format, with an
+// edge from each activity to those that use its data.
+func WriteDOT(w io.Writer, graphs []WorkflowGraph) error {
+	var b strings.Builder
+
+	b.WriteString("digraph drk {\n")
+	b.WriteString("  rankdir=LR;\n")
+
+	for _, g := range graphs {
+		id := func(act string) string {
+			return fmt.Sprintf("%q", g.Workflow+"."+act)
+		}
+
+		fmt.Fprintf(&b, "\n  subgraph %q {\n", "cluster_"+g.Workflow)
+		fmt.Fprintf(&b, "    label=%q;\n", g.Workflow)
+
+		for _, act := range g.nodes() {
+			attrs := []string{fmt.Sprintf("label=%q", act)}
+			if lo.Contains(g.SetupQueries, act) {
+				attrs = append(attrs, "shape=box")
+			}
+			if !lo.Contains(g.SetupQueries, act) && !lo.Contains(g.Queries, act) {
+				attrs = append(attrs, "style=dashed")
+			}
+			if _, ok := g.Blocked[act]; ok {
+				attrs = append(attrs, "color=red")
+			}
+			fmt.Fprintf(&b, "    %s [%s];\n", id(act), strings.Join(attrs, ", "))
+		}
+
+		for _, dep := range g.Dependencies {
+			if dep.On == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "    %s -> %s [label=%q];\n", id(dep.On), id(dep.Activity), dep.Kind+" "+dep.Via)
+		}
+
+		b.WriteString("  }\n")
+	}
+
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var mermaidIDReplacer = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// WriteMermaid writes the dependency graphs as a Mermaid flowchart, with
+// an edge from each activity to those that use its data.
+func WriteMermaid(w io.Writer, graphs []WorkflowGraph) error {
+	var b strings.Builder
+
+	b.WriteString("flowchart LR\n")
+
+	var blocked []string
+	for _, g := range graphs {
+		id := func(act string) string {
+			return mermaidIDReplacer.ReplaceAllString(g.Workflow+"__"+act, "_")
+		}
+
+		fmt.Fprintf(&b, "  subgraph %s [%q]\n", mermaidIDReplacer.ReplaceAllString(g.Workflow, "_"), g.Workflow)
+
+		for _, act := range g.nodes() {
+			switch {
+			case lo.Contains(g.SetupQueries, act):
+				fmt.Fprintf(&b, "    %s[[%q]]\n", id(act), act)
+			case lo.Contains(g.Queries, act):
+				fmt.Fprintf(&b, "    %s[%q]\n", id(act), act)
+			default:
+				fmt.Fprintf(&b, "    %s(%q)\n", id(act), act)
+			}
+
+			if _, ok := g.Blocked[act]; ok {
+				blocked = append(blocked, id(act))
+			}
+		}
+
+		for _, dep := range g.Dependencies {
+			if dep.On == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "    %s -->|%q| %s\n", id(dep.On), dep.Kind+" "+dep.Via, id(dep.Activity))
+		}
+
+		b.WriteString("  end\n")
+	}
+
+	if len(blocked) > 0 {
+		b.WriteString("  classDef blocked stroke:#f00,color:#f00\n")
+		fmt.Fprintf(&b, "  class %s blocked\n", strings.Join(blocked, ","))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// activities returns the activities a workflow runs.
+func (g WorkflowGraph) activities() []string {
+	return lo.Uniq(append(append([]string{}, g.SetupQueries...), g.Queries...))
+}
+
+// nodes returns the activities in a graph: those the workflow runs,
+// followed by any others their dependencies reference.
+func (g WorkflowGraph) nodes() []string {
+	nodes := g.activities()
+	for _, dep := range g.Dependencies {
+		if dep.On != "" && !lo.Contains(nodes, dep.On) {
+			nodes = append(nodes, dep.On)
+		}
+	}
+
+	return nodes
+}
@@ -0,0 +1,244 @@
+package model
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+const graphActivities = `
+activities:
+  fetch_products:
+    type: query
+    query: SELECT id FROM product
+  browse:
+    type: query
+    args:
+      - type: ref
+        query: fetch_products
+        column: id
+    query: SELECT id FROM product WHERE id = $1
+  purchase:
+    type: query
+    args:
+      - type: ref
+        query: browse
+        column: id
+    capture:
+      order_id: id
+    query: INSERT INTO purchase (product_id) VALUES ($1) RETURNING id
+  check:
+    type: query
+    args:
+      - type: var
+        value: order_id
+    query: SELECT * FROM purchase WHERE id = $1
+  ping:
+    type: exec
+    query: SELECT 1
+  ping_ref:
+    type: query
+    args:
+      - type: ref
+        query: ping
+        column: id
+    query: SELECT $1
+  ping_pong:
+    type: query
+    args:
+      - type: ref
+        query: pong_ping
+        column: id
+    query: SELECT $1 AS id
+  pong_ping:
+    type: query
+    args:
+      - type: ref
+        query: ping_pong
+        column: id
+    query: SELECT $1 AS id
+`
+
+func TestGraph(t *testing.T) {
+	cases := []struct {
+		name       string
+		workflow   string
+		expDeps    []Dependency
+		expBlocked map[string]string
+	}{
+		{
+			name: "chain",
+			workflow: `
+    setup_queries: [fetch_products]
+    queries:
+      - name: check
+        rate: 1/1s
+      - name: purchase
+        rate: 1/1s
+      - name: browse
+        rate: 1/1s`,
+			expDeps: []Dependency{
+				{Activity: "check", On: "purchase", Kind: "var", Via: "order_id"},
+				{Activity: "purchase", On: "browse", Kind: "ref", Via: "id"},
+				{Activity: "browse", On: "fetch_products", Kind: "ref", Via: "id"},
+			},
+			expBlocked: map[string]string{},
+		},
+		{
+			name: "transitively unsatisfiable",
+			workflow: `
+    queries:
+      - name: browse
+        rate: 1/1s
+      - name: purchase
+        rate: 1/1s`,
+			expDeps: []Dependency{
+				{Activity: "browse", On: "fetch_products", Kind: "ref", Via: "id"},
+				{Activity: "purchase", On: "browse", Kind: "ref", Via: "id"},
+			},
+			expBlocked: map[string]string{
+				"browse":   `refs "fetch_products", which the workflow doesn't run`,
+				"purchase": `refs "browse", which never runs before it`,
+			},
+		},
+		{
+			name: "undefined var",
+			workflow: `
+    queries:
+      - name: check
+        rate: 1/1s`,
+			expDeps: []Dependency{
+				{Activity: "check", Kind: "var", Via: "order_id"},
+			},
+			expBlocked: map[string]string{
+				"check": `reads var "order_id", which isn't defined or captured`,
+			},
+		},
+		{
+			name: "var defined by workflow",
+			workflow: `
+    vars:
+      order_id:
+        type: const
+        value: 1
+    queries:
+      - name: check
+        rate: 1/1s`,
+			expBlocked: map[string]string{},
+		},
+		{
+			name: "ref to exec",
+			workflow: `
+    queries:
+      - name: ping
+        rate: 1/1s
+      - name: ping_ref
+        rate: 1/1s`,
+			expDeps: []Dependency{
+				{Activity: "ping_ref", On: "ping", Kind: "ref", Via: "id"},
+			},
+			expBlocked: map[string]string{
+				"ping_ref": `refs "ping", which returns no rows`,
+			},
+		},
+		{
+			name: "cycle",
+			workflow: `
+    queries:
+      - name: ping_pong
+        rate: 1/1s
+      - name: pong_ping
+        rate: 1/1s`,
+			expDeps: []Dependency{
+				{Activity: "ping_pong", On: "pong_ping", Kind: "ref", Via: "id"},
+				{Activity: "pong_ping", On: "ping_pong", Kind: "ref", Via: "id"},
+			},
+			expBlocked: map[string]string{
+				"ping_pong": "dependency cycle: ping_pong -> pong_ping -> ping_pong",
+				"pong_ping": "dependency cycle: pong_ping -> ping_pong -> pong_ping",
+			},
+		},
+		{
+			name: "setup query out of order",
+			workflow: `
+    setup_queries: [browse, fetch_products]`,
+			expDeps: []Dependency{
+				{Activity: "browse", On: "fetch_products", Kind: "ref", Via: "id"},
+			},
+			expBlocked: map[string]string{
+				"browse": `refs "fetch_products", which never runs before it`,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var cfg Drk
+			assert.NoError(t, yaml.Unmarshal([]byte(graphActivities+"\nworkflows:\n  w:"+c.workflow), &cfg))
+
+			graphs := cfg.Graph()
+			assert.Len(t, graphs, 1)
+
+			assert.Equal(t, "w", graphs[0].Workflow)
+			assert.Equal(t, c.expDeps, graphs[0].Dependencies)
+			assert.Equal(t, c.expBlocked, graphs[0].Blocked)
+		})
+	}
+}
+
+func TestWriteGraph(t *testing.T) {
+	graphs := []WorkflowGraph{
+		{
+			Workflow:     "shop",
+			SetupQueries: []string{"fetch_products"},
+			Queries:      []string{"browse", "purchase"},
+			Dependencies: []Dependency{
+				{Activity: "browse", On: "fetch_products", Kind: "ref", Via: "id"},
+				{Activity: "purchase", On: "missing", Kind: "ref", Via: "id"},
+			},
+			Blocked: map[string]string{
+				"purchase": `refs missing activity: "missing"`,
+			},
+		},
+	}
+
+	t.Run("dot", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, WriteDOT(&buf, graphs))
+
+		assert.Equal(t, `digraph drk {
+  rankdir=LR;
+
+  subgraph "cluster_shop" {
+    label="shop";
+    "shop.fetch_products" [label="fetch_products", shape=box];
+    "shop.browse" [label="browse"];
+    "shop.purchase" [label="purchase", color=red];
+    "shop.missing" [label="missing", style=dashed];
+    "shop.fetch_products" -> "shop.browse" [label="ref id"];
+    "shop.missing" -> "shop.purchase" [label="ref id"];
+  }
+}
+`, buf.String())
+	})
+
+	t.Run("mermaid", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, WriteMermaid(&buf, graphs))
+
+		assert.Equal(t, `flowchart LR
+  subgraph shop ["shop"]
+    shop__fetch_products[["fetch_products"]]
+    shop__browse["browse"]
+    shop__purchase["purchase"]
+    shop__missing("missing")
+    shop__fetch_products -->|"ref id"| shop__browse
+    shop__missing -->|"ref id"| shop__purchase
+  end
+  classDef blocked stroke:#f00,color:#f00
+  class shop__purchase blocked
+`, buf.String())
+	})
+}
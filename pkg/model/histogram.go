@@ -0,0 +1,224 @@
+package model
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// Latencies are recorded in log-linear buckets: each power of two
+// between 2^histogramMinExp and 2^histogramMaxExp nanoseconds (roughly
+// 1µs to 275s) is split into histogramSubBuckets equal buckets, giving
+// a relative error of around 3%. Bucket 0 holds anything lower and the
+// last bucket anything higher.
+const (
+	histogramSubBucketBits = 5
+	histogramSubBuckets    = 1 << histogramSubBucketBits
+	histogramMinExp        = 10
+	histogramMaxExp        = 38
+	histogramBuckets       = (histogramMaxExp-histogramMinExp)*histogramSubBuckets + 2
+)
+
+func histogramIndex(v int64) int {
+	if v < 1<<histogramMinExp {
+		return 0
+	}
+	if v >= 1<<histogramMaxExp {
+		return histogramBuckets - 1
+	}
+
+	exp := bits.Len64(uint64(v)) - 1
+	sub := int(v>>(exp-histogramSubBucketBits)) & (histogramSubBuckets - 1)
+
+	return 1 + (exp-histogramMinExp)*histogramSubBuckets + sub
+}
+
+// histogramBounds returns the lowest value in a bucket and the lowest
+// value in the next.
+func histogramBounds(i int) (int64, int64) {
+	switch i {
+	case 0:
+		return 0, 1 << histogramMinExp
+	case histogramBuckets - 1:
+		return 1 << histogramMaxExp, math.MaxInt64
+	}
+
+	exp := (i-1)/histogramSubBuckets + histogramMinExp
+	sub := int64((i - 1) % histogramSubBuckets)
+	width := int64(1) << (exp - histogramSubBucketBits)
+
+	low := (histogramSubBuckets + sub) * width
+	return low, low + width
+}
+
+// atomicHistogram is a latency histogram that can be recorded to and
+// read from concurrently without locking.
+type atomicHistogram struct {
+	counts [histogramBuckets]atomic.Int64
+	sum    atomic.Int64
+	min    atomic.Int64
+	max    atomic.Int64
+	count  atomic.Int64
+}
+
+func (h *atomicHistogram) record(d time.Duration) {
+	v := max(int64(d), 0)
+
+	h.counts[histogramIndex(v)].Add(1)
+	h.sum.Add(v)
+
+	// min is stored offset by one, so its zero value means unset.
+	for {
+		cur := h.min.Load()
+		if cur != 0 && cur-1 <= v {
+			break
+		}
+		if h.min.CompareAndSwap(cur, v+1) {
+			break
+		}
+	}
+
+	for {
+		cur := h.max.Load()
+		if cur >= v || h.max.CompareAndSwap(cur, v) {
+			break
+		}
+	}
+
+	// Incremented last, so a concurrent snapshot never sees a count
+	// that's ahead of the buckets.
+	h.count.Add(1)
+}
+
+func (h *atomicHistogram) snapshot() Histogram {
+	s := Histogram{counts: make([]int64, histogramBuckets)}
+
+	s.Count = h.count.Load()
+	for i := range h.counts {
+		s.counts[i] = h.counts[i].Load()
+	}
+	s.Sum = time.Duration(h.sum.Load())
+
+	if m := h.min.Load(); m > 0 {
+		s.Min = time.Duration(m - 1)
+	}
+	s.Max = time.Duration(h.max.Load())
+
+	return s
+}
+
+// Histogram is a point-in-time copy of recorded latencies.
+type Histogram struct {
+	Count int64
+	Sum   time.Duration
+	Min   time.Duration
+	Max   time.Duration
+
+	counts []int64
+}
+
+// Quantile returns the latency below which the given percentage of
+// values fall, using the nearest-rank method, to within the precision
+// of the histogram's buckets.
+func (h Histogram) Quantile(p float64) time.Duration {
+	if h.Count == 0 || len(h.counts) == 0 {
+		return 0
+	}
+
+	rank := int64(math.Ceil(p / 100 * float64(h.Count)))
+	rank = max(1, min(rank, h.Count))
+
+	// Recorded extremes are exact, so use them where they're known.
+	if h.Max > 0 {
+		switch rank {
+		case 1:
+			return h.Min
+		case h.Count:
+			return h.Max
+		}
+	}
+
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen < rank {
+			continue
+		}
+
+		low, high := histogramBounds(i)
+		v := time.Duration(low + (high-low)/2)
+		if i == histogramBuckets-1 {
+			v = time.Duration(low)
+		}
+
+		if h.Max > 0 {
+			v = min(max(v, h.Min), h.Max)
+		}
+		return v
+	}
+
+	return h.Max
+}
+
+// Mean returns the average of the recorded values.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// CountAtOrBelow returns the number of values no higher than d, to
+// within the precision of the histogram's buckets.
+func (h Histogram) CountAtOrBelow(d time.Duration) int64 {
+	var n int64
+	for i, c := range h.counts {
+		if _, high := histogramBounds(i); high-1 > int64(d) {
+			break
+		}
+		n += c
+	}
+
+	return n
+}
+
+// merge adds the values recorded in another histogram to this one.
+func (h *Histogram) merge(o Histogram) {
+	if o.Count == 0 {
+		return
+	}
+
+	if h.counts == nil {
+		h.counts = make([]int64, histogramBuckets)
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+
+	if h.Count == 0 || o.Min < h.Min {
+		h.Min = o.Min
+	}
+	h.Max = max(h.Max, o.Max)
+
+	h.Count += o.Count
+	h.Sum += o.Sum
+}
+
+// Sub returns the values recorded since an earlier snapshot of the same
+// histogram. The extremes of the difference aren't known, so are left
+// unset.
+func (h Histogram) Sub(prev Histogram) Histogram {
+	d := Histogram{
+		Count:  h.Count - prev.Count,
+		Sum:    h.Sum - prev.Sum,
+		counts: make([]int64, histogramBuckets),
+	}
+
+	copy(d.counts, h.counts)
+	for i, c := range prev.counts {
+		d.counts[i] -= c
+	}
+
+	return d
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newHistogram(values ...time.Duration) Histogram {
+	var h atomicHistogram
+	for _, v := range values {
+		h.record(v)
+	}
+
+	return h.snapshot()
+}
+
+func TestHistogramIndex(t *testing.T) {
+	for _, v := range []int64{0, 1, 1023, 1024, 1500, 999_999, 1_000_000, 123_456_789, 1 << 37, 1<<38 - 1, 1 << 38, 1 << 62} {
+		i := histogramIndex(v)
+		low, high := histogramBounds(i)
+
+		assert.GreaterOrEqual(t, v, low, "value %d", v)
+		assert.Less(t, v, high, "value %d", v)
+	}
+
+	// Buckets are contiguous.
+	for i := 1; i < histogramBuckets; i++ {
+		_, prevHigh := histogramBounds(i - 1)
+		low, _ := histogramBounds(i)
+		assert.Equal(t, prevHigh, low, "bucket %d", i)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	var values []time.Duration
+	for i := 1; i <= 1000; i++ {
+		values = append(values, time.Duration(i)*time.Millisecond)
+	}
+
+	h := newHistogram(values...)
+
+	cases := []struct {
+		p   float64
+		exp time.Duration
+	}{
+		{p: 0, exp: time.Millisecond},
+		{p: 50, exp: 500 * time.Millisecond},
+		{p: 90, exp: 900 * time.Millisecond},
+		{p: 99, exp: 990 * time.Millisecond},
+		{p: 100, exp: time.Second},
+	}
+
+	for _, c := range cases {
+		act := h.Quantile(c.p)
+		assert.InEpsilon(t, c.exp, act, 0.03, "p%v", c.p)
+	}
+
+	assert.Equal(t, int64(1000), h.Count)
+	assert.Equal(t, time.Millisecond, h.Min)
+	assert.Equal(t, time.Second, h.Max)
+	assert.Equal(t, 500500*time.Microsecond, h.Mean())
+}
+
+func TestHistogramMergeAndSub(t *testing.T) {
+	a := newHistogram(time.Millisecond, 2*time.Millisecond)
+	b := newHistogram(10 * time.Millisecond)
+
+	var merged Histogram
+	merged.merge(a)
+	merged.merge(b)
+
+	assert.Equal(t, int64(3), merged.Count)
+	assert.Equal(t, time.Millisecond, merged.Min)
+	assert.Equal(t, 10*time.Millisecond, merged.Max)
+	assert.Equal(t, 13*time.Millisecond, merged.Sum)
+
+	d := merged.Sub(a)
+	assert.Equal(t, int64(1), d.Count)
+	assert.Equal(t, 10*time.Millisecond, d.Sum)
+	assert.InEpsilon(t, 10*time.Millisecond, d.Quantile(50), 0.03)
+}
+
+func TestHistogramCountAtOrBelow(t *testing.T) {
+	h := newHistogram(time.Millisecond, 5*time.Millisecond, time.Second)
+
+	assert.Equal(t, int64(0), h.CountAtOrBelow(500*time.Microsecond))
+	assert.Equal(t, int64(1), h.CountAtOrBelow(2*time.Millisecond))
+	assert.Equal(t, int64(2), h.CountAtOrBelow(100*time.Millisecond))
+	assert.Equal(t, int64(3), h.CountAtOrBelow(2*time.Second))
+}
@@ -0,0 +1,176 @@
+package model
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	// ErrorClassConnection is the class of errors raised when a
+	// connection to the database couldn't be acquired.
+	ErrorClassConnection = "connection"
+
+	// ErrorClassStatement is the class of errors raised by statements
+	// that failed once connected.
+	ErrorClassStatement = "statement"
+
+	// ErrorClassAssertion is the class of errors raised when a
+	// statement's results didn't match its activity's expectations.
+	ErrorClassAssertion = "assertion"
+)
+
+// Metrics exposes the results of a run as Prometheus metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+}
+
+// RunStats is implemented by Runner and provides the point-in-time
+// results and state of a run.
+type RunStats interface {
+	Harvest() []QueryStats
+	ActiveVUs() map[string]int
+	PoolStats() map[string]map[string]repo.PoolStats
+}
+
+// NewMetrics returns Metrics that report the results, active VUs and
+// pool stats of the given run, harvested at the time of each scrape.
+func NewMetrics(run RunStats) *Metrics {
+	m := Metrics{
+		registry: prometheus.NewRegistry(),
+	}
+
+	m.registry.MustRegister(&runCollector{
+		run:     run,
+		buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+	})
+
+	return &m
+}
+
+// Handler returns an HTTP handler that serves the metrics in the
+// Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func errorClass(err error) string {
+	var assertionErr AssertionErr
+	if errors.As(err, &assertionErr) {
+		return ErrorClassAssertion
+	}
+
+	var connErr repo.ConnErr
+	if errors.As(err, &connErr) {
+		return ErrorClassConnection
+	}
+
+	return ErrorClassStatement
+}
+
+var (
+	requestsDesc = prometheus.NewDesc(
+		"drk_requests_total",
+		"Number of times each query was run, including failures.",
+		[]string{"workflow", "query"}, nil,
+	)
+
+	errorsDesc = prometheus.NewDesc(
+		"drk_errors_total",
+		"Number of times each query failed, by class of error.",
+		[]string{"workflow", "query", "class"}, nil,
+	)
+
+	latencyDesc = prometheus.NewDesc(
+		"drk_query_duration_seconds",
+		"Time taken to run each query, excluding time spent waiting for a connection. Historical reads, run AS OF SYSTEM TIME, are labelled stale.",
+		[]string{"workflow", "query", "stale"}, nil,
+	)
+
+	poolWaitDesc = prometheus.NewDesc(
+		"drk_pool_wait_seconds",
+		"Time spent waiting for a connection from the pool to run each query.",
+		[]string{"workflow", "query"}, nil,
+	)
+
+	activeVUsDesc = prometheus.NewDesc(
+		"drk_active_vus",
+		"Number of VUs running each workflow's activities.",
+		[]string{"workflow"}, nil,
+	)
+
+	poolConnsDesc = prometheus.NewDesc(
+		"drk_pool_connections",
+		"Number of connections in each pool, by state.",
+		[]string{"connection", "node", "state"}, nil,
+	)
+
+	poolMaxConnsDesc = prometheus.NewDesc(
+		"drk_pool_max_connections",
+		"Maximum number of connections in each pool.",
+		[]string{"connection", "node"}, nil,
+	)
+
+	poolWaitsDesc = prometheus.NewDesc(
+		"drk_pool_waits_total",
+		"Number of times a connection had to be waited for.",
+		[]string{"connection", "node"}, nil,
+	)
+)
+
+// runCollector reports stats read from a run at the time of each scrape.
+type runCollector struct {
+	run     RunStats
+	buckets []float64
+}
+
+func (c *runCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- requestsDesc
+	ch <- errorsDesc
+	ch <- latencyDesc
+	ch <- poolWaitDesc
+	ch <- activeVUsDesc
+	ch <- poolConnsDesc
+	ch <- poolMaxConnsDesc
+	ch <- poolWaitsDesc
+}
+
+func (c *runCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, qs := range withoutSetup(c.run.Harvest()) {
+		labels := []string{qs.Workflow, qs.Name}
+
+		ch <- prometheus.MustNewConstMetric(requestsDesc, prometheus.CounterValue, float64(qs.Count), labels...)
+		ch <- prometheus.MustNewConstMetric(errorsDesc, prometheus.CounterValue, float64(qs.ConnectionErrors), qs.Workflow, qs.Name, ErrorClassConnection)
+		ch <- prometheus.MustNewConstMetric(errorsDesc, prometheus.CounterValue, float64(qs.Errors-qs.ConnectionErrors), qs.Workflow, qs.Name, ErrorClassStatement)
+		ch <- prometheus.MustNewConstMetric(errorsDesc, prometheus.CounterValue, float64(qs.AssertionFailures), qs.Workflow, qs.Name, ErrorClassAssertion)
+		ch <- c.histogram(latencyDesc, qs.Latency, []string{qs.Workflow, qs.Name, strconv.FormatBool(qs.Stale)})
+		ch <- c.histogram(poolWaitDesc, qs.Wait, labels)
+	}
+
+	for workflow, n := range c.run.ActiveVUs() {
+		ch <- prometheus.MustNewConstMetric(activeVUsDesc, prometheus.GaugeValue, float64(n), workflow)
+	}
+
+	for conn, nodes := range c.run.PoolStats() {
+		for node, s := range nodes {
+			ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(s.InUse), conn, node, "in_use")
+			ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(s.Idle), conn, node, "idle")
+			ch <- prometheus.MustNewConstMetric(poolMaxConnsDesc, prometheus.GaugeValue, float64(s.MaxConns), conn, node)
+			ch <- prometheus.MustNewConstMetric(poolWaitsDesc, prometheus.CounterValue, float64(s.WaitCount), conn, node)
+		}
+	}
+}
+
+func (c *runCollector) histogram(desc *prometheus.Desc, h Histogram, labels []string) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(c.buckets))
+	for _, b := range c.buckets {
+		buckets[b] = uint64(h.CountAtOrBelow(time.Duration(b * float64(time.Second))))
+	}
+
+	return prometheus.MustNewConstHistogram(desc, uint64(h.Count), h.Sum.Seconds(), buckets, labels...)
+}
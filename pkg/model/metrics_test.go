@@ -0,0 +1,79 @@
+package model
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockRunStats struct {
+	runner *Runner
+}
+
+func (m mockRunStats) Harvest() []QueryStats {
+	return m.runner.Harvest()
+}
+
+func (mockRunStats) ActiveVUs() map[string]int {
+	return map[string]int{"shop": 2}
+}
+
+func (mockRunStats) PoolStats() map[string]map[string]repo.PoolStats {
+	return map[string]map[string]repo.PoolStats{
+		"default": {"": {MaxConns: 10, InUse: 3, Idle: 7, WaitCount: 5}},
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var r Runner
+	m := NewMetrics(mockRunStats{runner: &r})
+
+	setup := r.newAggregator("*shop", "setup", Query{})
+	browse := r.newAggregator("shop", "browse", Query{})
+	history := r.newAggregator("shop", "history", Query{AsOf: "-10s"})
+
+	setup.record(repo.Stats{Query: time.Millisecond}, nil)
+	browse.record(repo.Stats{Query: time.Millisecond, Wait: time.Millisecond}, nil)
+	browse.record(repo.Stats{}, repo.ConnErr{Err: errors.New("connection refused")})
+	browse.record(repo.Stats{}, errors.New("syntax error"))
+	browse.record(repo.Stats{Query: time.Millisecond}, AssertionErr{})
+	history.record(repo.Stats{Query: time.Second}, nil)
+
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	body := string(b)
+
+	for _, exp := range []string{
+		`drk_requests_total{query="browse",workflow="shop"} 4`,
+		`drk_errors_total{class="connection",query="browse",workflow="shop"} 1`,
+		`drk_errors_total{class="statement",query="browse",workflow="shop"} 1`,
+		`drk_errors_total{class="assertion",query="browse",workflow="shop"} 1`,
+		`drk_query_duration_seconds_count{query="browse",stale="false",workflow="shop"} 2`,
+		`drk_query_duration_seconds_count{query="history",stale="true",workflow="shop"} 1`,
+		`drk_pool_wait_seconds_count{query="browse",workflow="shop"} 2`,
+		`drk_query_duration_seconds_bucket{query="browse",stale="false",workflow="shop",le="0.0005"} 0`,
+		`drk_query_duration_seconds_bucket{query="browse",stale="false",workflow="shop",le="0.002"} 2`,
+		`drk_active_vus{workflow="shop"} 2`,
+		`drk_pool_connections{connection="default",node="",state="in_use"} 3`,
+		`drk_pool_connections{connection="default",node="",state="idle"} 7`,
+		`drk_pool_max_connections{connection="default",node=""} 10`,
+		`drk_pool_waits_total{connection="default",node=""} 5`,
+	} {
+		assert.Contains(t, body, exp)
+	}
+
+	assert.NotContains(t, body, `query="setup"`)
+}
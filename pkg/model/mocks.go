@@ -1,18 +1,50 @@
 package model
 
 import (
-	"time"
+	"github.com/codingconcepts/drk/pkg/repo"
 )
 
 type mockQueryer struct {
-	query func(query string, args ...any) ([]map[string]any, time.Duration, error)
-	exec  func(query string, args ...any) (time.Duration, error)
+	query func(query string, args ...any) ([]map[string]any, repo.Stats, error)
+	exec  func(query string, args ...any) (repo.Stats, error)
 }
 
-func (m *mockQueryer) Query(query string, args ...any) ([]map[string]any, time.Duration, error) {
+func (m *mockQueryer) Query(query string, args ...any) ([]map[string]any, repo.Stats, error) {
 	return m.query(query, args...)
 }
 
-func (m *mockQueryer) Exec(query string, args ...any) (time.Duration, error) {
+func (m *mockQueryer) Exec(query string, args ...any) (repo.Stats, error) {
 	return m.exec(query, args...)
 }
+
+type mockSessioner struct {
+	mockQueryer
+	session func() (repo.Session, error)
+}
+
+func (m *mockSessioner) Session() (repo.Session, error) {
+	return m.session()
+}
+
+type mockSession struct {
+	mockQueryer
+	closed bool
+}
+
+func (m *mockSession) Locked(f func(repo.Queryer) error) error {
+	return f(&m.mockQueryer)
+}
+
+func (m *mockSession) Close() error {
+	m.closed = true
+	return nil
+}
+
+type mockPool struct {
+	mockQueryer
+	stats map[string]repo.PoolStats
+}
+
+func (m *mockPool) PoolStats() map[string]repo.PoolStats {
+	return m.stats
+}
@@ -2,12 +2,11 @@ package model
 
 import (
 	"fmt"
-	"math/rand/v2"
+	"math"
 	"strings"
 	"time"
 
 	"github.com/codingconcepts/drk/pkg/random"
-	"github.com/samber/lo"
 )
 
 func parseArgTypeGen(raw map[string]any) (genFunc, dependencyFunc, error) {
@@ -16,74 +15,78 @@ func parseArgTypeGen(raw map[string]any) (genFunc, dependencyFunc, error) {
 		return nil, nil, fmt.Errorf("parsing value: %w", err)
 	}
 
+	g, ok := random.Replacements[value]
+	if !ok {
+		return nil, nil, FieldValueErr{Name: "value", Err: fmt.Errorf("missing generator: %q", value)}
+	}
+
 	return func(vu *VU) (any, error) {
-		g, ok := random.Replacements[value]
-		if !ok {
-			return nil, fmt.Errorf("missing generator: %q", value)
-		}
-		return g(), nil
+		return g(vu.faker), nil
 	}, dependencyFuncNoop, nil
 }
 
+// parseArgTypeScalar parses and validates a scalar arg's range up front,
+// so that its generator only has to sample a value from it.
 func parseArgTypeScalar(argType string, raw map[string]any) (genFunc, dependencyFunc, error) {
-	return func(vu *VU) (any, error) {
-		switch strings.ToLower(argType) {
-		case "int":
-			min, max, err := parseMinMax[int](raw)
-			if err != nil {
-				return nil, err
-			}
+	switch strings.ToLower(argType) {
+	case "int":
+		min, max, err := parseMinMax[int](raw)
+		if err != nil {
+			return nil, nil, err
+		}
 
-			return Int(min, max), nil
+		return func(vu *VU) (any, error) {
+			return Int(vu.rng, min, max), nil
+		}, dependencyFuncNoop, nil
 
-		case "float":
-			min, max, err := parseMinMax[float64](raw)
-			if err != nil {
-				return nil, err
-			}
-
-			return Float(min, max), nil
+	case "float":
+		min, max, err := parseMinMax[float64](raw)
+		if err != nil {
+			return nil, nil, err
+		}
 
-		case "timestamp":
-			minStr, maxStr, err := parseMinMax[string](raw)
-			if err != nil {
-				return nil, err
-			}
+		return func(vu *VU) (any, error) {
+			return Float(vu.rng, min, max), nil
+		}, dependencyFuncNoop, nil
 
-			min, err := time.Parse(time.RFC3339, minStr)
-			if err != nil {
-				return nil, fmt.Errorf("parsing max as timestamp: %w", err)
-			}
+	case "timestamp":
+		min, err := parseTimestampField(raw, "min")
+		if err != nil {
+			return nil, nil, err
+		}
 
-			max, err := time.Parse(time.RFC3339, maxStr)
-			if err != nil {
-				return nil, fmt.Errorf("parsing max as timestamp: %w", err)
-			}
+		max, err := parseTimestampField(raw, "max")
+		if err != nil {
+			return nil, nil, err
+		}
 
-			return Timestamp(min, max), nil
+		return func(vu *VU) (any, error) {
+			return Timestamp(vu.rng, min, max), nil
+		}, dependencyFuncNoop, nil
 
-		case "interval", "duration":
-			minStr, maxStr, err := parseMinMax[string](raw)
-			if err != nil {
-				return nil, err
-			}
+	case "interval", "duration":
+		minStr, maxStr, err := parseMinMax[string](raw)
+		if err != nil {
+			return nil, nil, err
+		}
 
-			min, err := time.ParseDuration(minStr)
-			if err != nil {
-				return nil, fmt.Errorf("parsing min as duration: %w", err)
-			}
+		min, err := time.ParseDuration(minStr)
+		if err != nil {
+			return nil, nil, FieldValueErr{Name: "min", Err: fmt.Errorf("parsing min as duration: %w", err)}
+		}
 
-			max, err := time.ParseDuration(maxStr)
-			if err != nil {
-				return nil, fmt.Errorf("parsing max as duration: %w", err)
-			}
+		max, err := time.ParseDuration(maxStr)
+		if err != nil {
+			return nil, nil, FieldValueErr{Name: "max", Err: fmt.Errorf("parsing max as duration: %w", err)}
+		}
 
-			return Interval(min, max), nil
+		return func(vu *VU) (any, error) {
+			return Interval(vu.rng, min, max), nil
+		}, dependencyFuncNoop, nil
 
-		default:
-			return nil, fmt.Errorf("invalid scalar generator: %q", argType)
-		}
-	}, dependencyFuncNoop, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid scalar generator: %q", argType)
+	}
 }
 
 func parseArgTypeRef(raw map[string]any) (genFunc, dependencyFunc, error) {
@@ -100,24 +103,12 @@ func parseArgTypeRef(raw map[string]any) (genFunc, dependencyFunc, error) {
 	genFunc := func(vu *VU) (any, error) {
 		vu.logger.Debug().Msgf("[REF] gen %s - %s", queryRef, columnRef)
 
-		vu.dataMu.RLock()
-		defer vu.dataMu.RUnlock()
-		query, ok := vu.data[queryRef]
-		if !ok {
-			return nil, fmt.Errorf("missing query: %q", queryRef)
-		}
-
-		if len(query) == 0 {
-			return nil, fmt.Errorf("no data found for %s - %s", queryRef, columnRef)
+		row, err := vu.pickRow(queryRef)
+		if err != nil {
+			return nil, err
 		}
 
-		row := rand.IntN(len(query))
-		cell, ok := query[row][columnRef]
-		if !ok {
-			return nil, fmt.Errorf("missing column: %q", columnRef)
-		}
-
-		return cell, nil
+		return refColumn(row, columnRef)
 	}
 
 	depFunc := func(vu *VU) bool {
@@ -156,9 +147,15 @@ func parseArgTypeSet(raw map[string]any) (genFunc, dependencyFunc, error) {
 			return nil, nil, fmt.Errorf("parsing values: %w", err)
 		}
 	} else {
-		weights = lo.Map(rawWeights, func(w any, _ int) int {
-			return w.(int)
-		})
+		for _, w := range rawWeights {
+			weight, ok := w.(int)
+			if !ok {
+				if weight, ok = coerceNumber[int](w); !ok {
+					return nil, nil, fmt.Errorf("parsing weights: %w", FieldTypeErr{Name: "weights", Got: fmt.Sprintf("%T", w), Exp: "int"})
+				}
+			}
+			weights = append(weights, weight)
+		}
 	}
 
 	weightedItems, err := buildWeightedItems(values, weights)
@@ -169,7 +166,7 @@ func parseArgTypeSet(raw map[string]any) (genFunc, dependencyFunc, error) {
 	genFunc := func(vu *VU) (any, error) {
 		vu.logger.Debug().Msgf("[SET] gen %v", values)
 
-		return weightedItems.choose(), nil
+		return weightedItems.choose(vu.rng), nil
 	}
 
 	return genFunc, dependencyFuncNoop, nil
@@ -190,6 +187,41 @@ func parseArgTypeConst(raw map[string]any) (genFunc, dependencyFunc, error) {
 	return genFunc, dependencyFuncNoop, nil
 }
 
+func parseArgTypeVar(raw map[string]any) (genFunc, dependencyFunc, error) {
+	name, err := parseField[string](raw, "value")
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing value: %w", err)
+	}
+
+	genFunc := func(vu *VU) (any, error) {
+		vu.logger.Debug().Msgf("[VAR] gen %s", name)
+
+		vu.dataMu.RLock()
+		defer vu.dataMu.RUnlock()
+
+		value, ok := vu.vars[name]
+		if !ok {
+			return nil, fmt.Errorf("missing var: %q", name)
+		}
+
+		return value, nil
+	}
+
+	depFunc := func(vu *VU) bool {
+		vu.dataMu.RLock()
+		defer vu.dataMu.RUnlock()
+
+		_, ok := vu.vars[name]
+		if !ok {
+			vu.logger.Info().Str("var", name).Msg("missing var")
+		}
+
+		return ok
+	}
+
+	return genFunc, depFunc, nil
+}
+
 func parseMinMax[T any](raw map[string]any) (T, T, error) {
 	min, err := parseField[T](raw, "min")
 	if err != nil {
@@ -204,6 +236,30 @@ func parseMinMax[T any](raw map[string]any) (T, T, error) {
 	return min, max, nil
 }
 
+// parseTimestampField parses an RFC3339 timestamp field, which is decoded
+// as a time.Time if it's unquoted in the config file.
+func parseTimestampField(raw map[string]any, key string) (time.Time, error) {
+	value, err := parseField[any](raw, key)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing %s: %w", key, err)
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, FieldValueErr{Name: key, Err: fmt.Errorf("parsing %s as timestamp: %w", key, err)}
+		}
+		return t, nil
+
+	default:
+		return time.Time{}, fmt.Errorf("parsing %s: %w", key, FieldTypeErr{Name: key, Got: fmt.Sprintf("%T", value), Exp: "timestamp"})
+	}
+}
+
 func parseField[T any](m map[string]any, key string) (T, error) {
 	valueRaw, ok := m[key]
 	if !ok {
@@ -212,8 +268,53 @@ func parseField[T any](m map[string]any, key string) (T, error) {
 
 	value, ok := valueRaw.(T)
 	if !ok {
-		return *new(T), fmt.Errorf("field type mismatch (got: %T exp: %T)", valueRaw, *new(T))
+		if value, ok = coerceNumber[T](valueRaw); !ok {
+			return *new(T), FieldTypeErr{Name: key, Got: fmt.Sprintf("%T", valueRaw), Exp: fmt.Sprintf("%T", *new(T))}
+		}
 	}
 
 	return value, nil
 }
+
+// coerceNumber converts between the numeric types YAML values are decoded
+// into, so that e.g. "min: 1" can be used for a float arg. Conversions
+// that would change the value are refused: integers are only converted
+// to floats if they're within ±2^53, the range float64 holds exactly, and
+// floats are only converted to ints if they're whole and within range.
+func coerceNumber[T any](v any) (T, bool) {
+	var out T
+
+	switch p := any(&out).(type) {
+	case *float64:
+		var n int64
+		switch i := v.(type) {
+		case int:
+			n = int64(i)
+		case int64:
+			n = i
+		default:
+			return out, false
+		}
+
+		if n < -maxExactFloat || n > maxExactFloat {
+			return out, false
+		}
+
+		*p = float64(n)
+		return out, true
+
+	case *int:
+		// float64(math.MaxInt) rounds up to 2^63, which is out of range,
+		// hence the exclusive upper bound.
+		if n, ok := v.(float64); ok && n == math.Trunc(n) && n >= math.MinInt && n < math.MaxInt {
+			*p = int(n)
+			return out, true
+		}
+	}
+
+	return out, false
+}
+
+// maxExactFloat is the largest magnitude up to which every integer can be
+// held exactly by a float64.
+const maxExactFloat = 1 << 53
@@ -8,6 +8,7 @@ import (
 	"github.com/codingconcepts/drk/pkg/test"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func TestParseArgTypeGen(t *testing.T) {
@@ -24,7 +25,7 @@ func TestParseArgTypeGen(t *testing.T) {
 				"value": "email",
 			},
 			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
+				raw, err := f(NewVU(&zerolog.Logger{}))
 				assert.NoError(t, err)
 
 				value := raw.(string)
@@ -44,15 +45,7 @@ func TestParseArgTypeGen(t *testing.T) {
 			raw: map[string]any{
 				"value": "invalid_generator",
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				_, err := f(nil)
-
-				expErr := fmt.Errorf("missing generator: \"invalid_generator\"")
-				assert.Equal(t, expErr, err)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: FieldValueErr{Name: "value", Err: fmt.Errorf("missing generator: \"invalid_generator\"")},
 		},
 	}
 
@@ -77,7 +70,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 		raw              map[string]any
 		genFuncValidator func(t *testing.T, f genFunc)
 		depFuncValidator func(t *testing.T, f dependencyFunc)
-		expErr           error
+		expErr           string
 	}{
 		{
 			name:    "missing min",
@@ -85,15 +78,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 			raw: map[string]any{
 				"max": 10,
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := fmt.Errorf("parsing min: %w", FieldMissingErr{Name: "min"})
-				assert.Equal(t, exp, err)
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: fmt.Errorf("parsing min: %w", FieldMissingErr{Name: "min"}).Error(),
 		},
 		{
 			name:    "invalid min",
@@ -102,15 +87,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"min": "invalid",
 				"max": 10,
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := "parsing min: field type mismatch (got: string exp: int)"
-				assert.Equal(t, exp, err.Error())
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: "parsing min: field type mismatch (got: string exp: int)",
 		},
 		{
 			name:    "missing max",
@@ -118,15 +95,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 			raw: map[string]any{
 				"min": 10,
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := fmt.Errorf("parsing max: %w", FieldMissingErr{Name: "max"})
-				assert.Equal(t, exp, err)
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: fmt.Errorf("parsing max: %w", FieldMissingErr{Name: "max"}).Error(),
 		},
 		{
 			name:    "invalid max",
@@ -135,15 +104,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"min": 10,
 				"max": "invalid",
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := "parsing max: field type mismatch (got: string exp: int)"
-				assert.Equal(t, exp, err.Error())
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: "parsing max: field type mismatch (got: string exp: int)",
 		},
 		{
 			name:    "valid int generator - min eq max",
@@ -153,7 +114,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"max": 10,
 			},
 			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
+				raw, err := f(NewVU(&zerolog.Logger{}))
 				assert.NoError(t, err)
 
 				assert.Equal(t, 10, raw.(int))
@@ -168,15 +129,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 			raw: map[string]any{
 				"max": 10.0,
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := fmt.Errorf("parsing min: %w", FieldMissingErr{Name: "min"})
-				assert.Equal(t, exp, err)
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: fmt.Errorf("parsing min: %w", FieldMissingErr{Name: "min"}).Error(),
 		},
 		{
 			name:    "invalid min",
@@ -185,15 +138,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"min": "invalid",
 				"max": 10.0,
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := "parsing min: field type mismatch (got: string exp: float64)"
-				assert.Equal(t, exp, err.Error())
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: "parsing min: field type mismatch (got: string exp: float64)",
 		},
 		{
 			name:    "missing max",
@@ -201,15 +146,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 			raw: map[string]any{
 				"min": 10.0,
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := fmt.Errorf("parsing max: %w", FieldMissingErr{Name: "max"})
-				assert.Equal(t, exp, err)
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: fmt.Errorf("parsing max: %w", FieldMissingErr{Name: "max"}).Error(),
 		},
 		{
 			name:    "invalid max",
@@ -218,15 +155,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"min": 10.0,
 				"max": "invalid",
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := "parsing max: field type mismatch (got: string exp: float64)"
-				assert.Equal(t, exp, err.Error())
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: "parsing max: field type mismatch (got: string exp: float64)",
 		},
 		{
 			name:    "valid float generator - min eq max",
@@ -236,7 +165,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"max": 10.0,
 			},
 			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
+				raw, err := f(NewVU(&zerolog.Logger{}))
 				assert.NoError(t, err)
 
 				assert.Equal(t, 10.0, raw.(float64))
@@ -251,15 +180,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 			raw: map[string]any{
 				"max": "2024-11-12T19:13:07Z",
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := fmt.Errorf("parsing min: %w", FieldMissingErr{Name: "min"})
-				assert.Equal(t, exp, err)
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: fmt.Errorf("parsing min: %w", FieldMissingErr{Name: "min"}).Error(),
 		},
 		{
 			name:    "invalid min",
@@ -268,15 +189,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"min": "invalid",
 				"max": "2024-11-12T19:13:07Z",
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := "parsing max as timestamp: parsing time \"invalid\" as \"2006-01-02T15:04:05Z07:00\": cannot parse \"invalid\" as \"2006\""
-				assert.Equal(t, exp, err.Error())
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: "parsing min as timestamp: parsing time \"invalid\" as \"2006-01-02T15:04:05Z07:00\": cannot parse \"invalid\" as \"2006\"",
 		},
 		{
 			name:    "missing max",
@@ -284,15 +197,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 			raw: map[string]any{
 				"min": "2024-11-12T19:13:07Z",
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := fmt.Errorf("parsing max: %w", FieldMissingErr{Name: "max"})
-				assert.Equal(t, exp, err)
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: fmt.Errorf("parsing max: %w", FieldMissingErr{Name: "max"}).Error(),
 		},
 		{
 			name:    "invalid max",
@@ -301,25 +206,35 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"min": "2024-11-12T19:13:07Z",
 				"max": "invalid",
 			},
+			expErr: "parsing max as timestamp: parsing time \"invalid\" as \"2006-01-02T15:04:05Z07:00\": cannot parse \"invalid\" as \"2006\"",
+		},
+		{
+			name:    "valid timestamp generator - min eq max",
+			argType: "timestamp",
+			raw: map[string]any{
+				"min": "2024-11-12T19:13:07Z",
+				"max": "2024-11-12T19:13:07Z",
+			},
 			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := "parsing max as timestamp: parsing time \"invalid\" as \"2006-01-02T15:04:05Z07:00\": cannot parse \"invalid\" as \"2006\""
-				assert.Equal(t, exp, err.Error())
-				assert.Nil(t, raw)
+				raw, err := f(NewVU(&zerolog.Logger{}))
+				assert.NoError(t, err)
+
+				exp := time.Date(2024, 11, 12, 19, 13, 7, 0, time.UTC)
+				assert.Equal(t, exp, raw.(time.Time))
 			},
 			depFuncValidator: func(t *testing.T, f dependencyFunc) {
 				assert.True(t, f(nil))
 			},
 		},
 		{
-			name:    "valid timestamp generator - min eq max",
+			name:    "valid timestamp generator - unquoted timestamps",
 			argType: "timestamp",
 			raw: map[string]any{
-				"min": "2024-11-12T19:13:07Z",
+				"min": time.Date(2024, 11, 12, 19, 13, 7, 0, time.UTC),
 				"max": "2024-11-12T19:13:07Z",
 			},
 			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
+				raw, err := f(NewVU(&zerolog.Logger{}))
 				assert.NoError(t, err)
 
 				exp := time.Date(2024, 11, 12, 19, 13, 7, 0, time.UTC)
@@ -335,15 +250,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 			raw: map[string]any{
 				"max": "1h",
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := fmt.Errorf("parsing min: %w", FieldMissingErr{Name: "min"})
-				assert.Equal(t, exp, err)
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: fmt.Errorf("parsing min: %w", FieldMissingErr{Name: "min"}).Error(),
 		},
 		{
 			name:    "invalid min",
@@ -352,15 +259,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"min": "invalid",
 				"max": "1h",
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := "parsing min as duration: time: invalid duration \"invalid\""
-				assert.Equal(t, exp, err.Error())
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: "parsing min as duration: time: invalid duration \"invalid\"",
 		},
 		{
 			name:    "missing max",
@@ -368,15 +267,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 			raw: map[string]any{
 				"min": "1h",
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := fmt.Errorf("parsing max: %w", FieldMissingErr{Name: "max"})
-				assert.Equal(t, exp, err)
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: fmt.Errorf("parsing max: %w", FieldMissingErr{Name: "max"}).Error(),
 		},
 		{
 			name:    "invalid max",
@@ -385,15 +276,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"min": "1h",
 				"max": "invalid",
 			},
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := "parsing max as duration: time: invalid duration \"invalid\""
-				assert.Equal(t, exp, err.Error())
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr: "parsing max as duration: time: invalid duration \"invalid\"",
 		},
 		{
 			name:    "valid interval generator - min eq max",
@@ -403,7 +286,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"max": "1h2m3s",
 			},
 			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
+				raw, err := f(NewVU(&zerolog.Logger{}))
 				assert.NoError(t, err)
 
 				exp := time.Duration(1*time.Hour + 2*time.Minute + 3*time.Second)
@@ -421,7 +304,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"max": 100,
 			},
 			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
+				raw, err := f(NewVU(&zerolog.Logger{}))
 				assert.NoError(t, err)
 
 				act := raw.(int)
@@ -439,7 +322,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"max": 100.0,
 			},
 			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
+				raw, err := f(NewVU(&zerolog.Logger{}))
 				assert.NoError(t, err)
 
 				act := raw.(float64)
@@ -457,7 +340,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"max": "2024-11-12T19:13:07Z",
 			},
 			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
+				raw, err := f(NewVU(&zerolog.Logger{}))
 				assert.NoError(t, err)
 
 				act := raw.(time.Time)
@@ -477,7 +360,7 @@ func TestParseArgTypeScalar(t *testing.T) {
 				"max": "2h3m4s",
 			},
 			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
+				raw, err := f(NewVU(&zerolog.Logger{}))
 				assert.NoError(t, err)
 
 				act := raw.(time.Duration)
@@ -492,25 +375,18 @@ func TestParseArgTypeScalar(t *testing.T) {
 		{
 			name:    "unsupported scalar type",
 			argType: "unsupported",
-			genFuncValidator: func(t *testing.T, f genFunc) {
-				raw, err := f(nil)
-				exp := "invalid scalar generator: \"unsupported\""
-				assert.Equal(t, exp, err.Error())
-				assert.Nil(t, raw)
-			},
-			depFuncValidator: func(t *testing.T, f dependencyFunc) {
-				assert.True(t, f(nil))
-			},
+			expErr:  "invalid scalar generator: \"unsupported\"",
 		},
 	}
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 			gen, dep, err := parseArgTypeScalar(c.argType, c.raw)
-			assert.Equal(t, c.expErr, err)
-			if err != nil {
+			if c.expErr != "" {
+				assert.EqualError(t, err, c.expErr)
 				return
 			}
+			assert.NoError(t, err)
 
 			c.genFuncValidator(t, gen)
 			c.depFuncValidator(t, dep)
@@ -773,3 +649,106 @@ func TestParseArgTypeConst(t *testing.T) {
 		})
 	}
 }
+
+func TestParseArgTypeVar(t *testing.T) {
+	cases := []struct {
+		name             string
+		raw              map[string]any
+		genFuncValidator func(*testing.T, genFunc, *VU)
+		depFuncValidator func(*testing.T, dependencyFunc, *VU)
+		expErr           error
+	}{
+		{
+			name: "valid var",
+			raw: map[string]any{
+				"value": "member_id",
+			},
+			genFuncValidator: func(t *testing.T, f genFunc, vu *VU) {
+				raw, err := f(vu)
+				assert.NoError(t, err)
+
+				assert.Equal(t, "a", raw)
+			},
+			depFuncValidator: func(t *testing.T, f dependencyFunc, vu *VU) {
+				assert.True(t, f(vu))
+			},
+		},
+		{
+			name:   "missing value config",
+			raw:    map[string]any{},
+			expErr: fmt.Errorf("parsing value: %w", FieldMissingErr{Name: "value"}),
+		},
+		{
+			name: "missing var",
+			raw: map[string]any{
+				"value": "non_existent",
+			},
+			genFuncValidator: func(t *testing.T, f genFunc, vu *VU) {
+				raw, err := f(vu)
+				assert.Nil(t, raw)
+				assert.Equal(t, fmt.Errorf("missing var: \"non_existent\""), err)
+			},
+			depFuncValidator: func(t *testing.T, f dependencyFunc, vu *VU) {
+				assert.False(t, f(vu))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gen, dep, err := parseArgTypeVar(c.raw)
+			assert.Equal(t, c.expErr, err)
+			if err != nil {
+				return
+			}
+
+			vu := NewVU(&zerolog.Logger{})
+			vu.vars = map[string]any{
+				"member_id": "a",
+			}
+
+			c.genFuncValidator(t, gen, vu)
+			c.depFuncValidator(t, dep, vu)
+		})
+	}
+}
+
+func BenchmarkArgGenerate(b *testing.B) {
+	cases := []struct {
+		name string
+		arg  string
+	}{
+		{name: "int", arg: "{type: int, min: 1, max: 100}"},
+		{name: "float", arg: "{type: float, min: 1, max: 100}"},
+		{name: "timestamp", arg: "{type: timestamp, min: '2024-01-01T00:00:00Z', max: '2025-01-01T00:00:00Z'}"},
+		{name: "interval", arg: "{type: interval, min: 1m, max: 1h}"},
+		{name: "gen", arg: "{type: gen, value: email}"},
+		{name: "set", arg: "{type: set, values: [a, b, c], weights: [1, 2, 3]}"},
+		{name: "const", arg: "{type: const, value: a}"},
+		{name: "ref", arg: "{type: ref, query: fetch, column: id}"},
+		{name: "var", arg: "{type: var, value: id}"},
+	}
+
+	logger := zerolog.Nop()
+	vu := NewVU(&logger)
+	vu.data["fetch"] = []map[string]any{{"id": 1}, {"id": 2}, {"id": 3}}
+	vu.vars["id"] = 1
+
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			var arg Arg
+			if err := yaml.Unmarshal([]byte(c.arg), &arg); err != nil {
+				b.Fatalf("parsing arg: %v", err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for range b.N {
+				if _, err := arg.generator(vu); err != nil {
+					b.Fatalf("generating arg: %v", err)
+				}
+			}
+		})
+	}
+}
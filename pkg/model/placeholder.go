@@ -0,0 +1,374 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// placeholderStyle describes how a driver expects arguments to be
+// referenced in a statement.
+type placeholderStyle struct {
+	// format returns the placeholder for the nth (1-based) distinct arg.
+	format func(n int) string
+
+	// reuse is true if a placeholder can be referenced more than once
+	// in a statement (e.g. $1), and false if each reference consumes
+	// an argument of its own (e.g. ?).
+	reuse bool
+
+	// backslashEscapes is true if a backslash escapes the next character
+	// in a quoted string (e.g. 'it\'s').
+	backslashEscapes bool
+
+	// dollarQuotes is true if strings can be dollar quoted (e.g. $$a$$
+	// or $tag$a$tag$).
+	dollarQuotes bool
+
+	// hashComments is true if # starts a comment, as -- does.
+	hashComments bool
+}
+
+var placeholderStyles = map[string]placeholderStyle{
+	"pgx": {
+		format:       func(n int) string { return "$" + strconv.Itoa(n) },
+		reuse:        true,
+		dollarQuotes: true,
+	},
+	"mysql": {
+		format:           func(int) string { return "?" },
+		reuse:            false,
+		backslashEscapes: true,
+		hashComments:     true,
+	},
+}
+
+// statement is an activity's query, resolved for a particular driver.
+type statement struct {
+	query string
+
+	// The AS OF SYSTEM TIME expression to run the statement at, if any.
+	asOf string
+
+	// Index of the arg bound to each placeholder, if the query's
+	// placeholders have been rewritten.
+	argOrder []int
+}
+
+// Prepare resolves the statement each activity will run against each of
+// the given drivers, rewriting named and $N placeholders into the
+// driver's own placeholder syntax.
+func (d *Drk) Prepare(drivers ...string) error {
+	for _, driver := range drivers {
+		style, ok := placeholderStyles[driver]
+		if !ok {
+			return fmt.Errorf("unsupported driver: %q", driver)
+		}
+
+		for name, act := range d.Activities {
+			if err := act.prepare(driver, style); err != nil {
+				return fmt.Errorf("preparing activity %q for %s: %w", name, driver, err)
+			}
+			d.Activities[name] = act
+		}
+	}
+
+	return nil
+}
+
+func (q *Query) prepare(driver string, style placeholderStyle) error {
+	stmt, err := q.resolve(driver, style)
+	if err != nil {
+		return err
+	}
+
+	if q.AsOf != "" {
+		asOf, err := q.resolveAsOf()
+		if err != nil {
+			return fmt.Errorf("parsing as_of: %w", err)
+		}
+
+		// Drivers without AS OF SYSTEM TIME are rejected by the
+		// workflows that run the query, not here.
+		if asOfDrivers[driver] {
+			stmt.asOf = asOf
+		}
+	}
+
+	if err = q.Expect.prepare(*q); err != nil {
+		return fmt.Errorf("parsing expect: %w", err)
+	}
+
+	if q.prepared == nil {
+		q.prepared = map[string]statement{}
+	}
+	q.prepared[driver] = stmt
+
+	return nil
+}
+
+func (q Query) resolve(driver string, style placeholderStyle) (statement, error) {
+	stmt := statement{query: q.Query}
+	if override, ok := q.QueryByDriver[driver]; ok {
+		stmt.query = override
+	}
+
+	names := map[string]int{}
+	for i, arg := range q.Args {
+		if arg.Name == "" {
+			continue
+		}
+		if _, ok := names[arg.Name]; ok {
+			return statement{}, fmt.Errorf("duplicate arg name: %q", arg.Name)
+		}
+		names[arg.Name] = i
+	}
+
+	if len(names) > 0 {
+		query, argOrder, err := rewriteNamed(stmt.query, names, style)
+		if err != nil {
+			return statement{}, err
+		}
+
+		if len(argOrder) > 0 {
+			if len(names) != len(q.Args) {
+				return statement{}, fmt.Errorf("all args must be named when using named placeholders")
+			}
+
+			return statement{query: query, argOrder: argOrder}, nil
+		}
+	}
+
+	// Drivers that support $N placeholders natively don't need them
+	// rewriting.
+	if style.reuse {
+		return stmt, nil
+	}
+
+	query, argOrder, err := rewritePositional(stmt.query, len(q.Args), style)
+	if err != nil {
+		return statement{}, err
+	}
+
+	if len(argOrder) > 0 {
+		return statement{query: query, argOrder: argOrder}, nil
+	}
+
+	return stmt, nil
+}
+
+// statement returns the statement to run against the given driver,
+// falling back to the query as written if it hasn't been prepared for
+// that driver.
+func (q Query) statement(driver string) statement {
+	if stmt, ok := q.prepared[driver]; ok {
+		return stmt
+	}
+
+	return statement{query: q.Query}
+}
+
+// bind orders generated arg values to match the placeholders in the
+// statement.
+func (s statement) bind(values []any) []any {
+	if s.argOrder == nil {
+		return values
+	}
+
+	bound := make([]any, len(s.argOrder))
+	for i, argIndex := range s.argOrder {
+		bound[i] = values[argIndex]
+	}
+
+	return bound
+}
+
+// rewriteNamed replaces :name and @name placeholders for known names
+// with positional placeholders, returning the rewritten query and the
+// index of the arg bound to each positional placeholder. Quoted strings,
+// quoted identifiers, comments and :: casts are left untouched.
+func rewriteNamed(query string, names map[string]int, style placeholderStyle) (string, []int, error) {
+	var argOrder []int
+	positions := map[string]int{}
+
+	rewritten, err := rewriteUnquoted(query, style, func(i int) (string, int, error) {
+		c := query[i]
+
+		if c == ':' && i+1 < len(query) && query[i+1] == ':' {
+			return "::", i + 2, nil
+		}
+
+		if (c != ':' && c != '@') || i+1 >= len(query) || !isIdentStart(query[i+1]) {
+			return "", i, nil
+		}
+
+		end := i + 1
+		for end < len(query) && isIdentPart(query[end]) {
+			end++
+		}
+
+		name := query[i+1 : end]
+		argIndex, ok := names[name]
+		if !ok {
+			return query[i:end], end, nil
+		}
+
+		if pos, ok := positions[name]; ok && style.reuse {
+			return style.format(pos), end, nil
+		}
+
+		argOrder = append(argOrder, argIndex)
+		positions[name] = len(argOrder)
+		return style.format(len(argOrder)), end, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return rewritten, argOrder, nil
+}
+
+// rewritePositional replaces $N placeholders with the given style's
+// placeholders, returning the rewritten query and the index of the arg
+// bound to each placeholder.
+func rewritePositional(query string, args int, style placeholderStyle) (string, []int, error) {
+	var argOrder []int
+
+	rewritten, err := rewriteUnquoted(query, style, func(i int) (string, int, error) {
+		if query[i] != '$' || i+1 >= len(query) || !isDigit(query[i+1]) {
+			return "", i, nil
+		}
+
+		end := i + 1
+		for end < len(query) && isDigit(query[end]) {
+			end++
+		}
+
+		n, err := strconv.Atoi(query[i+1 : end])
+		if err != nil {
+			return "", 0, fmt.Errorf("parsing placeholder %q: %w", query[i:end], err)
+		}
+
+		if n < 1 || n > args {
+			return "", 0, fmt.Errorf("placeholder %q has no matching arg", query[i:end])
+		}
+
+		argOrder = append(argOrder, n-1)
+		return style.format(len(argOrder)), end, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return rewritten, argOrder, nil
+}
+
+// rewriteUnquoted walks a query, calling replace at each position that
+// isn't inside a quoted string, quoted identifier or comment, as the
+// given style's driver reads them. If replace returns an end position
+// beyond i, the bytes between them are substituted with its
+// replacement; otherwise the byte at i is kept.
+func rewriteUnquoted(query string, style placeholderStyle, replace func(i int) (string, int, error)) (string, error) {
+	var sb strings.Builder
+
+	for i := 0; i < len(query); i++ {
+		end, err := skipQuoted(query, i, style)
+		if err != nil {
+			return "", err
+		}
+		if end > i {
+			sb.WriteString(query[i:end])
+			i = end - 1
+			continue
+		}
+
+		replacement, end, err := replace(i)
+		if err != nil {
+			return "", err
+		}
+
+		if end <= i {
+			sb.WriteByte(query[i])
+			continue
+		}
+
+		sb.WriteString(replacement)
+		i = end - 1
+	}
+
+	return sb.String(), nil
+}
+
+// skipQuoted returns the end of the quoted string, quoted identifier or
+// comment starting at i, or i if there isn't one.
+func skipQuoted(query string, i int, style placeholderStyle) (int, error) {
+	c := query[i]
+	next := byte(0)
+	if i+1 < len(query) {
+		next = query[i+1]
+	}
+
+	switch {
+	case c == '\'' || c == '"' || c == '`':
+		// Postgres only reads backslash escapes in E'' strings.
+		escapes := style.backslashEscapes && c != '`'
+		if c == '\'' && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') && (i == 1 || !isIdentPart(query[i-2])) {
+			escapes = true
+		}
+
+		for j := i + 1; j < len(query); j++ {
+			switch {
+			case query[j] == '\\' && escapes:
+				j++
+			case query[j] == c:
+				return j + 1, nil
+			}
+		}
+		return 0, fmt.Errorf("unterminated quote: %c", c)
+
+	case c == '-' && next == '-', c == '#' && style.hashComments:
+		if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+			return i + end + 1, nil
+		}
+		return len(query), nil
+
+	case c == '/' && next == '*':
+		if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+			return i + 2 + end + 2, nil
+		}
+		return 0, fmt.Errorf("unterminated comment")
+
+	case c == '$' && style.dollarQuotes && (i == 0 || !isIdentPart(query[i-1])):
+		// Dollar quote tags can't start with a digit, so $N placeholders
+		// aren't mistaken for them.
+		j := i + 1
+		if j < len(query) && isIdentStart(query[j]) {
+			for j < len(query) && isIdentPart(query[j]) {
+				j++
+			}
+		}
+		if j >= len(query) || query[j] != '$' {
+			return i, nil
+		}
+
+		tag := query[i : j+1]
+		if end := strings.Index(query[j+1:], tag); end >= 0 {
+			return j + 1 + end + len(tag), nil
+		}
+		return 0, fmt.Errorf("unterminated dollar quote: %s", tag)
+	}
+
+	return i, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,362 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRewriteNamed(t *testing.T) {
+	cases := []struct {
+		name        string
+		query       string
+		names       map[string]int
+		driver      string
+		expQuery    string
+		expArgOrder []int
+		expErr      error
+	}{
+		{
+			name:        "colon placeholders pgx",
+			query:       "SELECT * FROM t WHERE a = :a AND b = :b",
+			names:       map[string]int{"a": 0, "b": 1},
+			driver:      "pgx",
+			expQuery:    "SELECT * FROM t WHERE a = $1 AND b = $2",
+			expArgOrder: []int{0, 1},
+		},
+		{
+			name:        "at placeholders pgx",
+			query:       "SELECT * FROM t WHERE a = @a AND b = @b",
+			names:       map[string]int{"a": 0, "b": 1},
+			driver:      "pgx",
+			expQuery:    "SELECT * FROM t WHERE a = $1 AND b = $2",
+			expArgOrder: []int{0, 1},
+		},
+		{
+			name:        "repeated placeholders pgx",
+			query:       "SELECT :b, :a, :b",
+			names:       map[string]int{"a": 0, "b": 1},
+			driver:      "pgx",
+			expQuery:    "SELECT $1, $2, $1",
+			expArgOrder: []int{1, 0},
+		},
+		{
+			name:        "repeated placeholders mysql",
+			query:       "SELECT :b, :a, :b",
+			names:       map[string]int{"a": 0, "b": 1},
+			driver:      "mysql",
+			expQuery:    "SELECT ?, ?, ?",
+			expArgOrder: []int{1, 0, 1},
+		},
+		{
+			name:        "casts, quotes and unknown names untouched",
+			query:       "SELECT :a::INT, ':a', \":a\", t@idx FROM t@idx",
+			names:       map[string]int{"a": 0},
+			driver:      "pgx",
+			expQuery:    "SELECT $1::INT, ':a', \":a\", t@idx FROM t@idx",
+			expArgOrder: []int{0},
+		},
+		{
+			name:        "name prefixes don't match",
+			query:       "SELECT :ab, :a",
+			names:       map[string]int{"a": 0},
+			driver:      "pgx",
+			expQuery:    "SELECT :ab, $1",
+			expArgOrder: []int{0},
+		},
+		{
+			name:        "comments untouched",
+			query:       "SELECT :a -- isn't :a\n/* it's :a */",
+			names:       map[string]int{"a": 0},
+			driver:      "pgx",
+			expQuery:    "SELECT $1 -- isn't :a\n/* it's :a */",
+			expArgOrder: []int{0},
+		},
+		{
+			name:        "dollar quotes untouched",
+			query:       "SELECT :a, $$it's :a$$, $tag$it's :a$tag$",
+			names:       map[string]int{"a": 0},
+			driver:      "pgx",
+			expQuery:    "SELECT $1, $$it's :a$$, $tag$it's :a$tag$",
+			expArgOrder: []int{0},
+		},
+		{
+			name:        "escape strings pgx",
+			query:       `SELECT :a, E'it\'s :a'`,
+			names:       map[string]int{"a": 0},
+			driver:      "pgx",
+			expQuery:    `SELECT $1, E'it\'s :a'`,
+			expArgOrder: []int{0},
+		},
+		{
+			name:        "backslash escapes mysql",
+			query:       `SELECT :a, 'it\'s :a'`,
+			names:       map[string]int{"a": 0},
+			driver:      "mysql",
+			expQuery:    `SELECT ?, 'it\'s :a'`,
+			expArgOrder: []int{0},
+		},
+		{
+			name:   "unterminated dollar quote",
+			query:  "SELECT :a, $$:a",
+			names:  map[string]int{"a": 0},
+			driver: "pgx",
+			expErr: errors.New("unterminated dollar quote: $$"),
+		},
+		{
+			name:   "unterminated quote",
+			query:  "SELECT ':a",
+			names:  map[string]int{"a": 0},
+			driver: "pgx",
+			expErr: errors.New("unterminated quote: '"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			query, argOrder, err := rewriteNamed(c.query, c.names, placeholderStyles[c.driver])
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.expQuery, query)
+			assert.Equal(t, c.expArgOrder, argOrder)
+		})
+	}
+}
+
+func TestRewritePositional(t *testing.T) {
+	cases := []struct {
+		name        string
+		query       string
+		args        int
+		expQuery    string
+		expArgOrder []int
+		expErr      error
+	}{
+		{
+			name:        "in order",
+			query:       "SELECT * FROM t WHERE a = $1 AND b = $2",
+			args:        2,
+			expQuery:    "SELECT * FROM t WHERE a = ? AND b = ?",
+			expArgOrder: []int{0, 1},
+		},
+		{
+			name:        "reordered and repeated",
+			query:       "SELECT $3, $1, $3, $10",
+			args:        10,
+			expQuery:    "SELECT ?, ?, ?, ?",
+			expArgOrder: []int{2, 0, 2, 9},
+		},
+		{
+			name:     "quoted and dollar-quoted untouched",
+			query:    "SELECT '$1', $$x$$",
+			args:     1,
+			expQuery: "SELECT '$1', $$x$$",
+		},
+		{
+			name:        "backslash escaped quotes",
+			query:       `SELECT 'it\'s $1', "say \"$1\"", $1`,
+			args:        1,
+			expQuery:    `SELECT 'it\'s $1', "say \"$1\"", ?`,
+			expArgOrder: []int{0},
+		},
+		{
+			name:        "comments untouched",
+			query:       "SELECT $1 -- isn't $2\n# it's $2\n/* it's $2 */",
+			args:        1,
+			expQuery:    "SELECT ? -- isn't $2\n# it's $2\n/* it's $2 */",
+			expArgOrder: []int{0},
+		},
+		{
+			name:   "unterminated comment",
+			query:  "SELECT $1 /* $1",
+			args:   1,
+			expErr: errors.New("unterminated comment"),
+		},
+		{
+			name:   "zero placeholder",
+			query:  "SELECT $0",
+			args:   1,
+			expErr: errors.New(`placeholder "$0" has no matching arg`),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			query, argOrder, err := rewritePositional(c.query, c.args, placeholderStyles["mysql"])
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.expQuery, query)
+			assert.Equal(t, c.expArgOrder, argOrder)
+		})
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	cases := []struct {
+		name        string
+		query       Query
+		driver      string
+		expQuery    string
+		expArgOrder []int
+		expErr      error
+	}{
+		{
+			name: "positional args untouched",
+			query: Query{
+				Query: "SELECT $1",
+				Args:  []Arg{{}},
+			},
+			driver:   "pgx",
+			expQuery: "SELECT $1",
+		},
+		{
+			name: "named args rewritten",
+			query: Query{
+				Query: "SELECT :b, :a",
+				Args:  []Arg{{Name: "a"}, {Name: "b"}},
+			},
+			driver:      "mysql",
+			expQuery:    "SELECT ?, ?",
+			expArgOrder: []int{1, 0},
+		},
+		{
+			name: "duplicate arg names",
+			query: Query{
+				Query: "SELECT :a",
+				Args:  []Arg{{Name: "a"}, {Name: "a"}},
+			},
+			driver: "pgx",
+			expErr: errors.New(`preparing activity "act" for pgx: duplicate arg name: "a"`),
+		},
+		{
+			name: "mixed named and unnamed args",
+			query: Query{
+				Query: "SELECT :a",
+				Args:  []Arg{{Name: "a"}, {}},
+			},
+			driver: "pgx",
+			expErr: errors.New(`preparing activity "act" for pgx: all args must be named when using named placeholders`),
+		},
+		{
+			name: "positional args translated for mysql",
+			query: Query{
+				Query: "SELECT $2, $1, $2",
+				Args:  []Arg{{}, {}},
+			},
+			driver:      "mysql",
+			expQuery:    "SELECT ?, ?, ?",
+			expArgOrder: []int{1, 0, 1},
+		},
+		{
+			name: "positional args without matching arg",
+			query: Query{
+				Query: "SELECT $2",
+				Args:  []Arg{{}},
+			},
+			driver: "mysql",
+			expErr: errors.New(`preparing activity "act" for mysql: placeholder "$2" has no matching arg`),
+		},
+		{
+			name: "driver override",
+			query: Query{
+				Query: "SELECT now()",
+				QueryByDriver: map[string]string{
+					"mysql": "SELECT NOW(6)",
+				},
+			},
+			driver:   "mysql",
+			expQuery: "SELECT NOW(6)",
+		},
+		{
+			name: "driver override for another driver",
+			query: Query{
+				Query: "SELECT now()",
+				QueryByDriver: map[string]string{
+					"mysql": "SELECT NOW(6)",
+				},
+			},
+			driver:   "pgx",
+			expQuery: "SELECT now()",
+		},
+		{
+			name:   "unsupported driver",
+			query:  Query{},
+			driver: "invalid",
+			expErr: errors.New(`unsupported driver: "invalid"`),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := Drk{
+				Activities: map[string]Query{"act": c.query},
+			}
+
+			err := cfg.Prepare(c.driver)
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr.Error(), err.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+
+			stmt := cfg.Activities["act"].statement(c.driver)
+			assert.Equal(t, c.expQuery, stmt.query)
+			assert.Equal(t, c.expArgOrder, stmt.argOrder)
+		})
+	}
+}
+
+func TestBind(t *testing.T) {
+	stmt := statement{argOrder: []int{1, 0, 1}}
+	assert.Equal(t, []any{"b", "a", "b"}, stmt.bind([]any{"a", "b"}))
+
+	stmt = statement{}
+	assert.Equal(t, []any{"a", "b"}, stmt.bind([]any{"a", "b"}))
+}
+
+func TestPrepareMultipleDrivers(t *testing.T) {
+	cfg := Drk{
+		Activities: map[string]Query{
+			"act": {
+				Query: "SELECT $2, $1",
+				Args:  []Arg{{}, {}},
+			},
+		},
+	}
+
+	assert.NoError(t, cfg.Prepare("pgx", "mysql"))
+
+	act := cfg.Activities["act"]
+	assert.Equal(t, statement{query: "SELECT $2, $1"}, act.statement("pgx"))
+	assert.Equal(t, statement{query: "SELECT ?, ?", argOrder: []int{1, 0}}, act.statement("mysql"))
+
+	// Unprepared drivers get the query as written.
+	assert.Equal(t, statement{query: "SELECT $2, $1"}, act.statement(""))
+}
+
+func TestArgNameUnmarshalYAML(t *testing.T) {
+	var q Query
+	err := yaml.Unmarshal([]byte(`
+args:
+  - type: int
+    name: a
+    min: 1
+    max: 1
+query: SELECT :a, :a`), &q)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", q.Args[0].Name)
+
+	assert.NoError(t, q.prepare("pgx", placeholderStyles["pgx"]))
+	assert.Equal(t, "SELECT $1, $1", q.statement("pgx").query)
+}
@@ -5,7 +5,7 @@ import (
 	"time"
 )
 
-func Int(min, max int) int {
+func Int(rng *rand.Rand, min, max int) int {
 	if min == max {
 		return min
 	}
@@ -14,10 +14,10 @@ func Int(min, max int) int {
 		min, max = max, min
 	}
 
-	return rand.IntN(max-min) + min
+	return rng.IntN(max-min) + min
 }
 
-func Float(min, max float64) float64 {
+func Float(rng *rand.Rand, min, max float64) float64 {
 	if min == max {
 		return min
 	}
@@ -26,10 +26,10 @@ func Float(min, max float64) float64 {
 		min, max = max, min
 	}
 
-	return min + rand.Float64()*(max-min)
+	return min + rng.Float64()*(max-min)
 }
 
-func Timestamp(min, max time.Time) time.Time {
+func Timestamp(rng *rand.Rand, min, max time.Time) time.Time {
 	if min.Equal(max) {
 		return min
 	}
@@ -42,11 +42,11 @@ func Timestamp(min, max time.Time) time.Time {
 	maxUnix := max.Unix()
 	delta := maxUnix - minUnix
 
-	randUnix := minUnix + rand.Int64N(delta)
+	randUnix := minUnix + rng.Int64N(delta)
 	return time.Unix(randUnix, 0)
 }
 
-func Interval(min, max time.Duration) time.Duration {
+func Interval(rng *rand.Rand, min, max time.Duration) time.Duration {
 	if min == max {
 		return min
 	}
@@ -56,7 +56,7 @@ func Interval(min, max time.Duration) time.Duration {
 	}
 
 	diff := max - min
-	randomDiff := time.Duration(rand.Int64N(int64(diff)))
+	randomDiff := time.Duration(rng.Int64N(int64(diff)))
 
 	return min + randomDiff
 }
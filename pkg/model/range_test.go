@@ -43,7 +43,7 @@ func TestInt(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			act := Int(c.min, c.max)
+			act := Int(newRand(), c.min, c.max)
 			c.expFunc(t, act)
 		})
 	}
@@ -84,7 +84,7 @@ func TestFloat(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			act := Float(c.min, c.max)
+			act := Float(newRand(), c.min, c.max)
 			c.expFunc(t, act)
 		})
 	}
@@ -129,7 +129,7 @@ func TestTimestamp(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			act := Timestamp(c.min, c.max)
+			act := Timestamp(newRand(), c.min, c.max)
 			c.expFunc(t, act)
 		})
 	}
@@ -170,7 +170,7 @@ func TestInterval(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			act := Interval(c.min, c.max)
+			act := Interval(newRand(), c.min, c.max)
 			c.expFunc(t, act)
 		})
 	}
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// RetainReplace replaces a query's results with those of its
+	// most recent execution.
+	RetainReplace = "replace"
+
+	// RetainAppend accumulates results across executions, evicting
+	// rows once the buffer exceeds its size.
+	RetainAppend = "append"
+
+	// RetainConsume accumulates results like RetainAppend but removes
+	// a row each time it's referenced, so it's only processed once.
+	RetainConsume = "consume"
+
+	// EvictFIFO evicts the oldest rows first.
+	EvictFIFO = "fifo"
+
+	// EvictRandom evicts rows at random.
+	EvictRandom = "random"
+
+	defaultRetainSize = 1000
+)
+
+// Retain determines how the results of an activity are kept between
+// executions for use by ref args.
+type Retain struct {
+	Mode     string `yaml:"mode"`
+	Size     int    `yaml:"size"`
+	Eviction string `yaml:"eviction"`
+}
+
+func (r *Retain) UnmarshalYAML(node *yaml.Node) error {
+	if err := checkKeys(node, "mode", "size", "eviction"); err != nil {
+		return err
+	}
+
+	type raw Retain
+	var rr raw
+	if err := node.Decode(&rr); err != nil {
+		return err
+	}
+
+	switch rr.Mode {
+	case "":
+		rr.Mode = RetainReplace
+	case RetainReplace, RetainAppend, RetainConsume:
+	default:
+		return fmt.Errorf("invalid retain mode: %q", rr.Mode)
+	}
+
+	switch rr.Eviction {
+	case "":
+		rr.Eviction = EvictFIFO
+	case EvictFIFO, EvictRandom:
+	default:
+		return fmt.Errorf("invalid eviction policy: %q", rr.Eviction)
+	}
+
+	if rr.Size < 0 {
+		return fmt.Errorf("invalid retain size: %d", rr.Size)
+	}
+	if rr.Size == 0 {
+		rr.Size = defaultRetainSize
+	}
+
+	*r = Retain(rr)
+	return nil
+}
+
+// apply combines the existing results of a query with the results of
+// its latest execution.
+func (r Retain) apply(rng *rand.Rand, existing, data []map[string]any) []map[string]any {
+	switch r.Mode {
+	case RetainAppend, RetainConsume:
+		return r.evict(rng, append(existing, data...))
+
+	default:
+		return data
+	}
+}
+
+func (r Retain) evict(rng *rand.Rand, rows []map[string]any) []map[string]any {
+	size := r.Size
+	if size <= 0 {
+		size = defaultRetainSize
+	}
+	if len(rows) <= size {
+		return rows
+	}
+
+	switch r.Eviction {
+	case EvictRandom:
+		for len(rows) > size {
+			i := rng.IntN(len(rows))
+			rows = slices.Delete(rows, i, i+1)
+		}
+		return rows
+
+	default:
+		return slices.Delete(rows, 0, len(rows)-size)
+	}
+}
@@ -0,0 +1,238 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRetainUnmarshalYAML(t *testing.T) {
+	cases := []struct {
+		name   string
+		yaml   string
+		exp    Retain
+		expErr error
+	}{
+		{
+			name: "defaults",
+			yaml: `{}`,
+			exp:  Retain{Mode: RetainReplace, Size: defaultRetainSize, Eviction: EvictFIFO},
+		},
+		{
+			name: "append with size and eviction",
+			yaml: `{mode: append, size: 10, eviction: random}`,
+			exp:  Retain{Mode: RetainAppend, Size: 10, Eviction: EvictRandom},
+		},
+		{
+			name: "consume",
+			yaml: `{mode: consume}`,
+			exp:  Retain{Mode: RetainConsume, Size: defaultRetainSize, Eviction: EvictFIFO},
+		},
+		{
+			name:   "invalid mode",
+			yaml:   `{mode: invalid}`,
+			expErr: errors.New(`invalid retain mode: "invalid"`),
+		},
+		{
+			name:   "invalid eviction",
+			yaml:   `{mode: append, eviction: invalid}`,
+			expErr: errors.New(`invalid eviction policy: "invalid"`),
+		},
+		{
+			name:   "invalid size",
+			yaml:   `{mode: append, size: -1}`,
+			expErr: errors.New(`invalid retain size: -1`),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var act Retain
+			err := yaml.Unmarshal([]byte(c.yaml), &act)
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr.Error(), err.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestRetainApply(t *testing.T) {
+	rows := func(ids ...int) []map[string]any {
+		var out []map[string]any
+		for _, id := range ids {
+			out = append(out, map[string]any{"id": id})
+		}
+		return out
+	}
+
+	cases := []struct {
+		name     string
+		retain   Retain
+		existing []map[string]any
+		data     []map[string]any
+		exp      []map[string]any
+		expLen   int
+	}{
+		{
+			name:     "zero value replaces",
+			retain:   Retain{},
+			existing: rows(1, 2),
+			data:     rows(3),
+			exp:      rows(3),
+			expLen:   1,
+		},
+		{
+			name:     "replace",
+			retain:   Retain{Mode: RetainReplace},
+			existing: rows(1, 2),
+			data:     rows(3),
+			exp:      rows(3),
+			expLen:   1,
+		},
+		{
+			name:     "append under size",
+			retain:   Retain{Mode: RetainAppend, Size: 5, Eviction: EvictFIFO},
+			existing: rows(1, 2),
+			data:     rows(3),
+			exp:      rows(1, 2, 3),
+			expLen:   3,
+		},
+		{
+			name:     "append fifo eviction",
+			retain:   Retain{Mode: RetainAppend, Size: 2, Eviction: EvictFIFO},
+			existing: rows(1, 2),
+			data:     rows(3, 4),
+			exp:      rows(3, 4),
+			expLen:   2,
+		},
+		{
+			name:     "consume fifo eviction",
+			retain:   Retain{Mode: RetainConsume, Size: 3, Eviction: EvictFIFO},
+			existing: rows(1, 2),
+			data:     rows(3, 4),
+			exp:      rows(2, 3, 4),
+			expLen:   3,
+		},
+		{
+			name:     "append random eviction",
+			retain:   Retain{Mode: RetainAppend, Size: 2, Eviction: EvictRandom},
+			existing: rows(1, 2),
+			data:     rows(3, 4),
+			expLen:   2,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act := c.retain.apply(newRand(), c.existing, c.data)
+
+			assert.Len(t, act, c.expLen)
+			if c.exp != nil {
+				assert.Equal(t, c.exp, act)
+			}
+		})
+	}
+}
+
+func TestApplyDataConsume(t *testing.T) {
+	vu := NewVU(&zerolog.Logger{})
+
+	retain := Retain{Mode: RetainConsume, Size: 10, Eviction: EvictFIFO}
+	vu.applyData("create", retain, []map[string]any{{"id": "a"}})
+	vu.applyData("create", retain, []map[string]any{{"id": "b"}})
+
+	_, dep, err := parseArgTypeRef(map[string]any{
+		"query":  "create",
+		"column": "id",
+	})
+	assert.NoError(t, err)
+
+	arg := Arg{refQuery: "create", refColumn: "id"}
+
+	var seen []any
+	for dep(vu) {
+		values, _, err := vu.generateArgs([]Arg{arg})
+		assert.NoError(t, err)
+		seen = append(seen, values...)
+	}
+
+	assert.ElementsMatch(t, []any{"a", "b"}, seen)
+	assert.Empty(t, vu.data["create"])
+}
+
+func TestApplyDataConsumeConcurrent(t *testing.T) {
+	vu := NewVU(&zerolog.Logger{})
+
+	var rows []map[string]any
+	for i := range 1000 {
+		rows = append(rows, map[string]any{"id": i})
+	}
+	vu.applyData("create", Retain{Mode: RetainConsume, Size: len(rows), Eviction: EvictFIFO}, rows)
+
+	arg := Arg{refQuery: "create", refColumn: "id"}
+
+	var mu sync.Mutex
+	var seen []any
+
+	var wg sync.WaitGroup
+	for range 10 {
+		activity := vu.withRand(newRand())
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				values, _, err := activity.generateArgs([]Arg{arg})
+				if err != nil {
+					return
+				}
+
+				mu.Lock()
+				seen = append(seen, values...)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, len(rows))
+	assert.Len(t, lo.Uniq(seen), len(rows))
+	assert.Empty(t, vu.data["create"])
+}
+
+func TestGenerateArgsSameRow(t *testing.T) {
+	vu := NewVU(&zerolog.Logger{})
+
+	retain := Retain{Mode: RetainConsume, Size: 10, Eviction: EvictFIFO}
+	vu.applyData("create", retain, []map[string]any{
+		{"id": 1, "name": "a"},
+		{"id": 2, "name": "b"},
+		{"id": 3, "name": "c"},
+	})
+
+	args := []Arg{
+		{refQuery: "create", refColumn: "id"},
+		{refQuery: "create", refColumn: "name"},
+	}
+
+	for range 10 {
+		values, picked, err := vu.generateArgs(args)
+		assert.NoError(t, err)
+
+		assert.Contains(t, [][]any{{1, "a"}, {2, "b"}, {3, "c"}}, values)
+		assert.Len(t, vu.data["create"], 2)
+
+		vu.restoreRows(picked)
+		assert.Len(t, vu.data["create"], 3)
+	}
+}
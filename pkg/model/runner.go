@@ -1,34 +1,94 @@
 package model
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/codingconcepts/drk/pkg/repo"
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
 const (
 	initWorkflow = "init"
+
+	// defaultConnection is the name the default connection's pool stats
+	// are reported under.
+	defaultConnection = "default"
+
+	// SessionShared runs each statement on any connection from the pool.
+	SessionShared = "shared"
+
+	// SessionSticky gives each VU a dedicated connection for its lifetime.
+	SessionSticky = "sticky"
 )
 
 type Runner struct {
-	db       repo.Queryer
-	cfg      *Drk
-	duration time.Duration
-	events   chan Event
-	logger   *zerolog.Logger
+	db          repo.Queryer
+	driver      string
+	connections map[string]repo.Queryer
+	cfg         *Drk
+	duration    time.Duration
+	logger      *zerolog.Logger
+
+	// Stream of events fanned out to the sinks, closed once the run has
+	// finished. Control requests and schema changes can emit events
+	// after that, so sends and the close are guarded by eventsMu.
+	eventsMu     sync.RWMutex
+	events       chan Event
+	eventsClosed bool
+
+	// Functions called once the run has finished, before the event
+	// stream is closed.
+	onStop []func()
+
+	tracer trace.Tracer
+	sinks  []*sink
+
+	// Number of events discarded because the event stream was full.
+	droppedEvents atomic.Int64
+
+	// Per-VU results of each query, harvested by Harvest.
+	aggregatorsMu sync.Mutex
+	aggregators   []*aggregator
+	started       atomic.Pointer[time.Time]
+
+	// Live controls, see control.go.
+	stopped        chan struct{}
+	stopOnce       sync.Once
+	paused         atomic.Bool
+	rateMultiplier atomic.Uint64
+	ddl            ddlTracker
+
+	// Live state of each running workflow, see workflow.go.
+	workflowsMu sync.Mutex
+	workflows   map[string]*workflowState
+
+	// Number of VUs running each workflow's activities.
+	activeVUsMu sync.Mutex
+	activeVUs   map[string]*atomic.Int64
 }
 
 func NewRunner(cfg *Drk, db repo.Queryer, url, driver string, duration time.Duration, logger *zerolog.Logger) (*Runner, error) {
 	r := Runner{
-		db:       db,
-		cfg:      cfg,
-		duration: duration,
-		events:   make(chan Event, 1000),
-		logger:   logger,
+		db:          db,
+		driver:      driver,
+		connections: map[string]repo.Queryer{},
+		cfg:         cfg,
+		duration:    duration,
+		events:      make(chan Event, 1000),
+		logger:      logger,
+		activeVUs:   map[string]*atomic.Int64{},
+		stopped:     make(chan struct{}),
+		tracer:      noopTracer,
 	}
 
 	logger.Info().Float64("duration", r.duration.Seconds()).Msgf("runner")
@@ -36,9 +96,39 @@ func NewRunner(cfg *Drk, db repo.Queryer, url, driver string, duration time.Dura
 	return &r, nil
 }
 
+// Run runs each workflow until the runner's duration has elapsed, then
+// waits for its sinks to consume the remaining events.
 func (r *Runner) Run() error {
+	start := time.Now()
+	r.started.Store(&start)
+
+	waitForSinks := r.startSinks()
+
+	err := r.run()
+
+	for _, f := range r.onStop {
+		f()
+	}
+	r.closeEvents()
+
+	return errors.Join(err, waitForSinks())
+}
+
+func (r *Runner) run() error {
 	var eg errgroup.Group
 
+	if err := r.validateSettings(); err != nil {
+		return err
+	}
+
+	if err := r.validateAsOf(); err != nil {
+		return err
+	}
+
+	if err := r.validateVars(); err != nil {
+		return err
+	}
+
 	// Run init workflow if provided, using a single VU.
 	init, ok := r.cfg.Workflows[initWorkflow]
 	if ok {
@@ -51,7 +141,17 @@ func (r *Runner) Run() error {
 		}
 	}
 
+	select {
+	case <-r.stopped:
+		return nil
+	default:
+	}
+
 	for name, workflow := range r.cfg.Workflows {
+		if name == initWorkflow {
+			continue
+		}
+
 		eg.Go(func() error {
 			return r.runWorkflow(name, workflow)
 		})
@@ -60,25 +160,121 @@ func (r *Runner) Run() error {
 	return eg.Wait()
 }
 
-func (r *Runner) GetEventStream() <-chan Event {
-	return r.events
+// validateVars checks that each workflow's vars can be initialised,
+// rather than failing every VU that tries.
+func (r *Runner) validateVars() error {
+	for name, workflow := range r.cfg.Workflows {
+		if _, err := varOrder(workflow.Vars); err != nil {
+			return fmt.Errorf("validating vars for workflow %q: %w", name, err)
+		}
+	}
+
+	return nil
 }
 
-func (r *Runner) runWorkflow(name string, workflow Workflow) error {
-	var eg errgroup.Group
+// ActiveVUs returns the number of VUs currently running each workflow's
+// activities, excluding those still running setup queries.
+func (r *Runner) ActiveVUs() map[string]int {
+	r.activeVUsMu.Lock()
+	defer r.activeVUsMu.Unlock()
 
-	for vu := 0; vu < workflow.Vus; vu++ {
-		eg.Go(func() error {
-			return r.runVU(name, workflow)
-		})
+	out := make(map[string]int, len(r.activeVUs))
+	for name, n := range r.activeVUs {
+		out[name] = int(n.Load())
 	}
 
-	return eg.Wait()
+	return out
+}
+
+func (r *Runner) activeVUCounter(workflowName string) *atomic.Int64 {
+	r.activeVUsMu.Lock()
+	defer r.activeVUsMu.Unlock()
+
+	n, ok := r.activeVUs[workflowName]
+	if !ok {
+		n = &atomic.Int64{}
+		r.activeVUs[workflowName] = n
+	}
+
+	return n
+}
+
+// PoolStats returns the stats of the connection pools behind the default
+// connection, keyed as "default", and each named connection, further
+// keyed by node.
+func (r *Runner) PoolStats() map[string]map[string]repo.PoolStats {
+	out := map[string]map[string]repo.PoolStats{}
+
+	if p, ok := r.db.(repo.PoolStatser); ok {
+		out[defaultConnection] = p.PoolStats()
+	}
+
+	for name, db := range r.connections {
+		if p, ok := db.(repo.PoolStatser); ok {
+			out[name] = p.PoolStats()
+		}
+	}
+
+	return out
+}
+
+// AddConnection registers the Queryer for a named connection, which
+// workflows that target it will run their statements against.
+func (r *Runner) AddConnection(name string, db repo.Queryer) {
+	r.connections[name] = db
+}
+
+// target returns the Queryer and driver a workflow's statements should
+// be run with.
+func (r *Runner) target(workflow Workflow) (repo.Queryer, string, error) {
+	if workflow.Connection == "" {
+		return r.db, r.driver, nil
+	}
+
+	db, ok := r.connections[workflow.Connection]
+	if !ok {
+		return nil, "", fmt.Errorf("missing connection: %q", workflow.Connection)
+	}
+
+	driver := r.driver
+	if conn, ok := r.cfg.Connections[workflow.Connection]; ok && conn.Driver != "" {
+		driver = conn.Driver
+	}
+
+	return db, driver, nil
 }
 
-func (r *Runner) runVU(workflowName string, workflow Workflow) error {
+// runVU runs a workflow's setup queries and then its activities, until
+// the given duration has elapsed or the VU is stopped.
+func (r *Runner) runVU(ws *workflowState, index int, stop <-chan struct{}, duration time.Duration) error {
+	workflowName, workflow := ws.name, ws.workflow
+
 	// Prepare VU.
-	vu := NewVU(r.logger)
+	db, driver, err := r.target(workflow)
+	if err != nil {
+		return err
+	}
+
+	vu := NewVU(r.logger).withRand(vuRand(workflowName, index, ""))
+	vu.index = index
+	vu.db = db
+	vu.driver = driver
+	vu.connection = workflow.Connection
+	if b, ok := db.(repo.Balancer); ok {
+		vu.db = b.ForVU(workflow.Locality)
+	}
+
+	closeSession, err := r.openSession(vu, workflowName, workflow, index)
+	if err != nil {
+		return fmt.Errorf("opening session: %w", err)
+	}
+	defer closeSession()
+
+	// Sticky sessions have their workflow's settings applied when they're
+	// opened, otherwise they're applied to each statement.
+	if workflow.Session != SessionSticky {
+		vu.settings = statementSettings(workflowName, workflow, driver)
+	}
 
 	for _, query := range workflow.SetupQueries {
 		act, ok := r.cfg.Activities[query]
@@ -86,22 +282,53 @@ func (r *Runner) runVU(workflowName string, workflow Workflow) error {
 			return fmt.Errorf("missing activity: %q", query)
 		}
 
-		data, taken, err := r.runQuery(vu, act)
-		if err != nil {
+		agg := r.newAggregator("*"+workflowName, query, act)
+
+		ddlDone := r.trackDDL("*"+workflowName, query, act)
+		data, stats, err := r.runQuery(context.Background(), vu, act)
+		ddlDone(err)
+		agg.record(stats, err)
+
+		// Failed assertions are counted against the setup query rather
+		// than stopping the run, as they are for any other activity.
+		var assertionErr AssertionErr
+		if err != nil && !errors.As(err, &assertionErr) {
 			return fmt.Errorf("running query %q: %w", query, err)
 		}
 
-		r.events <- Event{Workflow: "*" + workflowName, Name: query, Duration: taken}
-		vu.applyData(query, data)
+		r.emit(Event{Workflow: "*" + workflowName, Name: query, Duration: stats.Query, Wait: stats.Wait, Node: stats.Node, Connection: vu.connection, Stale: act.AsOf != "", Err: err})
+		if err != nil {
+			r.logger.Error().Str("query", query).Msgf("error: %v", err)
+			continue
+		}
+
+		vu.applyData(query, act.Retain, data)
+
+		if err = vu.captureVars(act.Capture, data); err != nil {
+			return fmt.Errorf("capturing vars for query %q: %w", query, err)
+		}
+	}
+
+	// Initialise VU-local variables, which may reference setup query data.
+	if err := vu.initVars(workflow.Vars); err != nil {
+		return fmt.Errorf("initialising vars: %w", err)
 	}
 
 	// Stagger VU.
 	vu.stagger(workflow.Queries)
 
 	// Start VU.
+	active := r.activeVUCounter(workflowName)
+	active.Add(1)
+	defer active.Add(-1)
+
 	var eg errgroup.Group
 
-	deadline := time.After(r.duration)
+	// Every activity stops at the deadline, so it's closed rather than
+	// sent to.
+	deadline := make(chan struct{})
+	timer := time.AfterFunc(duration, func() { close(deadline) })
+	defer timer.Stop()
 
 	for _, query := range workflow.Queries {
 		act, ok := r.cfg.Activities[query.Name]
@@ -109,64 +336,243 @@ func (r *Runner) runVU(workflowName string, workflow Workflow) error {
 			return fmt.Errorf("missing activity: %q", query)
 		}
 
+		agg := r.newAggregator(workflowName, query.Name, act)
+
+		// Activities run concurrently, so each draws random values from
+		// a source of its own.
+		avu := vu.withRand(vuRand(workflowName, index, query.Name))
+
 		eg.Go(func() error {
-			return r.runActivity(vu, workflowName, query.Name, act, query.Rate, deadline)
+			return r.runActivity(avu, agg, ws, query.Name, act, query.Rate, deadline, stop)
 		})
 	}
 
 	return eg.Wait()
 }
 
-func (r *Runner) runActivity(vu *VU, workflowName, queryName string, query Query, rate Rate, fin <-chan time.Time) error {
-	ticks := time.NewTicker(rate.tickerInterval).C
+// openSession gives a VU a dedicated connection for its lifetime if its
+// workflow uses sticky sessions, running the workflow's session
+// initialisation statements against it, and again against the connection
+// that replaces it if it breaks. The returned function releases the
+// connection.
+func (r *Runner) openSession(vu *VU, workflowName string, workflow Workflow, index int) (func(), error) {
+	switch workflow.Session {
+	case "", SessionShared:
+		return func() {}, nil
+
+	case SessionSticky:
+		s, ok := vu.db.(repo.Sessioner)
+		if !ok {
+			return nil, fmt.Errorf("connection doesn't support sticky sessions")
+		}
+
+		settings, err := setStatements(workflowSettings(workflowName, workflow), false)
+		if err != nil {
+			return nil, err
+		}
+
+		replacer := strings.NewReplacer(
+			"{workflow}", workflowName,
+			"{vu}", strconv.Itoa(index),
+		)
+
+		// Sessions are initialised again whenever they're reopened after
+		// their connection breaks.
+		initSession := func(q repo.Queryer) error {
+			for _, stmt := range settings {
+				if _, err := q.Exec(stmt); err != nil {
+					return fmt.Errorf("applying session setting: %w", err)
+				}
+			}
+
+			for _, stmt := range workflow.SessionInit {
+				if _, err := q.Exec(replacer.Replace(stmt)); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		sess, err := repo.NewReconnectingSession(s.Session, initSession)
+		if err != nil {
+			return nil, err
+		}
+
+		closeSession := func() {
+			if err := sess.Close(); err != nil {
+				r.logger.Error().Str("workflow", workflowName).Msgf("error closing session: %v", err)
+			}
+		}
+
+		vu.db = sess
+		return closeSession, nil
+
+	default:
+		return nil, fmt.Errorf("invalid session mode: %q", workflow.Session)
+	}
+}
+
+func (r *Runner) runActivity(vu *VU, agg *aggregator, ws *workflowState, queryName string, query Query, rate Rate, fin, stop <-chan struct{}) error {
+	workflowName := ws.name
 
+	multiplier := r.RateMultiplier() * ws.rateMultiplier(queryName)
+	ticker := time.NewTicker(scaleInterval(rate.tickerInterval, multiplier))
+	defer ticker.Stop()
+
+	var attempt int
 	for {
 		select {
-		case <-ticks:
+		case <-ticker.C:
+			if m := r.RateMultiplier() * ws.rateMultiplier(queryName); m != multiplier {
+				multiplier = m
+				ticker.Reset(scaleInterval(rate.tickerInterval, multiplier))
+			}
+
+			if r.Paused() || ws.paused.Load() {
+				continue
+			}
+
 			depencenciesMet := lo.EveryBy(query.Args, func(a Arg) bool {
 				return a.dependencyCheck(vu)
 			})
 			if !depencenciesMet {
+				agg.skip()
 				continue
 			}
 
 			r.logger.Debug().Str("query", queryName).Msg("starting")
 
-			data, taken, err := r.runQuery(vu, query)
+			attempt++
+			ctx, span := r.startActivitySpan(vu, workflowName, queryName, attempt)
+
+			ddlDone := r.trackDDL(workflowName, queryName, query)
+			data, stats, err := r.runQuery(ctx, vu, query)
+			ddlDone(err)
+			endActivitySpan(span, len(data), err)
+
+			agg.record(stats, err)
+			r.emit(Event{Workflow: workflowName, Name: queryName, Duration: stats.Query, Wait: stats.Wait, Node: stats.Node, Connection: vu.connection, Stale: query.AsOf != "", Err: err})
+
 			if err != nil {
 				r.logger.Error().Str("query", queryName).Msgf("error: %v", err)
 				continue
 			}
 			r.logger.Debug().Str("query", queryName).Msgf("[DATA] %+v", data)
+			vu.applyData(queryName, query.Retain, data)
 
-			r.events <- Event{Workflow: workflowName, Name: queryName, Duration: taken}
-			vu.applyData(queryName, data)
+			if err = vu.captureVars(query.Capture, data); err != nil {
+				r.logger.Error().Str("query", queryName).Msgf("error: %v", err)
+			}
 
 		case <-fin:
 			r.logger.Info().Str("query", queryName).Msg("received termination signal")
 			return nil
+
+		case <-stop:
+			r.logger.Info().Str("query", queryName).Msg("vu stopped")
+			return nil
+
+		case <-r.stopped:
+			r.logger.Info().Str("query", queryName).Msg("run stopped")
+			return nil
 		}
 	}
 }
 
-func (r *Runner) runQuery(vu *VU, query Query) ([]map[string]any, time.Duration, error) {
-	args, err := vu.generateArgs(query.Args)
+// emit publishes an event to the runner's sinks, discarding it if the
+// event stream is full so that VUs never wait on a slow consumer.
+func (r *Runner) emit(e Event) {
+	r.eventsMu.RLock()
+	defer r.eventsMu.RUnlock()
+
+	if r.eventsClosed {
+		r.droppedEvents.Add(1)
+		return
+	}
+
+	select {
+	case r.events <- e:
+	default:
+		r.droppedEvents.Add(1)
+	}
+}
+
+// closeEvents closes the event stream, after which events are dropped.
+func (r *Runner) closeEvents() {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+
+	r.eventsClosed = true
+	close(r.events)
+}
+
+// OnStop registers a function to call once the run has finished, before
+// its sinks receive their last events, e.g. to stop serving requests
+// that change the run. It must be called before the run starts.
+func (r *Runner) OnStop(f func()) {
+	r.onStop = append(r.onStop, f)
+}
+
+func (r *Runner) runQuery(ctx context.Context, vu *VU, query Query) ([]map[string]any, repo.Stats, error) {
+	args, picked, err := vu.generateArgs(query.Args)
 	if err != nil {
-		return nil, 0, fmt.Errorf("generating args: %w", err)
+		return nil, repo.Stats{}, fmt.Errorf("generating args: %w", err)
 	}
 
-	r.logger.Debug().Msgf("[STMT] %s", query.Query)
-	r.logger.Debug().Msgf("\t[ARGS] %v", args)
+	stmt := query.statement(vu.driver)
+	bound := stmt.bind(args)
 
-	switch query.Type {
-	case "query":
-		return r.db.Query(query.Query, args...)
+	r.logger.Debug().Msgf("[STMT] %s", stmt.query)
+	r.logger.Debug().Msgf("\t[ARGS] %v", bound)
 
-	case "exec":
-		taken, err := r.db.Exec(query.Query, args...)
-		return nil, taken, err
+	db := r.db
+	if vu.db != nil {
+		db = vu.db
+	}
 
-	default:
-		return nil, 0, fmt.Errorf("unsupported query type: %q", query.Type)
+	run := func(q repo.Queryer) ([]map[string]any, repo.Stats, error) {
+		switch query.Type {
+		case "query":
+			return q.Query(stmt.query, bound...)
+
+		case "exec":
+			stats, err := q.Exec(stmt.query, bound...)
+			return nil, stats, err
+
+		default:
+			return nil, repo.Stats{}, fmt.Errorf("unsupported query type: %q", query.Type)
+		}
 	}
+
+	var data []map[string]any
+	var stats repo.Stats
+
+	span := r.startStatementSpan(ctx, vu, stmt, bound)
+
+	settings := lo.Assign(vu.settings, query.SessionSettings)
+	if len(settings) > 0 || stmt.asOf != "" {
+		begin := "BEGIN"
+		if stmt.asOf != "" {
+			begin = "BEGIN AS OF SYSTEM TIME " + stmt.asOf
+		}
+
+		data, stats, err = r.runInTx(db, begin, settings, run)
+	} else {
+		data, stats, err = run(db)
+	}
+
+	endStatementSpan(span, stats, err)
+	if err != nil {
+		vu.restoreRows(picked)
+		return nil, stats, err
+	}
+
+	// Return the data alongside a failed assertion, so that the rows
+	// that failed it can be reported.
+	if err = query.Expect.check(data, stats, args); err != nil {
+		return data, stats, err
+	}
+
+	return data, stats, nil
 }
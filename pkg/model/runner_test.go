@@ -1,11 +1,14 @@
 package model
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/codingconcepts/drk/pkg/repo"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 )
@@ -14,8 +17,8 @@ func TestRunQuery(t *testing.T) {
 	cases := []struct {
 		name      string
 		query     Query
-		queryImpl func(string, ...any) ([]map[string]any, time.Duration, error)
-		execImpl  func(string, ...any) (time.Duration, error)
+		queryImpl func(string, ...any) ([]map[string]any, repo.Stats, error)
+		execImpl  func(string, ...any) (repo.Stats, error)
 		exp       []map[string]any
 		expError  error
 	}{
@@ -44,8 +47,8 @@ func TestRunQuery(t *testing.T) {
 			query: Query{
 				Type: "query",
 			},
-			queryImpl: func(s string, a ...any) ([]map[string]any, time.Duration, error) {
-				return nil, 0, fmt.Errorf("bad things happened")
+			queryImpl: func(s string, a ...any) ([]map[string]any, repo.Stats, error) {
+				return nil, repo.Stats{}, fmt.Errorf("bad things happened")
 			},
 			expError: errors.New("bad things happened"),
 		},
@@ -54,8 +57,8 @@ func TestRunQuery(t *testing.T) {
 			query: Query{
 				Type: "exec",
 			},
-			execImpl: func(s string, a ...any) (time.Duration, error) {
-				return 0, fmt.Errorf("bad things happened")
+			execImpl: func(s string, a ...any) (repo.Stats, error) {
+				return repo.Stats{}, fmt.Errorf("bad things happened")
 			},
 			expError: errors.New("bad things happened"),
 		},
@@ -64,12 +67,12 @@ func TestRunQuery(t *testing.T) {
 			query: Query{
 				Type: "query",
 			},
-			queryImpl: func(s string, a ...any) ([]map[string]any, time.Duration, error) {
+			queryImpl: func(s string, a ...any) ([]map[string]any, repo.Stats, error) {
 				return []map[string]any{
 					{"id": "a", "age": 1},
 					{"id": "b", "age": 2},
 					{"id": "c", "age": 3},
-				}, 0, nil
+				}, repo.Stats{}, nil
 			},
 			exp: []map[string]any{
 				{"id": "a", "age": 1},
@@ -82,10 +85,32 @@ func TestRunQuery(t *testing.T) {
 			query: Query{
 				Type: "exec",
 			},
-			execImpl: func(s string, a ...any) (time.Duration, error) {
-				return 0, nil
+			execImpl: func(s string, a ...any) (repo.Stats, error) {
+				return repo.Stats{}, nil
 			},
 		},
+		{
+			name: "query fails assertion",
+			query: Query{
+				Type:   "query",
+				Expect: Expect{Rows: &Count{Min: 1, Max: 1}},
+			},
+			queryImpl: func(s string, a ...any) ([]map[string]any, repo.Stats, error) {
+				return nil, repo.Stats{}, nil
+			},
+			expError: AssertionErr{Reason: "expected 1 rows, got 0"},
+		},
+		{
+			name: "exec fails assertion",
+			query: Query{
+				Type:   "exec",
+				Expect: Expect{RowsAffected: &Count{Min: 1, Max: 1}},
+			},
+			execImpl: func(s string, a ...any) (repo.Stats, error) {
+				return repo.Stats{RowsAffected: 2}, nil
+			},
+			expError: AssertionErr{Reason: "expected 1 rows affected, got 2"},
+		},
 	}
 
 	for _, c := range cases {
@@ -99,7 +124,7 @@ func TestRunQuery(t *testing.T) {
 			assert.NoError(t, err)
 
 			vu := NewVU(&zerolog.Logger{})
-			act, _, err := r.runQuery(vu, c.query)
+			act, _, err := r.runQuery(context.Background(), vu, c.query)
 
 			if c.expError != nil {
 				assert.Equal(t, c.expError, err)
@@ -110,3 +135,389 @@ func TestRunQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestRunQueryConsume(t *testing.T) {
+	var fail bool
+	queryer := mockQueryer{
+		exec: func(string, ...any) (repo.Stats, error) {
+			if fail {
+				return repo.Stats{}, errors.New("bad things happened")
+			}
+			return repo.Stats{}, nil
+		},
+	}
+
+	r, err := NewRunner(nil, &queryer, "", "", 0, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	vu := NewVU(&zerolog.Logger{})
+	vu.applyData("create", Retain{Mode: RetainConsume, Size: 10}, []map[string]any{{"id": "a"}})
+
+	query := Query{
+		Type: "exec",
+		Args: []Arg{{refQuery: "create", refColumn: "id"}},
+	}
+
+	// Rows aren't consumed by statements that fail.
+	fail = true
+	_, _, err = r.runQuery(context.Background(), vu, query)
+	assert.Error(t, err)
+	assert.Len(t, vu.data["create"], 1)
+
+	fail = false
+	_, _, err = r.runQuery(context.Background(), vu, query)
+	assert.NoError(t, err)
+	assert.Empty(t, vu.data["create"])
+}
+
+func TestTarget(t *testing.T) {
+	defaultDB := &mockQueryer{}
+	euDB := &mockQueryer{}
+	usDB := &mockQueryer{}
+
+	cfg := Drk{
+		Connections: map[string]Connection{
+			"eu": {Driver: "mysql"},
+			"us": {},
+		},
+	}
+
+	r, err := NewRunner(&cfg, defaultDB, "", "pgx", 0, &zerolog.Logger{})
+	assert.NoError(t, err)
+	r.AddConnection("eu", euDB)
+	r.AddConnection("us", usDB)
+
+	cases := []struct {
+		name      string
+		workflow  Workflow
+		expDB     repo.Queryer
+		expDriver string
+		expErr    error
+	}{
+		{
+			name:      "default connection",
+			workflow:  Workflow{},
+			expDB:     defaultDB,
+			expDriver: "pgx",
+		},
+		{
+			name:      "named connection with driver",
+			workflow:  Workflow{Connection: "eu"},
+			expDB:     euDB,
+			expDriver: "mysql",
+		},
+		{
+			name:      "named connection without driver",
+			workflow:  Workflow{Connection: "us"},
+			expDB:     usDB,
+			expDriver: "pgx",
+		},
+		{
+			name:     "missing connection",
+			workflow: Workflow{Connection: "ap"},
+			expErr:   fmt.Errorf("missing connection: \"ap\""),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db, driver, err := r.target(c.workflow)
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Same(t, c.expDB, db)
+			assert.Equal(t, c.expDriver, driver)
+		})
+	}
+}
+
+func TestOpenSession(t *testing.T) {
+	cases := []struct {
+		name     string
+		workflow Workflow
+		db       repo.Queryer
+		expStmts []string
+		expErr   error
+	}{
+		{
+			name:     "shared session",
+			workflow: Workflow{},
+			db:       &mockQueryer{},
+		},
+		{
+			name: "sticky session",
+			workflow: Workflow{
+				Session: SessionSticky,
+				SessionInit: []string{
+					"SET default_transaction_priority = 'high'",
+					"SET application_name = 'drk-{workflow}-{vu}'",
+				},
+			},
+			db: &mockSessioner{},
+			expStmts: []string{
+				"SET application_name = 'drk/shopper'",
+				"SET default_transaction_priority = 'high'",
+				"SET application_name = 'drk-shopper-3'",
+			},
+		},
+		{
+			name:     "sticky session unsupported",
+			workflow: Workflow{Session: SessionSticky},
+			db:       &mockQueryer{},
+			expErr:   errors.New("connection doesn't support sticky sessions"),
+		},
+		{
+			name:     "invalid session mode",
+			workflow: Workflow{Session: "invalid"},
+			db:       &mockQueryer{},
+			expErr:   errors.New(`invalid session mode: "invalid"`),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var stmts []string
+			sess := mockSession{
+				mockQueryer: mockQueryer{
+					exec: func(query string, args ...any) (repo.Stats, error) {
+						stmts = append(stmts, query)
+						return repo.Stats{}, nil
+					},
+				},
+			}
+
+			if s, ok := c.db.(*mockSessioner); ok {
+				s.session = func() (repo.Session, error) {
+					return &sess, nil
+				}
+			}
+
+			r, err := NewRunner(&Drk{}, c.db, "", "", 0, &zerolog.Logger{})
+			assert.NoError(t, err)
+
+			vu := NewVU(&zerolog.Logger{})
+			vu.db = c.db
+
+			closeSession, err := r.openSession(vu, "shopper", c.workflow, 3)
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expStmts, stmts)
+
+			closeSession()
+
+			if c.workflow.Session == SessionSticky {
+				assert.Implements(t, (*repo.Session)(nil), vu.db)
+				assert.True(t, sess.closed)
+			}
+		})
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	pool := func(inUse int) repo.Queryer {
+		return &mockPool{stats: map[string]repo.PoolStats{"node1": {MaxConns: 10, InUse: inUse}}}
+	}
+
+	r, err := NewRunner(&Drk{}, pool(1), "", "", 0, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	r.AddConnection("eu", pool(2))
+	r.AddConnection("us", &mockQueryer{})
+
+	assert.Equal(t, map[string]map[string]repo.PoolStats{
+		"default": {"node1": {MaxConns: 10, InUse: 1}},
+		"eu":      {"node1": {MaxConns: 10, InUse: 2}},
+	}, r.PoolStats())
+}
+
+func TestActiveVUs(t *testing.T) {
+	r, err := NewRunner(nil, &mockQueryer{}, "", "", 0, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]int{}, r.ActiveVUs())
+
+	r.activeVUCounter("a").Add(2)
+	r.activeVUCounter("b").Add(1)
+	r.activeVUCounter("a").Add(-1)
+
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, r.ActiveVUs())
+}
+
+func TestRunVUSetupAssertion(t *testing.T) {
+	cfg := Drk{
+		Activities: map[string]Query{
+			"check": {Type: "query", Query: "SELECT 1", Expect: Expect{Rows: &Count{Min: 1, Max: 1}}},
+		},
+	}
+
+	db := mockQueryer{
+		query: func(string, ...any) ([]map[string]any, repo.Stats, error) {
+			return nil, repo.Stats{}, nil
+		},
+	}
+
+	r, err := NewRunner(&cfg, &db, "", "", 10*time.Millisecond, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	// A failed setup assertion is counted, rather than stopping the run.
+	assert.NoError(t, r.runWorkflow("shop", Workflow{Vus: 1, SetupQueries: []string{"check"}}))
+
+	stats := r.Harvest()
+	assert.Len(t, stats, 1)
+	assert.Equal(t, "*shop", stats[0].Workflow)
+	assert.Equal(t, 1, stats[0].AssertionFailures)
+}
+
+func TestRunInitWorkflow(t *testing.T) {
+	cfg := Drk{
+		Workflows: map[string]Workflow{
+			"init": {SetupQueries: []string{"create"}},
+		},
+		Activities: map[string]Query{
+			"create": {Type: "exec", Query: "CREATE TABLE t (id INT)"},
+		},
+	}
+
+	var stmts []string
+	db := mockQueryer{
+		exec: func(query string, args ...any) (repo.Stats, error) {
+			stmts = append(stmts, query)
+			return repo.Stats{}, nil
+		},
+	}
+
+	r, err := NewRunner(&cfg, &db, "", "", time.Minute, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	var events []string
+	assert.NoError(t, r.AddSink("test", SinkFunc(func(in <-chan Event) error {
+		for e := range in {
+			events = append(events, e.Name)
+		}
+		return nil
+	}), SinkOptions{Drop: DropNone}))
+
+	// Changes made as the run stops are still published.
+	r.OnStop(func() {
+		r.control("init", "pause", "")
+	})
+
+	// The init workflow finishes once its setup queries have run, rather
+	// than being kept alive for the run's duration, and runs only once.
+	start := time.Now()
+	assert.NoError(t, r.Run())
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	assert.Equal(t, []string{"CREATE TABLE t (id INT)"}, stmts)
+	assert.Equal(t, []string{"create", "pause"}, events)
+
+	// Events emitted once the run has finished are dropped.
+	r.control("init", "resume", "")
+	assert.Equal(t, int64(1), r.DroppedEvents()[runnerSink])
+}
+
+func TestRunStop(t *testing.T) {
+	rate := Rate{Times: 1, Interval: 10 * time.Millisecond, tickerInterval: 10 * time.Millisecond}
+
+	cfg := Drk{
+		Workflows: map[string]Workflow{
+			"shop": {
+				Vus:     2,
+				Queries: []WorkflowQuery{{Name: "browse", Rate: rate}, {Name: "buy", Rate: rate}},
+			},
+		},
+		Activities: map[string]Query{
+			"browse": {Type: "query", Query: "SELECT 1"},
+			"buy":    {Type: "exec", Query: "INSERT INTO t VALUES (1)"},
+		},
+	}
+
+	var statements atomic.Int64
+	db := mockQueryer{
+		query: func(string, ...any) ([]map[string]any, repo.Stats, error) {
+			statements.Add(1)
+			return nil, repo.Stats{}, nil
+		},
+		exec: func(string, ...any) (repo.Stats, error) {
+			statements.Add(1)
+			return repo.Stats{}, nil
+		},
+	}
+
+	r, err := NewRunner(&cfg, &db, "", "", time.Hour, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	var stopped atomic.Bool
+	r.OnStop(func() {
+		stopped.Store(true)
+	})
+
+	finished := make(chan error)
+	go func() {
+		finished <- r.Run()
+	}()
+
+	assert.Eventually(t, func() bool { return statements.Load() > 0 }, 5*time.Second, time.Millisecond)
+
+	// Stopping is idempotent, and every activity of every VU stops.
+	r.Stop()
+	r.Stop()
+
+	select {
+	case err = <-finished:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("run didn't stop")
+	}
+
+	assert.True(t, stopped.Load())
+	assert.Error(t, r.SetVUs("shop", 3))
+}
+
+func TestRunDeadline(t *testing.T) {
+	rate := Rate{Times: 1, Interval: 10 * time.Millisecond, tickerInterval: 10 * time.Millisecond}
+
+	cfg := Drk{
+		Workflows: map[string]Workflow{
+			"shop": {
+				Vus:     1,
+				Queries: []WorkflowQuery{{Name: "browse", Rate: rate}, {Name: "buy", Rate: rate}},
+			},
+		},
+		Activities: map[string]Query{
+			"browse": {Type: "query", Query: "SELECT 1"},
+			"buy":    {Type: "exec", Query: "INSERT INTO t VALUES (1)"},
+		},
+	}
+
+	db := mockQueryer{
+		query: func(string, ...any) ([]map[string]any, repo.Stats, error) {
+			return nil, repo.Stats{}, nil
+		},
+		exec: func(string, ...any) (repo.Stats, error) {
+			return repo.Stats{}, nil
+		},
+	}
+
+	r, err := NewRunner(&cfg, &db, "", "", 100*time.Millisecond, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	// Each of a VU's activities stops once the duration has elapsed.
+	finished := make(chan error)
+	go func() {
+		finished <- r.Run()
+	}()
+
+	select {
+	case err = <-finished:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("run didn't finish")
+	}
+}
@@ -0,0 +1,326 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/random"
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/samber/lo"
+)
+
+// schemaDraft is the JSON Schema dialect the config schema is written in,
+// which is the one most editors support.
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+const (
+	// durationUnits matches the unsigned, non-zero durations accepted by
+	// time.ParseDuration, e.g. 1m30s.
+	durationUnits = `(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+`
+
+	durationPattern = `^[-+]?(0|` + durationUnits + `)$`
+	ratePattern     = `^[0-9]+/` + durationUnits + `$`
+)
+
+// typeSchemas are the schemas of types that decode themselves, and so
+// can't be derived from their fields.
+var typeSchemas = map[reflect.Type]func() map[string]any{
+	reflect.TypeOf(Arg{}):            argSchema,
+	reflect.TypeOf(Rate{}):           rateSchema,
+	reflect.TypeOf(Threshold{}):      thresholdSchema,
+	reflect.TypeOf(Retain{}):         retainSchema,
+	reflect.TypeOf(Count{}):          countSchema,
+	reflect.TypeOf(time.Duration(0)): durationSchema,
+}
+
+// fieldSchemas narrow the schemas of fields, by the name they're decoded
+// from, to the values drk accepts for them. Args decode themselves, so
+// "type" is only ever an activity's type.
+var fieldSchemas = map[string]func() map[string]any{
+	"type": func() map[string]any {
+		return enumSchema("query", "exec")
+	},
+	"load_balancing": func() map[string]any {
+		return enumSchema(repo.BalanceRoundRobin, repo.BalanceRandom, repo.BalanceLocality)
+	},
+	"session": func() map[string]any {
+		return enumSchema(SessionShared, SessionSticky)
+	},
+	"driver": func() map[string]any {
+		return enumSchema(sortedKeys(placeholderStyles)...)
+	},
+}
+
+// Schema returns a JSON Schema for config files, derived from the types
+// they're decoded into, for editors to validate and complete them with.
+func Schema() map[string]any {
+	b := schemaBuilder{defs: map[string]any{}}
+
+	root := b.structSchema(reflect.TypeOf(rawDrk{}))
+	root["$schema"] = schemaDraft
+	root["title"] = "drk config"
+	root["definitions"] = b.defs
+
+	return root
+}
+
+// WriteSchema writes the config schema as indented JSON.
+func WriteSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+
+	return enc.Encode(Schema())
+}
+
+// schemaBuilder derives schemas from types, collecting the schemas of
+// named types into definitions that are referenced wherever they're used.
+type schemaBuilder struct {
+	defs map[string]any
+}
+
+func (b *schemaBuilder) schemaFor(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		return b.schemaFor(t.Elem())
+	}
+
+	if fn, ok := typeSchemas[t]; ok {
+		if t.Kind() != reflect.Struct {
+			return fn()
+		}
+		return b.ref(t, fn)
+	}
+
+	// Types that decode themselves would otherwise be described by
+	// fields they don't decode from.
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		panic(fmt.Sprintf("no schema for %s, which decodes itself", t))
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return b.ref(t, func() map[string]any { return b.structSchema(t) })
+
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": b.schemaFor(t.Elem()),
+		}
+
+	case reflect.Slice:
+		return map[string]any{
+			"type":  "array",
+			"items": b.schemaFor(t.Elem()),
+		}
+
+	case reflect.String:
+		return map[string]any{"type": "string"}
+
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+
+	default:
+		// Any value is allowed.
+		return map[string]any{}
+	}
+}
+
+// ref adds the schema of a named type to the definitions, if it isn't
+// there already, and returns a reference to it.
+func (b *schemaBuilder) ref(t reflect.Type, fn func() map[string]any) map[string]any {
+	if _, ok := b.defs[t.Name()]; !ok {
+		// Reserve the name first, in case the type refers to itself.
+		b.defs[t.Name()] = nil
+		b.defs[t.Name()] = fn()
+	}
+
+	return map[string]any{"$ref": "#/definitions/" + t.Name()}
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	for name, ft := range yamlFields(t) {
+		if fn, ok := fieldSchemas[name]; ok {
+			properties[name] = fn()
+			continue
+		}
+		properties[name] = b.schemaFor(ft)
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// argSchema describes each type of arg by the fields in argFields, only
+// allowing and requiring the fields of the arg's type.
+func argSchema() map[string]any {
+	types := sortedKeys(argFields)
+
+	cases := lo.Map(types, func(argType string, _ int) any {
+		properties := map[string]any{
+			"type": map[string]any{"const": argType},
+			"name": map[string]any{"type": "string"},
+		}
+		required := []string{"type"}
+
+		for _, field := range argFields[argType] {
+			properties[field] = argFieldSchema(argType, field)
+			if field != "weights" {
+				required = append(required, field)
+			}
+		}
+
+		return map[string]any{
+			"if": map[string]any{
+				"properties": map[string]any{"type": map[string]any{"const": argType}},
+				"required":   []string{"type"},
+			},
+			"then": map[string]any{
+				"properties":           properties,
+				"required":             required,
+				"additionalProperties": false,
+			},
+		}
+	})
+
+	return map[string]any{
+		"type":     "object",
+		"required": []string{"type"},
+		"properties": map[string]any{
+			"type": enumSchema(types...),
+			"name": map[string]any{"type": "string"},
+		},
+		"allOf": cases,
+	}
+}
+
+func argFieldSchema(argType, field string) map[string]any {
+	switch field {
+	case "value":
+		switch argType {
+		case "gen":
+			return enumSchema(sortedKeys(random.Replacements)...)
+		case "var":
+			return map[string]any{"type": "string"}
+		default:
+			return map[string]any{}
+		}
+
+	case "values":
+		return map[string]any{"type": "array"}
+
+	case "weights":
+		return map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "integer"},
+		}
+
+	case "min", "max":
+		switch argType {
+		case "int":
+			return map[string]any{"type": "integer"}
+		case "float":
+			return map[string]any{"type": "number"}
+		case "timestamp":
+			return map[string]any{"type": "string", "format": "date-time"}
+		default:
+			return durationSchema()
+		}
+
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
+
+func rateSchema() map[string]any {
+	return map[string]any{
+		"type":        "string",
+		"description": "Number of times to run in an interval, e.g. 10/1s.",
+		"pattern":     ratePattern,
+	}
+}
+
+func thresholdSchema() map[string]any {
+	expr := map[string]any{
+		"type":        "string",
+		"description": `Condition on a metric of the matching queries, e.g. "create_purchase.p99 < 250ms".`,
+	}
+
+	return map[string]any{
+		"oneOf": []any{
+			expr,
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"threshold":     expr,
+					"abort_on_fail": map[string]any{"type": "boolean"},
+				},
+				"required":             []string{"threshold"},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func retainSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"mode":     enumSchema(RetainReplace, RetainAppend, RetainConsume),
+			"size":     map[string]any{"type": "integer", "minimum": 0},
+			"eviction": enumSchema(EvictFIFO, EvictRandom),
+		},
+		"additionalProperties": false,
+	}
+}
+
+func countSchema() map[string]any {
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "integer"},
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"min": map[string]any{"type": "integer"},
+					"max": map[string]any{"type": "integer"},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func durationSchema() map[string]any {
+	return map[string]any{
+		"type":    "string",
+		"pattern": durationPattern,
+	}
+}
+
+func enumSchema(values ...string) map[string]any {
+	return map[string]any{
+		"type": "string",
+		"enum": values,
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := lo.Keys(m)
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,209 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func compileSchema(t *testing.T) *jsonschema.Schema {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSchema(&buf))
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	assert.NoError(t, compiler.AddResource("drk.schema.json", &buf))
+
+	return compiler.MustCompile("drk.schema.json")
+}
+
+// yamlToJSON returns a config as the values it would have been decoded
+// into had it been written as JSON, as editors validate it.
+func yamlToJSON(t *testing.T, config []byte) any {
+	var raw any
+	assert.NoError(t, yaml.Unmarshal(config, &raw))
+
+	data, err := json.Marshal(raw)
+	assert.NoError(t, err)
+
+	var doc any
+	assert.NoError(t, json.Unmarshal(data, &doc))
+
+	return doc
+}
+
+func TestSchemaExamples(t *testing.T) {
+	schema := compileSchema(t)
+
+	paths, err := filepath.Glob("../../examples/*/drk.yaml")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		t.Run(filepath.Base(filepath.Dir(path)), func(t *testing.T) {
+			config, err := os.ReadFile(path)
+			assert.NoError(t, err)
+
+			assert.NoError(t, schema.Validate(yamlToJSON(t, config)))
+		})
+	}
+}
+
+func TestSchemaFile(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSchema(&buf))
+
+	shipped, err := os.ReadFile("../../drk.schema.json")
+	assert.NoError(t, err)
+
+	assert.Equal(t, buf.String(), string(shipped), "drk.schema.json is out of date, regenerate it with: go run drk.go schema --out drk.schema.json")
+}
+
+func TestSchema(t *testing.T) {
+	schema := compileSchema(t)
+
+	cases := []struct {
+		name   string
+		config string
+		expErr string
+	}{
+		{
+			name: "valid",
+			config: `
+workflows:
+  w:
+    vus: 1
+    session: sticky
+    queries:
+      - name: a
+        rate: 10/1m30s
+activities:
+  a:
+    type: query
+    args:
+      - type: gen
+        value: email
+      - type: set
+        values: [a, b]
+        weights: [1, 2]
+      - type: timestamp
+        min: 2024-01-01T00:00:00Z
+        max: 2025-01-01T00:00:00Z
+      - type: interval
+        min: 1m
+        max: 1h
+    retain:
+      mode: append
+    expect:
+      rows: {min: 1}
+    query: SELECT $1, $2, $3, $4
+pool:
+  max_conn_lifetime: 5m
+thresholds:
+  - a.p99 < 250ms
+  - threshold: "*.error_rate < 0.1%"
+    abort_on_fail: true`,
+		},
+		{
+			name: "unknown field",
+			config: `
+workflows:
+  w:
+    vu: 1`,
+			expErr: "/workflows/w",
+		},
+		{
+			name: "unknown generator",
+			config: `
+activities:
+  a:
+    args:
+      - type: gen
+        value: not_a_generator`,
+			expErr: "/activities/a/args/0/value",
+		},
+		{
+			name: "field of another arg type",
+			config: `
+activities:
+  a:
+    args:
+      - type: ref
+        query: b
+        column: id
+        value: id`,
+			expErr: "/activities/a/args/0",
+		},
+		{
+			name: "missing arg field",
+			config: `
+activities:
+  a:
+    args:
+      - type: int
+        min: 1`,
+			expErr: "/activities/a/args/0",
+		},
+		{
+			name: "invalid arg type",
+			config: `
+activities:
+  a:
+    args:
+      - type: flaot`,
+			expErr: "/activities/a/args/0/type",
+		},
+		{
+			name: "invalid rate",
+			config: `
+workflows:
+  w:
+    queries:
+      - name: a
+        rate: 10`,
+			expErr: "/workflows/w/queries/0/rate",
+		},
+		{
+			name: "invalid duration",
+			config: `
+pool:
+  max_conn_idle_time: 1 hour`,
+			expErr: "/pool/max_conn_idle_time",
+		},
+		{
+			name: "invalid activity type",
+			config: `
+activities:
+  a:
+    type: select`,
+			expErr: "/activities/a/type",
+		},
+		{
+			name: "invalid retain mode",
+			config: `
+activities:
+  a:
+    retain:
+      mode: keep`,
+			expErr: "/activities/a/retain/mode",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := schema.Validate(yamlToJSON(t, []byte(c.config)))
+			if c.expErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorContains(t, err, "'"+c.expErr+"'")
+		})
+	}
+}
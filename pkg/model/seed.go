@@ -0,0 +1,41 @@
+package model
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+)
+
+// seed is the value every VU's source of random values is derived from.
+var seed atomic.Uint64
+
+func init() {
+	seed.Store(rand.Uint64())
+}
+
+// Seed seeds the random values generated for args. Each VU (and each of
+// its activities) draws from a source of its own, derived from the seed,
+// its workflow and its index, so the same seed produces the same values
+// for each VU regardless of how VUs are scheduled.
+func Seed(s uint64) {
+	seed.Store(s)
+}
+
+// newRand returns a source of random values that isn't safe for
+// concurrent use, derived from the seed and the given keys.
+func newRand(keys ...string) *rand.Rand {
+	h := fnv.New64a()
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+	}
+
+	return rand.New(rand.NewPCG(seed.Load(), h.Sum64()))
+}
+
+// vuRand returns the source of random values for a VU, or one of its
+// activities if activity is set.
+func vuRand(workflow string, index int, activity string) *rand.Rand {
+	return newRand(workflow, strconv.Itoa(index), activity)
+}
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/samber/lo"
+)
+
+const (
+	applicationNameSetting = "application_name"
+)
+
+// applicationNameDrivers are the drivers whose databases tag statements
+// with an application_name, which every workflow run against them is
+// given, so that its statements can be told apart.
+var applicationNameDrivers = map[string]bool{
+	"pgx": true,
+}
+
+// workflowSettings returns a workflow's session settings, with
+// application_name defaulting to drk/<workflow>.
+func workflowSettings(workflowName string, workflow Workflow) map[string]string {
+	settings := map[string]string{
+		applicationNameSetting: "drk/" + workflowName,
+	}
+
+	for k, v := range workflow.SessionSettings {
+		settings[k] = v
+	}
+
+	return settings
+}
+
+// statementSettings returns the session settings applied to each of a
+// workflow's statements, if it doesn't use sticky sessions.
+func statementSettings(workflowName string, workflow Workflow, driver string) map[string]string {
+	if len(workflow.SessionSettings) == 0 && !applicationNameDrivers[driver] {
+		return nil
+	}
+
+	return workflowSettings(workflowName, workflow)
+}
+
+// setStatements returns the statements that apply a set of session
+// settings, in a deterministic order. If local is true, the settings
+// only apply to the current transaction.
+func setStatements(settings map[string]string, local bool) ([]string, error) {
+	names := lo.Keys(settings)
+	sort.Strings(names)
+
+	stmts := make([]string, len(names))
+	for i, name := range names {
+		if !lo.EveryBy([]byte(name), func(c byte) bool { return isIdentPart(c) || c == '.' }) {
+			return nil, fmt.Errorf("invalid session setting name: %q", name)
+		}
+
+		value := "'" + strings.ReplaceAll(settings[name], "'", "''") + "'"
+
+		stmts[i] = fmt.Sprintf("SET %s%s = %s", lo.Ternary(local, "LOCAL ", ""), name, value)
+	}
+
+	return stmts, nil
+}
+
+// runInTx runs a statement in a transaction started with the given
+// BEGIN statement and with the given session settings applied to it
+// alone. The VU's sticky session is used if it has one, otherwise a
+// connection is acquired for the transaction.
+func (r *Runner) runInTx(db repo.Queryer, begin string, settings map[string]string, run func(repo.Queryer) ([]map[string]any, repo.Stats, error)) ([]map[string]any, repo.Stats, error) {
+	stmts, err := setStatements(settings, true)
+	if err != nil {
+		return nil, repo.Stats{}, err
+	}
+
+	start := time.Now()
+
+	sess, ok := db.(repo.Session)
+	if !ok {
+		s, ok := db.(repo.Sessioner)
+		if !ok {
+			return nil, repo.Stats{}, fmt.Errorf("transactions require a connection that supports sessions")
+		}
+
+		if sess, err = s.Session(); err != nil {
+			return nil, repo.Stats{}, err
+		}
+		defer sess.Close()
+	}
+
+	wait := time.Since(start)
+
+	var data []map[string]any
+	var stats repo.Stats
+	err = sess.Locked(func(q repo.Queryer) error {
+		return inTx(q, begin, stmts, func() error {
+			var err error
+			data, stats, err = run(q)
+			return err
+		})
+	})
+
+	stats.Wait += wait
+	return data, stats, err
+}
+
+// validateSettings checks that the session settings of each workflow and
+// its activities can be applied, by applying them once in a transaction
+// that's rolled back.
+func (r *Runner) validateSettings() error {
+	for name, workflow := range r.cfg.Workflows {
+		db, driver, err := r.target(workflow)
+		if err != nil {
+			return fmt.Errorf("validating session settings for workflow %q: %w", name, err)
+		}
+
+		settings := workflowSettings(name, workflow)
+		if workflow.Session != SessionSticky {
+			settings = lo.Assign(statementSettings(name, workflow, driver))
+		}
+
+		for _, query := range workflow.Queries {
+			for k, v := range r.cfg.Activities[query.Name].SessionSettings {
+				settings[k] = v
+			}
+		}
+
+		if len(settings) == 0 {
+			continue
+		}
+
+		stmts, err := setStatements(settings, true)
+		if err != nil {
+			return fmt.Errorf("validating session settings for workflow %q: %w", name, err)
+		}
+
+		s, ok := db.(repo.Sessioner)
+		if !ok {
+			return fmt.Errorf("validating session settings for workflow %q: session settings require a connection that supports sessions", name)
+		}
+
+		sess, err := s.Session()
+		if err != nil {
+			return fmt.Errorf("validating session settings for workflow %q: %w", name, err)
+		}
+
+		err = sess.Locked(func(q repo.Queryer) error {
+			return inTx(q, "BEGIN", stmts, func() error {
+				return errRollback
+			})
+		})
+		sess.Close()
+
+		if err != nil && !errors.Is(err, errRollback) {
+			return fmt.Errorf("validating session settings for workflow %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// errRollback is returned from a transaction's body to roll it back
+// without reporting an error.
+var errRollback = errors.New("rollback")
+
+// inTx runs f in a transaction started with the given BEGIN statement,
+// after running the given statements against it.
+func inTx(q repo.Queryer, begin string, stmts []string, f func() error) error {
+	if _, err := q.Exec(begin); err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	for _, stmt := range stmts {
+		if _, err := q.Exec(stmt); err != nil {
+			return rollback(q, fmt.Errorf("applying session setting: %w", err))
+		}
+	}
+
+	if err := f(); err != nil {
+		return rollback(q, err)
+	}
+
+	if _, err := q.Exec("COMMIT"); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// rollback rolls back a transaction that failed with err, returning err
+// along with any error rolling back.
+func rollback(q repo.Queryer, err error) error {
+	if _, rbErr := q.Exec("ROLLBACK"); rbErr != nil {
+		return errors.Join(err, fmt.Errorf("rolling back transaction: %w", rbErr))
+	}
+
+	return err
+}
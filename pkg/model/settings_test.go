@@ -0,0 +1,294 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetStatements(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings map[string]string
+		local    bool
+		exp      []string
+		expErr   error
+	}{
+		{
+			name: "session settings",
+			settings: map[string]string{
+				"default_transaction_priority": "high",
+				"application_name":             "drk/shopper",
+			},
+			exp: []string{
+				"SET application_name = 'drk/shopper'",
+				"SET default_transaction_priority = 'high'",
+			},
+		},
+		{
+			name: "local settings",
+			settings: map[string]string{
+				"statement_timeout": "5s",
+			},
+			local: true,
+			exp: []string{
+				"SET LOCAL statement_timeout = '5s'",
+			},
+		},
+		{
+			name: "quotes escaped",
+			settings: map[string]string{
+				"application_name": "drk's",
+			},
+			exp: []string{
+				"SET application_name = 'drk''s'",
+			},
+		},
+		{
+			name: "invalid name",
+			settings: map[string]string{
+				"a = 1; DROP TABLE t; --": "",
+			},
+			expErr: errors.New(`invalid session setting name: "a = 1; DROP TABLE t; --"`),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act, err := setStatements(c.settings, c.local)
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestWorkflowSettings(t *testing.T) {
+	act := workflowSettings("shopper", Workflow{})
+	assert.Equal(t, map[string]string{"application_name": "drk/shopper"}, act)
+
+	act = workflowSettings("shopper", Workflow{
+		SessionSettings: map[string]string{
+			"application_name":             "shopper",
+			"default_transaction_priority": "low",
+		},
+	})
+	assert.Equal(t, map[string]string{
+		"application_name":             "shopper",
+		"default_transaction_priority": "low",
+	}, act)
+}
+
+func TestRunQueryWithSettings(t *testing.T) {
+	var stmts []string
+	sess := mockSession{
+		mockQueryer: mockQueryer{
+			exec: func(query string, args ...any) (repo.Stats, error) {
+				stmts = append(stmts, query)
+				return repo.Stats{}, nil
+			},
+		},
+	}
+	db := mockSessioner{
+		session: func() (repo.Session, error) {
+			return &sess, nil
+		},
+	}
+
+	r, err := NewRunner(&Drk{}, &db, "", "", 0, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	vu := NewVU(&zerolog.Logger{})
+	vu.settings = map[string]string{"application_name": "drk/shopper"}
+
+	_, _, err = r.runQuery(context.Background(), vu, Query{
+		Type:  "exec",
+		Query: "UPDATE t SET a = 1",
+		SessionSettings: map[string]string{
+			"default_transaction_priority": "high",
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"BEGIN",
+		"SET LOCAL application_name = 'drk/shopper'",
+		"SET LOCAL default_transaction_priority = 'high'",
+		"UPDATE t SET a = 1",
+		"COMMIT",
+	}, stmts)
+	assert.True(t, sess.closed)
+}
+
+func TestValidateSettings(t *testing.T) {
+	cases := []struct {
+		name     string
+		cfg      Drk
+		driver   string
+		db       repo.Queryer
+		execErr  error
+		expStmts []string
+		expErr   error
+	}{
+		{
+			name: "no settings",
+			cfg: Drk{
+				Workflows: map[string]Workflow{"shopper": {}},
+			},
+			db: &mockQueryer{},
+		},
+		{
+			name: "default application_name",
+			cfg: Drk{
+				Workflows: map[string]Workflow{"shopper": {}},
+			},
+			driver: "pgx",
+			db:     &mockSessioner{},
+			expStmts: []string{
+				"BEGIN",
+				"SET LOCAL application_name = 'drk/shopper'",
+				"ROLLBACK",
+			},
+		},
+		{
+			name: "valid settings",
+			cfg: Drk{
+				Workflows: map[string]Workflow{
+					"shopper": {
+						SessionSettings: map[string]string{"default_transaction_priority": "high"},
+						Queries:         []WorkflowQuery{{Name: "browse"}},
+					},
+				},
+				Activities: map[string]Query{
+					"browse": {SessionSettings: map[string]string{"statement_timeout": "5s"}},
+				},
+			},
+			db: &mockSessioner{},
+			expStmts: []string{
+				"BEGIN",
+				"SET LOCAL application_name = 'drk/shopper'",
+				"SET LOCAL default_transaction_priority = 'high'",
+				"SET LOCAL statement_timeout = '5s'",
+				"ROLLBACK",
+			},
+		},
+		{
+			name: "invalid settings",
+			cfg: Drk{
+				Workflows: map[string]Workflow{
+					"shopper": {
+						SessionSettings: map[string]string{"invalid": "high"},
+					},
+				},
+			},
+			db:      &mockSessioner{},
+			execErr: errors.New("unrecognized configuration parameter"),
+			expErr:  errors.New(`validating session settings for workflow "shopper": beginning transaction: unrecognized configuration parameter`),
+		},
+		{
+			name: "sessions unsupported",
+			cfg: Drk{
+				Workflows: map[string]Workflow{
+					"shopper": {
+						SessionSettings: map[string]string{"default_transaction_priority": "high"},
+					},
+				},
+			},
+			db:     &mockQueryer{},
+			expErr: errors.New(`validating session settings for workflow "shopper": session settings require a connection that supports sessions`),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var stmts []string
+			sess := mockSession{
+				mockQueryer: mockQueryer{
+					exec: func(query string, args ...any) (repo.Stats, error) {
+						stmts = append(stmts, query)
+						return repo.Stats{}, c.execErr
+					},
+				},
+			}
+
+			if s, ok := c.db.(*mockSessioner); ok {
+				s.session = func() (repo.Session, error) {
+					return &sess, nil
+				}
+			}
+
+			r, err := NewRunner(&c.cfg, c.db, "", c.driver, 0, &zerolog.Logger{})
+			assert.NoError(t, err)
+
+			err = r.validateSettings()
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr.Error(), err.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.expStmts, stmts)
+		})
+	}
+}
+
+func TestStatementSettings(t *testing.T) {
+	cases := []struct {
+		name     string
+		workflow Workflow
+		driver   string
+		exp      map[string]string
+	}{
+		{
+			name:   "pgx without settings",
+			driver: "pgx",
+			exp:    map[string]string{"application_name": "drk/shopper"},
+		},
+		{
+			name:     "pgx with settings",
+			workflow: Workflow{SessionSettings: map[string]string{"application_name": "shop", "default_transaction_priority": "low"}},
+			driver:   "pgx",
+			exp:      map[string]string{"application_name": "shop", "default_transaction_priority": "low"},
+		},
+		{
+			name:   "mysql without settings",
+			driver: "mysql",
+		},
+		{
+			name:     "mysql with settings",
+			workflow: Workflow{SessionSettings: map[string]string{"default_transaction_priority": "low"}},
+			driver:   "mysql",
+			exp:      map[string]string{"application_name": "drk/shopper", "default_transaction_priority": "low"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, statementSettings("shopper", c.workflow, c.driver))
+		})
+	}
+}
+
+func TestInTxRollbackErr(t *testing.T) {
+	q := mockQueryer{
+		exec: func(query string, args ...any) (repo.Stats, error) {
+			if query == "ROLLBACK" {
+				return repo.Stats{}, errors.New("connection reset")
+			}
+			return repo.Stats{}, nil
+		},
+	}
+
+	err := inTx(&q, "BEGIN", nil, func() error {
+		return errors.New("bad things happened")
+	})
+	assert.Equal(t, "bad things happened\nrolling back transaction: connection reset", err.Error())
+}
@@ -0,0 +1,263 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// DropNone holds up the delivery of events to every sink until the
+	// sink has room for an event. No events are lost to the sink, but
+	// events may be dropped before reaching any sink if it falls behind.
+	DropNone = "none"
+
+	// DropNewest discards events that arrive while the sink's buffer is
+	// full.
+	DropNewest = "newest"
+
+	// DropOldest discards the oldest buffered event to make room for
+	// one that arrives while the sink's buffer is full.
+	DropOldest = "oldest"
+
+	defaultSinkBuffer = 1000
+
+	// runnerSink is the name events dropped before reaching any sink are
+	// reported under.
+	runnerSink = "runner"
+)
+
+// Sink consumes the events of a run. Consume is called once, in its own
+// goroutine, and should return once the event stream closes at the end
+// of the run.
+type Sink interface {
+	Consume(events <-chan Event) error
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(events <-chan Event) error
+
+func (f SinkFunc) Consume(events <-chan Event) error {
+	return f(events)
+}
+
+// SinkOptions determine how events are buffered for a sink.
+type SinkOptions struct {
+	// Number of events buffered for the sink, defaulting to 1000.
+	Buffer int
+
+	// What to do when the buffer is full [none, newest, oldest],
+	// defaulting to newest.
+	Drop string
+}
+
+type sink struct {
+	name    string
+	sink    Sink
+	drop    string
+	events  chan Event
+	dropped atomic.Int64
+}
+
+// AddSink registers a sink to receive the run's events. Sinks must be
+// added before the run starts.
+func (r *Runner) AddSink(name string, s Sink, opts SinkOptions) error {
+	if opts.Buffer <= 0 {
+		opts.Buffer = defaultSinkBuffer
+	}
+
+	if name == runnerSink {
+		return fmt.Errorf("sink name %q is reserved", name)
+	}
+
+	switch opts.Drop {
+	case "":
+		opts.Drop = DropNewest
+	case DropNone, DropNewest, DropOldest:
+	default:
+		return fmt.Errorf("invalid drop policy for sink %q: %q", name, opts.Drop)
+	}
+
+	r.sinks = append(r.sinks, &sink{
+		name:   name,
+		sink:   s,
+		drop:   opts.Drop,
+		events: make(chan Event, opts.Buffer),
+	})
+
+	return nil
+}
+
+// GetEventStream returns a stream of the run's events, which is closed
+// once the run ends. Events are dropped, and counted as dropped by the
+// "event_stream" sink, if the stream isn't read quickly enough. It must
+// be called before the run starts.
+//
+// Deprecated: use AddSink, which lets a sink's buffering and drop policy
+// be configured.
+func (r *Runner) GetEventStream() <-chan Event {
+	stream := make(chan Event, defaultSinkBuffer)
+
+	var s *sink
+	consume := SinkFunc(func(events <-chan Event) error {
+		defer close(stream)
+
+		for e := range events {
+			select {
+			case stream <- e:
+			default:
+				s.dropped.Add(1)
+			}
+		}
+
+		return nil
+	})
+
+	// The name and options are valid, so the sink is always added.
+	_ = r.AddSink("event_stream", consume, SinkOptions{})
+	s = r.sinks[len(r.sinks)-1]
+
+	return stream
+}
+
+// DroppedEvents returns the number of events each sink has dropped
+// because its buffer was full, along with those the runner dropped
+// because the event stream was full, keyed as "runner".
+func (r *Runner) DroppedEvents() map[string]int64 {
+	out := make(map[string]int64, len(r.sinks)+1)
+	out[runnerSink] = r.droppedEvents.Load()
+	for _, s := range r.sinks {
+		out[s.name] = s.dropped.Load()
+	}
+
+	return out
+}
+
+// startSinks starts each sink and fans the runner's events out to them.
+// The returned function waits for the sinks to consume the remaining
+// events once the event stream has been closed, returning any errors
+// they failed with.
+func (r *Runner) startSinks() func() error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(r.sinks))
+
+	for i, s := range r.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Keep draining events if the sink fails, so the run isn't
+			// blocked.
+			defer func() {
+				for range s.events {
+				}
+			}()
+
+			if err := s.sink.Consume(s.events); err != nil {
+				errs[i] = fmt.Errorf("sink %q: %w", s.name, err)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for e := range r.events {
+			for _, s := range r.sinks {
+				s.send(e)
+			}
+		}
+
+		for _, s := range r.sinks {
+			close(s.events)
+		}
+	}()
+
+	return func() error {
+		wg.Wait()
+		return errors.Join(errs...)
+	}
+}
+
+func (s *sink) send(e Event) {
+	switch s.drop {
+	case DropNone:
+		s.events <- e
+
+	case DropOldest:
+		for {
+			select {
+			case s.events <- e:
+				return
+			default:
+			}
+
+			select {
+			case <-s.events:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+
+	default:
+		select {
+		case s.events <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// JSONSink writes each event as a line of JSON.
+type JSONSink struct {
+	w io.Writer
+}
+
+// NewJSONSink returns a sink that writes events to w.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{w: w}
+}
+
+type jsonEvent struct {
+	Workflow   string  `json:"workflow"`
+	Name       string  `json:"name"`
+	DurationMs float64 `json:"duration_ms"`
+	WaitMs     float64 `json:"wait_ms"`
+	Node       string  `json:"node,omitempty"`
+	Connection string  `json:"connection,omitempty"`
+	Stale      bool    `json:"stale,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	ErrorClass string  `json:"error_class,omitempty"`
+	Control    string  `json:"control,omitempty"`
+}
+
+func (s *JSONSink) Consume(events <-chan Event) error {
+	enc := json.NewEncoder(s.w)
+
+	for e := range events {
+		je := jsonEvent{
+			Workflow:   e.Workflow,
+			Name:       e.Name,
+			DurationMs: millis(e.Duration),
+			WaitMs:     millis(e.Wait),
+			Node:       e.Node,
+			Connection: e.Connection,
+			Stale:      e.Stale,
+			Control:    e.Control,
+		}
+		if e.Err != nil {
+			je.Error = e.Err.Error()
+			je.ErrorClass = errorClass(e.Err)
+		}
+
+		if err := enc.Encode(je); err != nil {
+			return fmt.Errorf("writing event: %w", err)
+		}
+	}
+
+	return nil
+}
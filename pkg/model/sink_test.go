@@ -0,0 +1,132 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddSink(t *testing.T) {
+	r, err := NewRunner(nil, &mockQueryer{}, "", "", 0, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	err = r.AddSink("a", NewJSONSink(&bytes.Buffer{}), SinkOptions{Drop: "invalid"})
+	assert.Equal(t, errors.New(`invalid drop policy for sink "a": "invalid"`), err)
+
+	assert.NoError(t, r.AddSink("b", NewJSONSink(&bytes.Buffer{}), SinkOptions{}))
+	assert.Equal(t, defaultSinkBuffer, cap(r.sinks[0].events))
+	assert.Equal(t, DropNewest, r.sinks[0].drop)
+}
+
+func TestSinkFanOut(t *testing.T) {
+	r, err := NewRunner(nil, &mockQueryer{}, "", "", 0, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	var a, b []string
+	collect := func(out *[]string) Sink {
+		return SinkFunc(func(events <-chan Event) error {
+			for e := range events {
+				*out = append(*out, e.Name)
+			}
+			return nil
+		})
+	}
+
+	assert.NoError(t, r.AddSink("a", collect(&a), SinkOptions{Drop: DropNone}))
+	assert.NoError(t, r.AddSink("b", collect(&b), SinkOptions{Drop: DropNone}))
+	assert.NoError(t, r.AddSink("failing", SinkFunc(func(<-chan Event) error {
+		return errors.New("bad things happened")
+	}), SinkOptions{Drop: DropNone, Buffer: 1}))
+
+	wait := r.startSinks()
+	for _, name := range []string{"x", "y", "z"} {
+		r.events <- Event{Name: name}
+	}
+	close(r.events)
+
+	assert.Equal(t, `sink "failing": bad things happened`, wait().Error())
+	assert.Equal(t, []string{"x", "y", "z"}, a)
+	assert.Equal(t, []string{"x", "y", "z"}, b)
+}
+
+func TestGetEventStream(t *testing.T) {
+	r, err := NewRunner(nil, &mockQueryer{}, "", "", 0, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	stream := r.GetEventStream()
+
+	wait := r.startSinks()
+	for _, name := range []string{"x", "y", "z"} {
+		r.events <- Event{Name: name}
+	}
+	close(r.events)
+	assert.NoError(t, wait())
+
+	var act []string
+	for e := range stream {
+		act = append(act, e.Name)
+	}
+
+	assert.Equal(t, []string{"x", "y", "z"}, act)
+	assert.Equal(t, int64(0), r.DroppedEvents()["event_stream"])
+}
+
+func TestSinkDropPolicies(t *testing.T) {
+	cases := []struct {
+		name       string
+		drop       string
+		exp        []string
+		expDropped int64
+	}{
+		{
+			name:       "drop newest",
+			drop:       DropNewest,
+			exp:        []string{"a", "b"},
+			expDropped: 2,
+		},
+		{
+			name:       "drop oldest",
+			drop:       DropOldest,
+			exp:        []string{"c", "d"},
+			expDropped: 2,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &sink{drop: c.drop, events: make(chan Event, 2)}
+
+			for _, name := range []string{"a", "b", "c", "d"} {
+				s.send(Event{Name: name})
+			}
+			close(s.events)
+
+			var act []string
+			for e := range s.events {
+				act = append(act, e.Name)
+			}
+
+			assert.Equal(t, c.exp, act)
+			assert.Equal(t, c.expDropped, s.dropped.Load())
+		})
+	}
+}
+
+func TestJSONSink(t *testing.T) {
+	var buf bytes.Buffer
+
+	events := make(chan Event, 2)
+	events <- Event{Workflow: "shop", Name: "browse", Duration: 1500 * time.Microsecond, Node: "a"}
+	events <- Event{Workflow: "shop", Name: "buy", Err: AssertionErr{Reason: "expected 1 rows, got 0"}}
+	close(events)
+
+	assert.NoError(t, NewJSONSink(&buf).Consume(events))
+
+	exp := `{"workflow":"shop","name":"browse","duration_ms":1.5,"wait_ms":0,"node":"a"}` + "\n" +
+		`{"workflow":"shop","name":"buy","duration_ms":0,"wait_ms":0,"error":"assertion failed: expected 1 rows, got 0","error_class":"assertion"}` + "\n"
+	assert.Equal(t, exp, buf.String())
+}
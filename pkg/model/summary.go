@@ -0,0 +1,160 @@
+package model
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Summary is the machine-readable result of a run.
+type Summary struct {
+	Run        RunInfo            `json:"run"`
+	Queries    []QuerySummary     `json:"queries"`
+	Thresholds []ThresholdSummary `json:"thresholds,omitempty"`
+}
+
+// RunInfo describes the run a summary was produced by.
+type RunInfo struct {
+	ConfigHash string    `json:"config_hash"`
+	Seed       uint64    `json:"seed"`
+	Driver     string    `json:"driver"`
+	Duration   string    `json:"duration"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+}
+
+// QuerySummary holds the totals and latency percentiles of a query
+// within a workflow. Latencies are in milliseconds.
+type QuerySummary struct {
+	Workflow          string  `json:"workflow"`
+	Query             string  `json:"query"`
+	Stale             bool    `json:"stale,omitempty"`
+	Count             int     `json:"count"`
+	Errors            int     `json:"errors"`
+	AssertionFailures int     `json:"assertion_failures"`
+	ErrorRate         float64 `json:"error_rate"`
+	Throughput        float64 `json:"throughput"`
+	MinMs             float64 `json:"min_ms"`
+	AvgMs             float64 `json:"avg_ms"`
+	P50Ms             float64 `json:"p50_ms"`
+	P90Ms             float64 `json:"p90_ms"`
+	P95Ms             float64 `json:"p95_ms"`
+	P99Ms             float64 `json:"p99_ms"`
+	MaxMs             float64 `json:"max_ms"`
+}
+
+// ThresholdSummary is the outcome of a threshold against a query.
+type ThresholdSummary struct {
+	Threshold string `json:"threshold"`
+	Workflow  string `json:"workflow,omitempty"`
+	Query     string `json:"query,omitempty"`
+	Actual    string `json:"actual"`
+	Pass      bool   `json:"pass"`
+}
+
+// NewSummary summarises the stats collected over a run.
+func NewSummary(run RunInfo, stats []QueryStats, thresholds []ThresholdResult) Summary {
+	elapsed := run.End.Sub(run.Start)
+
+	s := Summary{Run: run}
+
+	for _, qs := range stats {
+		s.Queries = append(s.Queries, QuerySummary{
+			Workflow:          qs.Workflow,
+			Query:             qs.Name,
+			Stale:             qs.Stale,
+			Count:             qs.Count,
+			Errors:            qs.Errors,
+			AssertionFailures: qs.AssertionFailures,
+			ErrorRate:         qs.ErrorRate(),
+			Throughput:        qs.Throughput(elapsed),
+			MinMs:             millis(qs.Min()),
+			AvgMs:             millis(qs.Mean()),
+			P50Ms:             millis(qs.Percentile(50)),
+			P90Ms:             millis(qs.Percentile(90)),
+			P95Ms:             millis(qs.Percentile(95)),
+			P99Ms:             millis(qs.Percentile(99)),
+			MaxMs:             millis(qs.Max()),
+		})
+	}
+
+	for _, r := range thresholds {
+		s.Thresholds = append(s.Thresholds, ThresholdSummary{
+			Threshold: r.Threshold.String(),
+			Workflow:  r.Workflow,
+			Query:     r.Name,
+			Actual:    r.Actual,
+			Pass:      r.Pass,
+		})
+	}
+
+	return s
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// WriteJSON writes the summary as an indented JSON document.
+func (s Summary) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(s)
+}
+
+var summaryCSVHeader = []string{
+	"start", "end", "duration", "driver", "config_hash", "seed",
+	"workflow", "query", "stale", "count", "errors", "assertion_failures", "error_rate", "throughput",
+	"min_ms", "avg_ms", "p50_ms", "p90_ms", "p95_ms", "p99_ms", "max_ms",
+}
+
+// WriteCSV writes a row for each query, with the run's metadata repeated
+// on each row so that summaries from different runs can be concatenated.
+func (s Summary) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(summaryCSVHeader); err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	for _, q := range s.Queries {
+		row := []string{
+			s.Run.Start.Format(time.RFC3339Nano),
+			s.Run.End.Format(time.RFC3339Nano),
+			s.Run.Duration,
+			s.Run.Driver,
+			s.Run.ConfigHash,
+			strconv.FormatUint(s.Run.Seed, 10),
+			q.Workflow,
+			q.Query,
+			strconv.FormatBool(q.Stale),
+			strconv.Itoa(q.Count),
+			strconv.Itoa(q.Errors),
+			strconv.Itoa(q.AssertionFailures),
+			f(q.ErrorRate),
+			f(q.Throughput),
+			f(q.MinMs),
+			f(q.AvgMs),
+			f(q.P50Ms),
+			f(q.P90Ms),
+			f(q.P95Ms),
+			f(q.P99Ms),
+			f(q.MaxMs),
+		}
+
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("writing row: %w", err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/random"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummary(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	stats := []QueryStats{
+		{Workflow: "shop", Name: "browse", Count: 2, Latency: newHistogram(2*time.Millisecond, 4*time.Millisecond)},
+		{Workflow: "shop", Name: "history", Count: 2, Stale: true, Latency: newHistogram(time.Second)},
+	}
+
+	end := start.Add(2 * time.Second)
+
+	threshold, err := ParseThreshold("browse.p99 < 1ms")
+	assert.NoError(t, err)
+
+	run := RunInfo{ConfigHash: "abc", Seed: 1, Driver: "pgx", Duration: "2s", Start: start, End: end}
+	summary := NewSummary(run, stats, threshold.Evaluate(stats, 2*time.Second))
+
+	assert.Equal(t, []QuerySummary{
+		{
+			Workflow:   "shop",
+			Query:      "browse",
+			Count:      2,
+			Throughput: 1,
+			MinMs:      2,
+			AvgMs:      3,
+			P50Ms:      2,
+			P90Ms:      4,
+			P95Ms:      4,
+			P99Ms:      4,
+			MaxMs:      4,
+		},
+		{
+			Workflow:   "shop",
+			Query:      "history",
+			Stale:      true,
+			Count:      2,
+			Throughput: 1,
+			MinMs:      1000,
+			AvgMs:      1000,
+			P50Ms:      1000,
+			P90Ms:      1000,
+			P95Ms:      1000,
+			P99Ms:      1000,
+			MaxMs:      1000,
+		},
+	}, summary.Queries)
+
+	assert.Equal(t, []ThresholdSummary{
+		{Threshold: "browse.p99 < 1ms", Workflow: "shop", Query: "browse", Actual: "4ms", Pass: false},
+	}, summary.Thresholds)
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, summary.WriteJSON(&buf))
+
+		var act Summary
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &act))
+		assert.Equal(t, summary, act)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, summary.WriteCSV(&buf))
+
+		exp := "start,end,duration,driver,config_hash,seed,workflow,query,stale,count,errors,assertion_failures,error_rate,throughput,min_ms,avg_ms,p50_ms,p90_ms,p95_ms,p99_ms,max_ms\n" +
+			"2024-01-01T00:00:00Z,2024-01-01T00:00:02Z,2s,pgx,abc,1,shop,browse,false,2,0,0,0,1,2,3,2,4,4,4,4\n" +
+			"2024-01-01T00:00:00Z,2024-01-01T00:00:02Z,2s,pgx,abc,1,shop,history,true,2,0,0,0,1,1000,1000,1000,1000,1000,1000,1000\n"
+		assert.Equal(t, exp, buf.String())
+	})
+}
+
+func TestSeed(t *testing.T) {
+	generate := func(workflow string, index int) []any {
+		vu := NewVU(&zerolog.Logger{}).withRand(vuRand(workflow, index, "browse"))
+
+		var out []any
+		for range 10 {
+			out = append(out, Int(vu.rng, 0, 1000), random.Replacements["email"](vu.faker))
+		}
+		return out
+	}
+
+	Seed(1)
+	first := generate("shop", 0)
+
+	// Each VU's values are reproducible, whatever the other VUs draw.
+	generate("shop", 1)
+	assert.Equal(t, first, generate("shop", 0))
+
+	Seed(1)
+	assert.Equal(t, first, generate("shop", 0))
+
+	assert.NotEqual(t, first, generate("shop", 1))
+	assert.NotEqual(t, first, generate("admin", 0))
+}
@@ -0,0 +1,461 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ReadsStale restricts a threshold to historical reads, run AS OF
+	// SYSTEM TIME.
+	ReadsStale = "stale"
+
+	// ReadsFresh restricts a threshold to queries that read current data.
+	ReadsFresh = "fresh"
+)
+
+const (
+	metricKindLatency = iota
+	metricKindRate
+	metricKindThroughput
+	metricKindCount
+)
+
+var (
+	thresholdPattern  = regexp.MustCompile(`^\s*(.+)\.([a-z0-9_]+)\s*(<=|>=|==|!=|<|>)\s*(.+?)\s*$`)
+	percentilePattern = regexp.MustCompile(`^p(\d+)$`)
+)
+
+// Threshold is a pass/fail condition on a metric of the queries whose
+// name matches Target, written as "<target>.<metric> <op> <value>", e.g.
+// "create_purchase.p99 < 250ms". Targets are glob patterns matched
+// against both "<query>" and "<workflow>.<query>", and can be prefixed
+// with "stale:" or "fresh:" to only match queries that do or don't run
+// AS OF SYSTEM TIME, e.g. "stale:*.p99 < 1s".
+type Threshold struct {
+	Target string
+	Metric string
+	Op     string
+	Value  float64
+
+	// Reads is ReadsStale or ReadsFresh if the threshold only applies
+	// to historical or current reads, and empty if it applies to both.
+	Reads string
+
+	// AbortOnFail stops the run as soon as the threshold fails, rather
+	// than only evaluating it once the run ends.
+	AbortOnFail bool
+
+	expr string
+	kind int
+}
+
+// ThresholdResult is the outcome of evaluating a threshold against a
+// query, or against no queries if none matched its target.
+type ThresholdResult struct {
+	Threshold Threshold
+	Workflow  string
+	Name      string
+	Actual    string
+	Pass      bool
+}
+
+func (t *Threshold) UnmarshalYAML(node *yaml.Node) error {
+	var raw struct {
+		Threshold   string `yaml:"threshold"`
+		AbortOnFail bool   `yaml:"abort_on_fail"`
+	}
+
+	if node.Kind == yaml.ScalarNode {
+		raw.Threshold = node.Value
+	} else if err := checkKeys(node, "threshold", "abort_on_fail"); err != nil {
+		return err
+	} else if err := node.Decode(&raw); err != nil {
+		return err
+	}
+
+	parsed, err := ParseThreshold(raw.Threshold)
+	if err != nil {
+		return err
+	}
+	parsed.AbortOnFail = raw.AbortOnFail
+
+	*t = parsed
+	return nil
+}
+
+// ParseThreshold parses a threshold expression.
+func ParseThreshold(expr string) (Threshold, error) {
+	parts := thresholdPattern.FindStringSubmatch(expr)
+	if parts == nil {
+		return Threshold{}, fmt.Errorf("invalid threshold: %q", expr)
+	}
+
+	t := Threshold{
+		Target: parts[1],
+		Metric: parts[2],
+		Op:     parts[3],
+		expr:   strings.TrimSpace(expr),
+	}
+
+	for _, reads := range []string{ReadsStale, ReadsFresh} {
+		if target, ok := strings.CutPrefix(t.Target, reads+":"); ok {
+			t.Target, t.Reads = target, reads
+		}
+	}
+
+	if _, err := path.Match(t.Target, ""); err != nil {
+		return Threshold{}, fmt.Errorf("invalid threshold target %q: %w", t.Target, err)
+	}
+
+	var err error
+	switch {
+	case isLatencyMetric(t.Metric):
+		t.kind = metricKindLatency
+		var d time.Duration
+		if d, err = time.ParseDuration(parts[4]); err == nil {
+			t.Value = float64(d)
+		}
+
+	case t.Metric == "error_rate":
+		t.kind = metricKindRate
+		t.Value, err = parseRate(parts[4])
+
+	case t.Metric == "throughput":
+		t.kind = metricKindThroughput
+		t.Value, err = parseThroughput(parts[4])
+
+	case t.Metric == "count" || t.Metric == "errors" || t.Metric == "assertion_failures":
+		t.kind = metricKindCount
+		t.Value, err = strconv.ParseFloat(parts[4], 64)
+
+	default:
+		return Threshold{}, fmt.Errorf("invalid threshold metric: %q", t.Metric)
+	}
+	if err != nil {
+		return Threshold{}, fmt.Errorf("parsing value for threshold %q: %w", expr, err)
+	}
+
+	return t, nil
+}
+
+func (t Threshold) String() string {
+	return t.expr
+}
+
+func isLatencyMetric(metric string) bool {
+	switch metric {
+	case "min", "max", "avg":
+		return true
+	}
+
+	parts := percentilePattern.FindStringSubmatch(metric)
+	if parts == nil {
+		return false
+	}
+
+	p, err := strconv.Atoi(parts[1])
+	return err == nil && p > 0 && p <= 100
+}
+
+// parseRate parses a fraction, either as a percentage like 0.1% or as a
+// number like 0.001.
+func parseRate(s string) (float64, error) {
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		v, err := strconv.ParseFloat(pct, 64)
+		return v / 100, err
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseThroughput parses a rate per second, either as a number or as a
+// number per unit of time like 150/s or 1000/m.
+func parseThroughput(s string) (float64, error) {
+	n, unit, ok := strings.Cut(s, "/")
+
+	v, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+	if err != nil || !ok {
+		return v, err
+	}
+
+	interval, err := time.ParseDuration("1" + strings.TrimSpace(unit))
+	if err != nil {
+		return 0, err
+	}
+
+	return v / interval.Seconds(), nil
+}
+
+// Evaluate checks the threshold against each matching query.
+func (t Threshold) Evaluate(stats []QueryStats, elapsed time.Duration) []ThresholdResult {
+	var results []ThresholdResult
+
+	for _, qs := range stats {
+		if !t.matches(qs) {
+			continue
+		}
+
+		actual := t.measure(qs, elapsed)
+		results = append(results, ThresholdResult{
+			Threshold: t,
+			Workflow:  qs.Workflow,
+			Name:      qs.Name,
+			Actual:    t.format(actual),
+			Pass:      t.compare(actual),
+		})
+	}
+
+	if len(results) == 0 {
+		return []ThresholdResult{{Threshold: t, Actual: "no matching queries"}}
+	}
+
+	return results
+}
+
+func (t Threshold) matches(qs QueryStats) bool {
+	if t.Reads != "" && qs.Stale != (t.Reads == ReadsStale) {
+		return false
+	}
+
+	for _, name := range []string{qs.Name, qs.Workflow + "." + qs.Name} {
+		if ok, _ := path.Match(t.Target, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t Threshold) measure(qs QueryStats, elapsed time.Duration) float64 {
+	switch t.Metric {
+	case "min":
+		return float64(qs.Min())
+	case "max":
+		return float64(qs.Max())
+	case "avg":
+		return float64(qs.Mean())
+	case "error_rate":
+		return qs.ErrorRate()
+	case "throughput":
+		return qs.Throughput(elapsed)
+	case "count":
+		return float64(qs.Count)
+	case "errors":
+		return float64(qs.Errors)
+	case "assertion_failures":
+		return float64(qs.AssertionFailures)
+	default:
+		p, _ := strconv.ParseFloat(strings.TrimPrefix(t.Metric, "p"), 64)
+		return float64(qs.Percentile(p))
+	}
+}
+
+func (t Threshold) compare(actual float64) bool {
+	switch t.Op {
+	case "<":
+		return actual < t.Value
+	case "<=":
+		return actual <= t.Value
+	case ">":
+		return actual > t.Value
+	case ">=":
+		return actual >= t.Value
+	case "==":
+		return actual == t.Value
+	default:
+		return actual != t.Value
+	}
+}
+
+func (t Threshold) format(actual float64) string {
+	switch t.kind {
+	case metricKindLatency:
+		return time.Duration(actual).String()
+	case metricKindRate:
+		return strconv.FormatFloat(actual*100, 'f', 2, 64) + "%"
+	case metricKindThroughput:
+		return strconv.FormatFloat(actual, 'f', 2, 64) + "/s"
+	default:
+		return strconv.FormatFloat(actual, 'f', -1, 64)
+	}
+}
+
+// EvaluateThresholds checks each threshold against the given stats.
+func EvaluateThresholds(thresholds []Threshold, stats []QueryStats, elapsed time.Duration) []ThresholdResult {
+	var results []ThresholdResult
+	for _, t := range thresholds {
+		results = append(results, t.Evaluate(stats, elapsed)...)
+	}
+
+	return results
+}
+
+const (
+	// abortWindow is the period thresholds that abort the run are
+	// checked over while it runs, and how long each query must have been
+	// running before they're checked against it.
+	abortWindow = 10 * time.Second
+
+	// abortMinCount is the number of times a query must have run within
+	// the window before thresholds that abort the run are checked
+	// against it.
+	abortMinCount = 10
+)
+
+// WatchThresholds checks the thresholds that abort the run on failure
+// every interval until done is closed, sending their results once one of
+// them fails. Latency, error rate and throughput are measured over the
+// last 10 seconds of each query that's run at least 10 times in that
+// time, rather than since the run started, so that its warm-up doesn't
+// fail them. Counts only grow, so count thresholds only fail the run
+// early once they exceed an upper bound.
+func (r *Runner) WatchThresholds(thresholds []Threshold, interval time.Duration, done <-chan struct{}) <-chan []ThresholdResult {
+	return r.watchThresholds(thresholds, interval, abortWindow, done)
+}
+
+func (r *Runner) watchThresholds(thresholds []Threshold, interval, window time.Duration, done <-chan struct{}) <-chan []ThresholdResult {
+	aborted := make(chan []ThresholdResult, 1)
+
+	w := newThresholdWatcher(thresholds, window)
+	if len(w.thresholds) == 0 {
+		return aborted
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				stats, _ := r.Results(now)
+
+				results := w.check(now, stats)
+				if !lo.EveryBy(results, func(r ThresholdResult) bool { return r.Pass }) {
+					aborted <- results
+					return
+				}
+
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return aborted
+}
+
+// thresholdWatcher checks thresholds that abort the run against the
+// results of each query over a sliding window.
+type thresholdWatcher struct {
+	thresholds []Threshold
+	window     time.Duration
+
+	// Snapshots of each query's results, keyed by workflow and query,
+	// taken since it first ran and covering at least the window.
+	samples map[string][]thresholdSample
+}
+
+type thresholdSample struct {
+	at    time.Time
+	stats QueryStats
+}
+
+func newThresholdWatcher(thresholds []Threshold, window time.Duration) *thresholdWatcher {
+	return &thresholdWatcher{
+		thresholds: lo.Filter(thresholds, func(t Threshold, _ int) bool { return t.AbortOnFail }),
+		window:     window,
+		samples:    map[string][]thresholdSample{},
+	}
+}
+
+// check records a snapshot of each query's results and checks the
+// thresholds against those that have enough results to judge.
+func (w *thresholdWatcher) check(now time.Time, stats []QueryStats) []ThresholdResult {
+	var results []ThresholdResult
+
+	for _, qs := range stats {
+		windowed, elapsed, ok := w.record(now, qs)
+
+		for _, t := range w.thresholds {
+			if !t.matches(qs) {
+				continue
+			}
+
+			var actual float64
+			switch {
+			case t.kind == metricKindCount:
+				if !t.upperBound() {
+					continue
+				}
+				actual = t.measure(qs, 0)
+
+			case ok:
+				actual = t.measure(windowed, elapsed)
+
+			default:
+				continue
+			}
+
+			results = append(results, ThresholdResult{
+				Threshold: t,
+				Workflow:  qs.Workflow,
+				Name:      qs.Name,
+				Actual:    t.format(actual),
+				Pass:      t.compare(actual),
+			})
+		}
+	}
+
+	return results
+}
+
+// record adds a snapshot of a query's results, returning its results
+// over the window if it's been running for at least the window and has
+// run enough times within it to judge.
+func (w *thresholdWatcher) record(now time.Time, qs QueryStats) (QueryStats, time.Duration, bool) {
+	if qs.Count == 0 {
+		return QueryStats{}, 0, false
+	}
+
+	key := qs.Workflow + "." + qs.Name
+	samples := append(w.samples[key], thresholdSample{at: now, stats: qs})
+
+	// Keep the latest sample taken at least a window ago, so that the
+	// samples always cover the window once there's been time to.
+	for len(samples) > 1 && !samples[1].at.After(now.Add(-w.window)) {
+		samples = samples[1:]
+	}
+	w.samples[key] = samples
+
+	oldest := samples[0]
+	if now.Sub(oldest.at) < w.window {
+		return QueryStats{}, 0, false
+	}
+
+	windowed := qs.Sub(oldest.stats)
+	if windowed.Count < abortMinCount {
+		return QueryStats{}, 0, false
+	}
+
+	return windowed, now.Sub(oldest.at), true
+}
+
+// upperBound returns true if the threshold fails once its metric grows
+// beyond a value, so a failing count can't pass again as the run goes on.
+func (t Threshold) upperBound() bool {
+	switch t.Op {
+	case "<", "<=", "==":
+		return true
+	default:
+		return false
+	}
+}
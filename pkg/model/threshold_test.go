@@ -0,0 +1,353 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseThreshold(t *testing.T) {
+	cases := []struct {
+		name   string
+		expr   string
+		exp    Threshold
+		expErr error
+	}{
+		{
+			name: "latency",
+			expr: "create_purchase.p99 < 250ms",
+			exp:  Threshold{Target: "create_purchase", Metric: "p99", Op: "<", Value: float64(250 * time.Millisecond), kind: metricKindLatency},
+		},
+		{
+			name: "workflow qualified",
+			expr: "shop.create_purchase.avg<=1s",
+			exp:  Threshold{Target: "shop.create_purchase", Metric: "avg", Op: "<=", Value: float64(time.Second), kind: metricKindLatency},
+		},
+		{
+			name: "error rate percentage",
+			expr: "*.error_rate < 0.1%",
+			exp:  Threshold{Target: "*", Metric: "error_rate", Op: "<", Value: 0.001, kind: metricKindRate},
+		},
+		{
+			name: "error rate fraction",
+			expr: "*.error_rate < 0.5",
+			exp:  Threshold{Target: "*", Metric: "error_rate", Op: "<", Value: 0.5, kind: metricKindRate},
+		},
+		{
+			name: "throughput per second",
+			expr: "browse_product.throughput > 150/s",
+			exp:  Threshold{Target: "browse_product", Metric: "throughput", Op: ">", Value: 150, kind: metricKindThroughput},
+		},
+		{
+			name: "throughput per minute",
+			expr: "browse_product.throughput >= 600/m",
+			exp:  Threshold{Target: "browse_product", Metric: "throughput", Op: ">=", Value: 10, kind: metricKindThroughput},
+		},
+		{
+			name: "count",
+			expr: "check_order.assertion_failures == 0",
+			exp:  Threshold{Target: "check_order", Metric: "assertion_failures", Op: "==", Value: 0, kind: metricKindCount},
+		},
+		{
+			name: "stale reads",
+			expr: "stale:*.p99 < 1s",
+			exp:  Threshold{Target: "*", Metric: "p99", Op: "<", Value: float64(time.Second), Reads: ReadsStale, kind: metricKindLatency},
+		},
+		{
+			name: "fresh reads",
+			expr: "fresh:shop.*.p99 < 1s",
+			exp:  Threshold{Target: "shop.*", Metric: "p99", Op: "<", Value: float64(time.Second), Reads: ReadsFresh, kind: metricKindLatency},
+		},
+		{
+			name:   "invalid expression",
+			expr:   "create_purchase.p99",
+			expErr: errors.New(`invalid threshold: "create_purchase.p99"`),
+		},
+		{
+			name:   "invalid metric",
+			expr:   "create_purchase.p101 < 1s",
+			expErr: errors.New(`invalid threshold metric: "p101"`),
+		},
+		{
+			name:   "invalid value",
+			expr:   "create_purchase.p99 < fast",
+			expErr: errors.New(`parsing value for threshold "create_purchase.p99 < fast": time: invalid duration "fast"`),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act, err := ParseThreshold(c.expr)
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr.Error(), err.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+
+			c.exp.expr = c.expr
+			assert.InDelta(t, c.exp.Value, act.Value, 0.000001)
+			c.exp.Value = act.Value
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestThresholdUnmarshalYAML(t *testing.T) {
+	var act []Threshold
+	err := yaml.Unmarshal([]byte(`
+- create_purchase.p99 < 250ms
+- threshold: "*.error_rate < 1%"
+  abort_on_fail: true
+`), &act)
+	assert.NoError(t, err)
+
+	assert.Len(t, act, 2)
+	assert.False(t, act[0].AbortOnFail)
+	assert.Equal(t, "*.error_rate < 1%", act[1].String())
+	assert.True(t, act[1].AbortOnFail)
+}
+
+func TestThresholdEvaluate(t *testing.T) {
+	stats := []QueryStats{
+		{Workflow: "shop", Name: "browse", Count: 10, Errors: 1, Latency: newHistogram(time.Millisecond, 2*time.Millisecond)},
+		{Workflow: "shop", Name: "buy", Count: 10, Latency: newHistogram(100 * time.Millisecond)},
+		{Workflow: "shop", Name: "history", Count: 10, Stale: true, Latency: newHistogram(time.Second)},
+	}
+
+	cases := []struct {
+		name string
+		expr string
+		exp  []ThresholdResult
+	}{
+		{
+			name: "passes",
+			expr: "browse.p99 < 5ms",
+			exp:  []ThresholdResult{{Workflow: "shop", Name: "browse", Actual: "2ms", Pass: true}},
+		},
+		{
+			name: "fails",
+			expr: "shop.buy.max < 50ms",
+			exp:  []ThresholdResult{{Workflow: "shop", Name: "buy", Actual: "100ms", Pass: false}},
+		},
+		{
+			name: "wildcard",
+			expr: "*.error_rate < 5%",
+			exp: []ThresholdResult{
+				{Workflow: "shop", Name: "browse", Actual: "10.00%", Pass: false},
+				{Workflow: "shop", Name: "buy", Actual: "0.00%", Pass: true},
+				{Workflow: "shop", Name: "history", Actual: "0.00%", Pass: true},
+			},
+		},
+		{
+			name: "stale reads",
+			expr: "stale:*.p99 < 2s",
+			exp:  []ThresholdResult{{Workflow: "shop", Name: "history", Actual: "1s", Pass: true}},
+		},
+		{
+			name: "fresh reads",
+			expr: "fresh:*.max < 50ms",
+			exp: []ThresholdResult{
+				{Workflow: "shop", Name: "browse", Actual: "2ms", Pass: true},
+				{Workflow: "shop", Name: "buy", Actual: "100ms", Pass: false},
+			},
+		},
+		{
+			name: "throughput",
+			expr: "buy.throughput >= 1/s",
+			exp:  []ThresholdResult{{Workflow: "shop", Name: "buy", Actual: "1.00/s", Pass: true}},
+		},
+		{
+			name: "no matching queries",
+			expr: "missing.count > 0",
+			exp:  []ThresholdResult{{Actual: "no matching queries", Pass: false}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			threshold, err := ParseThreshold(c.expr)
+			assert.NoError(t, err)
+
+			for i := range c.exp {
+				c.exp[i].Threshold = threshold
+			}
+
+			assert.Equal(t, c.exp, threshold.Evaluate(stats, 10*time.Second))
+		})
+	}
+}
+
+func TestThresholdWatcherCheck(t *testing.T) {
+	start := time.Now()
+
+	cases := []struct {
+		name    string
+		expr    string
+		samples []QueryStats
+		exp     []bool
+	}{
+		{
+			name: "no runs yet",
+			expr: "browse.throughput > 10/s",
+			samples: []QueryStats{
+				{Workflow: "shop", Name: "browse"},
+				{Workflow: "shop", Name: "browse"},
+				{Workflow: "shop", Name: "browse"},
+			},
+		},
+		{
+			name: "warming up",
+			expr: "browse.throughput > 10/s",
+			samples: []QueryStats{
+				{Workflow: "shop", Name: "browse", Count: 1},
+				{Workflow: "shop", Name: "browse", Count: 2},
+			},
+		},
+		{
+			name: "too few runs in window",
+			expr: "browse.error_rate < 10%",
+			samples: []QueryStats{
+				{Workflow: "shop", Name: "browse", Count: 1},
+				{Workflow: "shop", Name: "browse", Count: 5, Errors: 4},
+				{Workflow: "shop", Name: "browse", Count: 9, Errors: 8},
+			},
+		},
+		{
+			name: "throughput measured from first run",
+			expr: "browse.throughput >= 10/s",
+			samples: []QueryStats{
+				{Workflow: "shop", Name: "browse"},
+				{Workflow: "shop", Name: "browse", Count: 5},
+				{Workflow: "shop", Name: "browse", Count: 15},
+				{Workflow: "shop", Name: "browse", Count: 25},
+			},
+			exp: []bool{true, true},
+		},
+		{
+			name: "throughput measured over window",
+			expr: "browse.throughput >= 10/s",
+			samples: []QueryStats{
+				{Workflow: "shop", Name: "browse", Count: 100},
+				{Workflow: "shop", Name: "browse", Count: 200},
+				{Workflow: "shop", Name: "browse", Count: 210},
+				{Workflow: "shop", Name: "browse", Count: 220, Errors: 5},
+			},
+			exp: []bool{true, true, false},
+		},
+		{
+			name: "count lower bound not checked",
+			expr: "browse.count > 1000",
+			samples: []QueryStats{
+				{Workflow: "shop", Name: "browse", Count: 1},
+				{Workflow: "shop", Name: "browse", Count: 2},
+			},
+		},
+		{
+			name: "count upper bound",
+			expr: "browse.errors < 2",
+			samples: []QueryStats{
+				{Workflow: "shop", Name: "browse", Count: 1},
+				{Workflow: "shop", Name: "browse", Count: 2, Errors: 2},
+			},
+			exp: []bool{true, false},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			threshold, err := ParseThreshold(c.expr)
+			assert.NoError(t, err)
+			threshold.AbortOnFail = true
+
+			w := newThresholdWatcher([]Threshold{threshold}, time.Second)
+
+			var act []bool
+			for i, qs := range c.samples {
+				for _, r := range w.check(start.Add(time.Duration(i)*time.Second), []QueryStats{qs}) {
+					act = append(act, r.Pass)
+				}
+			}
+
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestWatchThresholds(t *testing.T) {
+	cases := []struct {
+		name     string
+		expr     string
+		expAbort bool
+	}{
+		{
+			name: "passing throughput",
+			expr: "browse.throughput > 20/s",
+		},
+		{
+			name: "passing count lower bound",
+			expr: "browse.count > 1000000",
+		},
+		{
+			name:     "failing throughput",
+			expr:     "browse.throughput > 1000/s",
+			expAbort: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rate := Rate{Times: 1, Interval: 10 * time.Millisecond, tickerInterval: 10 * time.Millisecond}
+
+			cfg := Drk{
+				Workflows: map[string]Workflow{
+					"shop": {
+						Vus:     1,
+						Queries: []WorkflowQuery{{Name: "browse", Rate: rate}},
+					},
+				},
+				Activities: map[string]Query{
+					"browse": {Type: "query", Query: "SELECT 1"},
+				},
+			}
+
+			db := mockQueryer{
+				query: func(string, ...any) ([]map[string]any, repo.Stats, error) {
+					return nil, repo.Stats{}, nil
+				},
+			}
+
+			r, err := NewRunner(&cfg, &db, "", "", time.Second, &zerolog.Logger{})
+			assert.NoError(t, err)
+
+			threshold, err := ParseThreshold(c.expr)
+			assert.NoError(t, err)
+			threshold.AbortOnFail = true
+
+			done := make(chan struct{})
+			defer close(done)
+			aborted := r.watchThresholds([]Threshold{threshold}, 20*time.Millisecond, 200*time.Millisecond, done)
+
+			finished := make(chan error, 1)
+			go func() {
+				finished <- r.Run()
+			}()
+
+			select {
+			case results := <-aborted:
+				assert.True(t, c.expAbort, "aborted: %+v", results)
+				r.Stop()
+				assert.NoError(t, <-finished)
+
+			case err = <-finished:
+				assert.False(t, c.expAbort, "run finished without aborting")
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package model
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Bucket holds the results of a query within an interval of a run.
+// Latencies are in milliseconds.
+type Bucket struct {
+	Time              time.Time `json:"time"`
+	Workflow          string    `json:"workflow"`
+	Query             string    `json:"query"`
+	Count             int       `json:"count"`
+	Errors            int       `json:"errors"`
+	AssertionFailures int       `json:"assertion_failures"`
+	P50Ms             float64   `json:"p50_ms"`
+	P95Ms             float64   `json:"p95_ms"`
+	P99Ms             float64   `json:"p99_ms"`
+	ActiveVUs         int       `json:"active_vus"`
+}
+
+// BucketWriter writes the buckets of each interval as they're closed.
+type BucketWriter interface {
+	Write([]Bucket) error
+}
+
+// NewBucketWriter returns a BucketWriter for the given format [csv,
+// jsonl].
+func NewBucketWriter(w io.Writer, format string) (BucketWriter, error) {
+	switch format {
+	case "csv":
+		return &csvBucketWriter{w: csv.NewWriter(w)}, nil
+	case "jsonl":
+		return &jsonBucketWriter{enc: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported time series format: %q", format)
+	}
+}
+
+// TimeSeries splits the results of a run into fixed intervals, writing
+// the buckets of each interval once it closes.
+type TimeSeries struct {
+	writer    BucketWriter
+	harvest   func() []QueryStats
+	activeVUs func() map[string]int
+
+	start time.Time
+	prev  map[string]QueryStats
+}
+
+// NewTimeSeries returns a TimeSeries that writes to the given writer,
+// calling harvest to get the cumulative results of each query and
+// activeVUs to get the number of VUs running each workflow at the end of
+// each interval.
+func NewTimeSeries(writer BucketWriter, harvest func() []QueryStats, activeVUs func() map[string]int) *TimeSeries {
+	return &TimeSeries{
+		writer:    writer,
+		harvest:   harvest,
+		activeVUs: activeVUs,
+		prev:      map[string]QueryStats{},
+	}
+}
+
+// Run closes the current interval on each tick and once done is closed.
+// Every query gets a bucket in every interval, with zero counts if it
+// didn't complete in it, so that stalls show up as gaps in throughput
+// rather than missing rows. Setup queries are excluded.
+func (ts *TimeSeries) Run(start time.Time, ticks <-chan time.Time, done <-chan struct{}) error {
+	ts.start = start
+
+	for {
+		select {
+		case now := <-ticks:
+			if err := ts.flush(); err != nil {
+				return err
+			}
+			ts.start = now
+
+		case <-done:
+			return ts.flush()
+		}
+	}
+}
+
+func (ts *TimeSeries) flush() error {
+	var buckets []Bucket
+	var activeVUs map[string]int
+
+	for _, qs := range withoutSetup(ts.harvest()) {
+		key := qs.Workflow + "." + qs.Name
+
+		d := qs.Sub(ts.prev[key])
+		ts.prev[key] = qs
+
+		if activeVUs == nil {
+			activeVUs = ts.activeVUs()
+		}
+
+		buckets = append(buckets, Bucket{
+			Time:              ts.start,
+			Workflow:          d.Workflow,
+			Query:             d.Name,
+			Count:             d.Count,
+			Errors:            d.Errors,
+			AssertionFailures: d.AssertionFailures,
+			P50Ms:             millis(d.Percentile(50)),
+			P95Ms:             millis(d.Percentile(95)),
+			P99Ms:             millis(d.Percentile(99)),
+			ActiveVUs:         activeVUs[d.Workflow],
+		})
+	}
+
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	if err := ts.writer.Write(buckets); err != nil {
+		return fmt.Errorf("writing buckets: %w", err)
+	}
+
+	return nil
+}
+
+type csvBucketWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (w *csvBucketWriter) Write(buckets []Bucket) error {
+	if !w.headerWritten {
+		header := []string{"time", "workflow", "query", "count", "errors", "assertion_failures", "p50_ms", "p95_ms", "p99_ms", "active_vus"}
+		if err := w.w.Write(header); err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	for _, b := range buckets {
+		row := []string{
+			b.Time.Format(time.RFC3339Nano),
+			b.Workflow,
+			b.Query,
+			strconv.Itoa(b.Count),
+			strconv.Itoa(b.Errors),
+			strconv.Itoa(b.AssertionFailures),
+			f(b.P50Ms),
+			f(b.P95Ms),
+			f(b.P99Ms),
+			strconv.Itoa(b.ActiveVUs),
+		}
+
+		if err := w.w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type jsonBucketWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonBucketWriter) Write(buckets []Bucket) error {
+	for _, b := range buckets {
+		if err := w.enc.Encode(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
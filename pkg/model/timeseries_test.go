@@ -0,0 +1,151 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeSeries(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	exp := []Bucket{
+		{Time: start, Workflow: "shop", Query: "browse", Count: 3, Errors: 1, P50Ms: 1, P95Ms: 2, P99Ms: 2, ActiveVUs: 2},
+		{Time: start, Workflow: "shop", Query: "buy", Count: 1, AssertionFailures: 1, P50Ms: 5, P95Ms: 5, P99Ms: 5, ActiveVUs: 2},
+		{Time: start.Add(time.Second), Workflow: "shop", Query: "browse", ActiveVUs: 2},
+		{Time: start.Add(time.Second), Workflow: "shop", Query: "buy", ActiveVUs: 2},
+		{Time: start.Add(2 * time.Second), Workflow: "shop", Query: "browse", Count: 1, P50Ms: 3, P95Ms: 3, P99Ms: 3, ActiveVUs: 2},
+		{Time: start.Add(2 * time.Second), Workflow: "shop", Query: "buy", ActiveVUs: 2},
+	}
+
+	cases := []struct {
+		name   string
+		format string
+		parse  func(*testing.T, []byte) []Bucket
+	}{
+		{name: "csv", format: "csv", parse: parseCSVBuckets},
+		{name: "jsonl", format: "jsonl", parse: parseJSONBuckets},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewBucketWriter(&buf, c.format)
+			assert.NoError(t, err)
+
+			var r Runner
+			setup := r.newAggregator("*shop", "setup", Query{})
+			browse := r.newAggregator("shop", "browse", Query{})
+			buy := r.newAggregator("shop", "buy", Query{})
+
+			// Signal each harvest, so that results are only recorded once
+			// the previous interval has been closed.
+			harvested := make(chan struct{}, 3)
+			harvest := func() []QueryStats {
+				defer func() { harvested <- struct{}{} }()
+				return r.Harvest()
+			}
+
+			ts := NewTimeSeries(writer, harvest, func() map[string]int {
+				return map[string]int{"shop": 2}
+			})
+
+			ticks := make(chan time.Time)
+			done := make(chan struct{})
+
+			errs := make(chan error)
+			go func() {
+				errs <- ts.Run(start, ticks, done)
+			}()
+
+			setup.record(repo.Stats{Query: time.Millisecond}, nil)
+			browse.record(repo.Stats{Query: 2 * time.Millisecond}, nil)
+			browse.record(repo.Stats{Query: time.Millisecond}, nil)
+			browse.record(repo.Stats{}, errors.New("connection reset"))
+			buy.record(repo.Stats{Query: 5 * time.Millisecond}, AssertionErr{})
+			ticks <- start.Add(time.Second)
+			<-harvested
+
+			// Intervals without results are written as zero buckets.
+			ticks <- start.Add(2 * time.Second)
+			<-harvested
+
+			browse.record(repo.Stats{Query: 3 * time.Millisecond}, nil)
+			close(done)
+
+			assert.NoError(t, <-errs)
+			assert.Equal(t, exp, c.parse(t, buf.Bytes()))
+		})
+	}
+}
+
+// Latencies are rounded to the nearest millisecond, as the histogram
+// only approximates them.
+func parseCSVBuckets(t *testing.T, b []byte) []Bucket {
+	rows, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"time", "workflow", "query", "count", "errors", "assertion_failures", "p50_ms", "p95_ms", "p99_ms", "active_vus"}, rows[0])
+
+	atoi := func(s string) int {
+		i, err := strconv.Atoi(s)
+		assert.NoError(t, err)
+		return i
+	}
+	ms := func(s string) float64 {
+		f, err := strconv.ParseFloat(s, 64)
+		assert.NoError(t, err)
+		return math.Round(f)
+	}
+
+	var buckets []Bucket
+	for _, row := range rows[1:] {
+		ts, err := time.Parse(time.RFC3339Nano, row[0])
+		assert.NoError(t, err)
+
+		buckets = append(buckets, Bucket{
+			Time:              ts,
+			Workflow:          row[1],
+			Query:             row[2],
+			Count:             atoi(row[3]),
+			Errors:            atoi(row[4]),
+			AssertionFailures: atoi(row[5]),
+			P50Ms:             ms(row[6]),
+			P95Ms:             ms(row[7]),
+			P99Ms:             ms(row[8]),
+			ActiveVUs:         atoi(row[9]),
+		})
+	}
+
+	return buckets
+}
+
+func parseJSONBuckets(t *testing.T, b []byte) []Bucket {
+	var buckets []Bucket
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		var bucket Bucket
+		assert.NoError(t, json.Unmarshal(s.Bytes(), &bucket))
+
+		bucket.P50Ms = math.Round(bucket.P50Ms)
+		bucket.P95Ms = math.Round(bucket.P95Ms)
+		bucket.P99Ms = math.Round(bucket.P99Ms)
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets
+}
+
+func TestNewBucketWriter(t *testing.T) {
+	_, err := NewBucketWriter(&bytes.Buffer{}, "xml")
+	assert.Equal(t, errors.New(`unsupported time series format: "xml"`), err)
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the instrumentation scope drk's spans are reported under.
+const tracerName = "github.com/codingconcepts/drk"
+
+// noopTracer is used unless a tracer provider is set, so that tracing
+// costs next to nothing when it's disabled.
+var noopTracer = noop.NewTracerProvider().Tracer(tracerName)
+
+// SetTracerProvider traces each activity run, and each statement within
+// it, using the given provider.
+func (r *Runner) SetTracerProvider(tp trace.TracerProvider) {
+	r.tracer = tp.Tracer(tracerName)
+}
+
+// startActivitySpan starts the span of an activity run by a VU, which is
+// its nth attempt at running the activity.
+func (r *Runner) startActivitySpan(vu *VU, workflowName, queryName string, attempt int) (context.Context, trace.Span) {
+	ctx, span := r.tracer.Start(context.Background(), "activity "+queryName)
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("drk.workflow", workflowName),
+			attribute.String("drk.query", queryName),
+			attribute.Int("drk.vu", vu.index),
+			attribute.Int("drk.attempt", attempt),
+		)
+	}
+
+	return ctx, span
+}
+
+// endActivitySpan ends the span of an activity run, recording the rows
+// it returned and the error it failed with, if any.
+func endActivitySpan(span trace.Span, rows int, err error) {
+	if span.IsRecording() {
+		span.SetAttributes(attribute.Int("drk.rows", rows))
+		recordError(span, err)
+	}
+
+	span.End()
+}
+
+// startStatementSpan starts the span of a statement run by an activity.
+func (r *Runner) startStatementSpan(ctx context.Context, vu *VU, stmt statement, args []any) trace.Span {
+	_, span := r.tracer.Start(ctx, "statement", trace.WithSpanKind(trace.SpanKindClient))
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("db.statement", stmt.query),
+			attribute.String("drk.args", fmt.Sprint(args)),
+			attribute.String("drk.connection", vu.connection),
+		)
+	}
+
+	return span
+}
+
+// endStatementSpan ends the span of a statement, recording where and
+// how long it waited for a connection, and the error it failed with.
+func endStatementSpan(span trace.Span, stats repo.Stats, err error) {
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("drk.node", stats.Node),
+			attribute.Int64("drk.pool_wait_us", stats.Wait.Microseconds()),
+		)
+		recordError(span, err)
+	}
+
+	span.End()
+}
+
+func recordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.SetAttributes(attribute.String("drk.error.class", errorClass(err)))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	queryer := mockQueryer{
+		query: func(query string, args ...any) ([]map[string]any, repo.Stats, error) {
+			return []map[string]any{{"id": 1}, {"id": 2}}, repo.Stats{Node: "a"}, nil
+		},
+	}
+
+	r, err := NewRunner(nil, &queryer, "", "", 0, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	recorder := tracetest.NewSpanRecorder()
+	r.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	vu := NewVU(&zerolog.Logger{})
+	vu.index = 3
+
+	query := Query{
+		Type:   "query",
+		Query:  "SELECT id FROM t WHERE v = $1",
+		Args:   []Arg{{generator: func(*VU) (any, error) { return "x", nil }, dependencyCheck: dependencyFuncNoop}},
+		Expect: Expect{Rows: &Count{Min: 1, Max: 1}},
+	}
+
+	ctx, span := r.startActivitySpan(vu, "shop", "browse", 2)
+	data, _, err := r.runQuery(ctx, vu, query)
+	endActivitySpan(span, len(data), err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+
+	stmt, activity := spans[0], spans[1]
+
+	assert.Equal(t, "statement", stmt.Name())
+	assert.Equal(t, activity.SpanContext().SpanID(), stmt.Parent().SpanID())
+	assert.Equal(t, codes.Unset, stmt.Status().Code)
+	assert.Subset(t, stmt.Attributes(), []attribute.KeyValue{
+		attribute.String("db.statement", "SELECT id FROM t WHERE v = $1"),
+		attribute.String("drk.args", "[x]"),
+		attribute.String("drk.node", "a"),
+	})
+
+	assert.Equal(t, "activity browse", activity.Name())
+	assert.Equal(t, codes.Error, activity.Status().Code)
+	assert.Subset(t, activity.Attributes(), []attribute.KeyValue{
+		attribute.String("drk.workflow", "shop"),
+		attribute.String("drk.query", "browse"),
+		attribute.Int("drk.vu", 3),
+		attribute.Int("drk.attempt", 2),
+		attribute.Int("drk.rows", 2),
+		attribute.String("drk.error.class", ErrorClassAssertion),
+	})
+}
+
+func TestTracingDisabled(t *testing.T) {
+	r, err := NewRunner(nil, &mockQueryer{}, "", "", 0, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	_, span := r.startActivitySpan(NewVU(&zerolog.Logger{}), "shop", "browse", 1)
+	assert.False(t, span.IsRecording())
+
+	endActivitySpan(span, 0, errors.New("bad things happened"))
+}
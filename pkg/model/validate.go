@@ -0,0 +1,601 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is an issue found in a config file, at the position in the
+// file it was found.
+type Problem struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d:%d: %s", p.Line, p.Column, p.Message)
+}
+
+// ValidateOptions determine how thoroughly a config is validated.
+type ValidateOptions struct {
+	// Driver the config will be run with. Activities are also prepared
+	// for the driver of each named connection.
+	Driver string
+
+	// Describe, if provided, returns the columns a query returns, so
+	// that the columns referenced from its results can be checked.
+	Describe func(query string) ([]string, error)
+}
+
+// Validate statically checks a config document, reporting every problem
+// found rather than stopping at the first, ordered by their position in
+// the file.
+func Validate(doc *yaml.Node, opts ValidateOptions) []Problem {
+	v := validator{
+		opts:       opts,
+		activities: map[string]*activityInfo{},
+		columns:    map[string][]string{},
+	}
+
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		v.addf(root, "config must be a mapping")
+		return v.problems
+	}
+
+	v.validateUnknownFields(root)
+	v.validateTopLevel(root)
+	v.validateActivities(root)
+	v.validateWorkflows(root)
+
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		if v.problems[i].Line != v.problems[j].Line {
+			return v.problems[i].Line < v.problems[j].Line
+		}
+		return v.problems[i].Column < v.problems[j].Column
+	})
+
+	return lo.Uniq(v.problems)
+}
+
+type validator struct {
+	opts     ValidateOptions
+	problems []Problem
+
+	drivers     []string
+	connections map[string]Connection
+	activities  map[string]*activityInfo
+
+	// Columns returned by each activity's query, once described.
+	columns map[string][]string
+}
+
+// activityInfo is an activity that decoded successfully, along with the
+// nodes its problems are reported against.
+type activityInfo struct {
+	query     Query
+	node      *yaml.Node
+	queryNode *yaml.Node
+	args      []argInfo
+}
+
+type argInfo struct {
+	arg  Arg
+	node *yaml.Node
+	raw  map[string]any
+}
+
+func (v *validator) addf(n *yaml.Node, format string, args ...any) {
+	v.problems = append(v.problems, Problem{
+		Line:    n.Line,
+		Column:  n.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// addErr adds a problem for an error decoding a node, at the position
+// within the node that the error was found at, if known.
+func (v *validator) addErr(n *yaml.Node, desc string, err error) {
+	ce := nodeErr(n, "", err)
+	v.problems = append(v.problems, Problem{
+		Line:    ce.Line,
+		Column:  ce.Column,
+		Message: fmt.Sprintf("%s: %v", desc, ce.Err),
+	})
+}
+
+// validateUnknownFields adds a problem for each field in the config that
+// isn't part of it. Fields of args and other values that decode
+// themselves are checked as they're decoded.
+func (v *validator) validateUnknownFields(root *yaml.Node) {
+	c := fieldChecker{}
+	c.check(root, reflect.TypeOf(rawDrk{}), "")
+
+	for _, err := range c.errs {
+		v.problems = append(v.problems, Problem{
+			Line:    err.Line,
+			Column:  err.Column,
+			Message: fmt.Sprintf("%s: %v", err.Path, err.Err),
+		})
+	}
+}
+
+func (v *validator) validateTopLevel(root *yaml.Node) {
+	var cfg struct {
+		Pool          any                   `yaml:"pool"`
+		URLs          []NodeURL             `yaml:"urls"`
+		LoadBalancing string                `yaml:"load_balancing"`
+		Connections   map[string]Connection `yaml:"connections"`
+		Thresholds    []Threshold           `yaml:"thresholds"`
+	}
+
+	for _, key := range []string{"pool", "urls", "load_balancing", "connections"} {
+		if _, n := mappingValue(root, key); n != nil {
+			if err := withOnlyKeys(root, key).Decode(&cfg); err != nil {
+				v.addErr(n, key, err)
+			}
+		}
+	}
+
+	if _, n := mappingValue(root, "thresholds"); n != nil && n.Kind == yaml.SequenceNode {
+		for _, item := range n.Content {
+			var t Threshold
+			if err := item.Decode(&t); err != nil {
+				v.addErr(item, "threshold", err)
+			}
+		}
+	}
+
+	v.connections = cfg.Connections
+
+	if _, ok := placeholderStyles[v.opts.Driver]; ok {
+		v.drivers = append(v.drivers, v.opts.Driver)
+	} else {
+		v.addf(root, "unsupported driver: %q", v.opts.Driver)
+	}
+
+	_, connections := mappingValue(root, "connections")
+	for _, entry := range mappingEntries(connections) {
+		_, driverNode := mappingValue(entry[1], "driver")
+		if driverNode == nil || lo.Contains(v.drivers, driverNode.Value) {
+			continue
+		}
+
+		if _, ok := placeholderStyles[driverNode.Value]; !ok {
+			v.addf(driverNode, "connection %q: unsupported driver: %q", entry[0].Value, driverNode.Value)
+			continue
+		}
+		v.drivers = append(v.drivers, driverNode.Value)
+	}
+}
+
+func (v *validator) validateActivities(root *yaml.Node) {
+	key, activities := mappingValue(root, "activities")
+	if activities == nil {
+		v.addf(root, "no activities defined")
+		return
+	}
+	if activities.Kind != yaml.MappingNode {
+		v.addf(key, "activities must be a mapping")
+		return
+	}
+
+	for _, entry := range mappingEntries(activities) {
+		name, node := entry[0].Value, entry[1]
+
+		info, ok := v.validateActivity(name, node)
+		if ok {
+			v.activities[name] = info
+		}
+	}
+}
+
+func (v *validator) validateActivity(name string, node *yaml.Node) (*activityInfo, bool) {
+	info := activityInfo{node: node}
+
+	if node.Kind != yaml.MappingNode {
+		v.addf(node, "activity %q must be a mapping", name)
+		return nil, false
+	}
+
+	// Decode each field separately, so that one that's invalid doesn't
+	// hide problems with the others.
+	for _, entry := range mappingEntries(withoutKeys(node, "args")) {
+		if err := withOnlyKeys(node, entry[0].Value).Decode(&info.query); err != nil {
+			v.addErr(entry[1], fmt.Sprintf("activity %q", name), err)
+		}
+	}
+
+	_, info.queryNode = mappingValue(node, "query")
+	if info.queryNode == nil {
+		info.queryNode = node
+	}
+
+	switch info.query.Type {
+	case "query", "exec":
+	default:
+		_, typeNode := mappingValue(node, "type")
+		v.addf(lo.Ternary(typeNode != nil, typeNode, node), "activity %q: invalid type: %q (expected query or exec)", name, info.query.Type)
+	}
+
+	if strings.TrimSpace(info.query.Query) == "" {
+		v.addf(node, "activity %q: missing query", name)
+	}
+
+	valid := true
+	if _, args := mappingValue(node, "args"); args != nil && args.Kind == yaml.SequenceNode {
+		for i, argNode := range args.Content {
+			arg, ok := v.validateArg(fmt.Sprintf("activity %q arg %d", name, i), argNode)
+			valid = valid && ok
+
+			info.args = append(info.args, arg)
+			info.query.Args = append(info.query.Args, arg.arg)
+		}
+	}
+
+	// Placeholders can only be checked against args that parsed.
+	if !valid {
+		return &info, true
+	}
+
+	for _, driver := range v.drivers {
+		if err := info.query.prepare(driver, placeholderStyles[driver]); err != nil {
+			v.addf(info.queryNode, "activity %q: preparing for %s: %v", name, driver, err)
+		}
+	}
+
+	if err := checkPlaceholders(info.query, v.opts.Driver); err != nil {
+		v.addf(info.queryNode, "activity %q: %v", name, err)
+	}
+
+	return &info, true
+}
+
+// validateArg checks that an arg parses and, for args that don't depend
+// on a VU's state, that it generates a value.
+func (v *validator) validateArg(desc string, node *yaml.Node) (argInfo, bool) {
+	info := argInfo{node: node}
+
+	if err := node.Decode(&info.raw); err != nil {
+		v.addErr(node, desc, err)
+		return info, false
+	}
+
+	if err := node.Decode(&info.arg); err != nil {
+		v.addErr(node, desc, err)
+		return info, false
+	}
+
+	switch info.arg.Type {
+	case "ref", "var":
+		return info, true
+	}
+
+	logger := zerolog.Nop()
+	if _, err := info.arg.generator(NewVU(&logger)); err != nil {
+		v.addf(node, "%s: %v", desc, err)
+		return info, false
+	}
+
+	return info, true
+}
+
+func (v *validator) validateWorkflows(root *yaml.Node) {
+	key, workflows := mappingValue(root, "workflows")
+	if workflows == nil {
+		v.addf(root, "no workflows defined")
+		return
+	}
+	if workflows.Kind != yaml.MappingNode {
+		v.addf(key, "workflows must be a mapping")
+		return
+	}
+
+	for _, entry := range mappingEntries(workflows) {
+		v.validateWorkflow(entry[0].Value, entry[1])
+	}
+}
+
+func (v *validator) validateWorkflow(name string, node *yaml.Node) {
+	var workflow Workflow
+	if node.Kind != yaml.MappingNode {
+		v.addf(node, "workflow %q must be a mapping", name)
+		return
+	}
+
+	for _, entry := range mappingEntries(withoutKeys(node, "queries", "vars")) {
+		if err := withOnlyKeys(node, entry[0].Value).Decode(&workflow); err != nil {
+			v.addErr(entry[1], fmt.Sprintf("workflow %q", name), err)
+		}
+	}
+
+	if workflow.Connection != "" {
+		if _, ok := v.connections[workflow.Connection]; !ok {
+			_, connNode := mappingValue(node, "connection")
+			v.addf(connNode, "workflow %q: missing connection: %q", name, workflow.Connection)
+		}
+	}
+
+	// Activities whose results and captured vars are available to the
+	// workflow's args.
+	var setup, used []string
+	vars := map[string]bool{}
+
+	if _, n := mappingValue(node, "setup_queries"); n != nil && n.Kind == yaml.SequenceNode {
+		for _, item := range n.Content {
+			if _, ok := v.activities[item.Value]; !ok {
+				v.addf(item, "workflow %q: missing activity: %q", name, item.Value)
+				continue
+			}
+			setup = append(setup, item.Value)
+		}
+	}
+
+	if _, n := mappingValue(node, "queries"); n != nil && n.Kind == yaml.SequenceNode {
+		for _, item := range n.Content {
+			var wq WorkflowQuery
+			if err := item.Decode(&wq); err != nil {
+				_, rateNode := mappingValue(item, "rate")
+				v.addErr(lo.Ternary(rateNode != nil, rateNode, item), fmt.Sprintf("workflow %q query", name), err)
+			}
+
+			nameKey, nameNode := mappingValue(item, "name")
+			if nameNode == nil {
+				v.addf(item, "workflow %q query: missing name", name)
+				continue
+			}
+			if _, ok := v.activities[nameNode.Value]; !ok {
+				v.addf(lo.Ternary(nameNode.Line > 0, nameNode, nameKey), "workflow %q: missing activity: %q", name, nameNode.Value)
+				continue
+			}
+			used = append(used, nameNode.Value)
+		}
+	}
+
+	for _, act := range append(setup, used...) {
+		for varName := range v.activities[act].query.Capture {
+			vars[varName] = true
+		}
+	}
+
+	if _, n := mappingValue(node, "vars"); n != nil && n.Kind == yaml.MappingNode {
+		// Vars are initialised after any others they read, so they may
+		// read any var the workflow defines, wherever it's defined.
+		entries := mappingEntries(n)
+		for _, entry := range entries {
+			vars[entry[0].Value] = true
+		}
+
+		defined := map[string]Arg{}
+		for _, entry := range entries {
+			arg, ok := v.validateArg(fmt.Sprintf("workflow %q var %q", name, entry[0].Value), entry[1])
+			if ok {
+				// Vars are initialised once setup queries have run.
+				v.checkArgRefs(fmt.Sprintf("workflow %q var %q", name, entry[0].Value), name, arg, setup, vars)
+				defined[entry[0].Value] = arg.arg
+			}
+		}
+
+		if _, err := varOrder(defined); err != nil {
+			v.addf(n, "workflow %q: %v", name, err)
+		}
+	}
+
+	produced := append(setup, used...)
+	for _, act := range lo.Uniq(produced) {
+		info := v.activities[act]
+		for i, arg := range info.args {
+			v.checkArgRefs(fmt.Sprintf("activity %q arg %d", act, i), name, arg, produced, vars)
+		}
+		v.checkCapture(act, info)
+	}
+}
+
+// checkArgRefs checks that a ref arg references a query the workflow runs
+// and that a var arg references a var the workflow defines or captures.
+func (v *validator) checkArgRefs(desc, workflowName string, arg argInfo, produced []string, vars map[string]bool) {
+	switch arg.arg.Type {
+	case "ref":
+		query, _ := arg.raw["query"].(string)
+		column, _ := arg.raw["column"].(string)
+		_, queryNode := mappingValue(arg.node, "query")
+		_, columnNode := mappingValue(arg.node, "column")
+
+		ref, ok := v.activities[query]
+		if !ok {
+			v.addf(queryNode, "%s: references missing activity: %q", desc, query)
+			return
+		}
+
+		if !lo.Contains(produced, query) {
+			v.addf(queryNode, "%s: references query %q, which workflow %q doesn't run", desc, query, workflowName)
+			return
+		}
+
+		if ref.query.Type == "exec" {
+			v.addf(queryNode, "%s: references exec activity %q, which returns no rows", desc, query)
+			return
+		}
+
+		if columns, ok := v.describe(query, ref); ok && !lo.Contains(columns, column) {
+			v.addf(columnNode, "%s: query %q doesn't return column %q (returns: %s)", desc, query, column, strings.Join(columns, ", "))
+		}
+
+	case "var":
+		name, _ := arg.raw["value"].(string)
+		if !vars[name] {
+			_, valueNode := mappingValue(arg.node, "value")
+			v.addf(valueNode, "%s: var %q isn't defined or captured by workflow %q", desc, name, workflowName)
+		}
+	}
+}
+
+// checkCapture checks that the columns an activity captures into vars are
+// returned by its query.
+func (v *validator) checkCapture(name string, info *activityInfo) {
+	if len(info.query.Capture) == 0 {
+		return
+	}
+
+	columns, ok := v.describe(name, info)
+	if !ok {
+		return
+	}
+
+	_, captureNode := mappingValue(info.node, "capture")
+	for _, entry := range mappingEntries(captureNode) {
+		if !lo.Contains(columns, entry[1].Value) {
+			v.addf(entry[1], "activity %q: captures column %q, which its query doesn't return (returns: %s)", name, entry[1].Value, strings.Join(columns, ", "))
+		}
+	}
+}
+
+// describe returns the columns an activity's query returns, if they can
+// be learned from the database.
+func (v *validator) describe(name string, info *activityInfo) ([]string, bool) {
+	if v.opts.Describe == nil {
+		return nil, false
+	}
+
+	if columns, ok := v.columns[name]; ok {
+		return columns, columns != nil
+	}
+
+	columns, err := v.opts.Describe(info.query.statement(v.opts.Driver).query)
+	if err != nil {
+		v.addf(info.queryNode, "activity %q: describing query: %v", name, err)
+	}
+	v.columns[name] = columns
+
+	return columns, columns != nil
+}
+
+// checkPlaceholders checks that the positional placeholders of a query,
+// as run against the given driver, and of each of its per-driver
+// overrides match its args. Queries using named placeholders are checked
+// when prepared.
+func checkPlaceholders(q Query, driver string) error {
+	if lo.SomeBy(q.Args, func(a Arg) bool { return a.Name != "" }) {
+		return nil
+	}
+
+	if err := countPlaceholders(q.Query, len(q.Args), placeholderStyles[driver]); err != nil {
+		return err
+	}
+
+	overrides := lo.Keys(q.QueryByDriver)
+	sort.Strings(overrides)
+
+	for _, d := range overrides {
+		if err := countPlaceholders(q.QueryByDriver[d], len(q.Args), placeholderStyles[d]); err != nil {
+			return fmt.Errorf("query_by_driver %s: %w", d, err)
+		}
+	}
+
+	return nil
+}
+
+// countPlaceholders checks that the positional placeholders in a query
+// match the number of args it's given.
+func countPlaceholders(query string, args int, style placeholderStyle) error {
+	var highest, questionMarks int
+	_, err := rewriteUnquoted(query, style, func(i int) (string, int, error) {
+		switch {
+		case query[i] == '?':
+			questionMarks++
+
+		case query[i] == '$':
+			end := i + 1
+			for end < len(query) && isDigit(query[end]) {
+				end++
+			}
+			if n, err := strconv.Atoi(query[i+1 : end]); err == nil {
+				highest = max(highest, n)
+			}
+		}
+		return "", i, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case highest > 0 && highest > args:
+		return fmt.Errorf("placeholder $%d has no matching arg (%d args)", highest, args)
+	case highest > 0 && highest < args:
+		return fmt.Errorf("%d args but placeholders only reference %d", args, highest)
+	case highest == 0 && questionMarks > 0 && questionMarks != args:
+		return fmt.Errorf("%d ? placeholders but %d args", questionMarks, args)
+	case highest == 0 && questionMarks == 0 && args > 0:
+		return fmt.Errorf("%d args but no placeholders", args)
+	}
+
+	return nil
+}
+
+// mappingEntries returns the key and value nodes of a mapping.
+func mappingEntries(n *yaml.Node) [][2]*yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var entries [][2]*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		entries = append(entries, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+	}
+
+	return entries
+}
+
+// mappingValue returns the key and value nodes of a mapping's key, or
+// nils if it's missing.
+func mappingValue(n *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for _, entry := range mappingEntries(n) {
+		if entry[0].Value == key {
+			return entry[0], entry[1]
+		}
+	}
+
+	return nil, nil
+}
+
+// withoutKeys returns a copy of a mapping without the given keys.
+func withoutKeys(n *yaml.Node, keys ...string) *yaml.Node {
+	return filterMapping(n, func(key string) bool {
+		return !lo.Contains(keys, key)
+	})
+}
+
+// withOnlyKeys returns a copy of a mapping with only the given keys.
+func withOnlyKeys(n *yaml.Node, keys ...string) *yaml.Node {
+	return filterMapping(n, func(key string) bool {
+		return lo.Contains(keys, key)
+	})
+}
+
+func filterMapping(n *yaml.Node, keep func(string) bool) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return n
+	}
+
+	out := *n
+	out.Content = nil
+	for _, entry := range mappingEntries(n) {
+		if keep(entry[0].Value) {
+			out.Content = append(out.Content, entry[0], entry[1])
+		}
+	}
+
+	return &out
+}
@@ -0,0 +1,384 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   string
+		describe func(string) ([]string, error)
+		exp      []string
+	}{
+		{
+			name: "valid",
+			config: `
+workflows:
+  w:
+    vus: 1
+    setup_queries:
+      - fetch
+    queries:
+      - name: make
+        rate: 1/1s
+activities:
+  fetch:
+    type: query
+    query: SELECT id FROM t
+  make:
+    type: exec
+    args:
+      - type: ref
+        query: fetch
+        column: id
+      - type: gen
+        value: email
+    query: INSERT INTO t VALUES ($1, $2)`,
+		},
+		{
+			name: "missing activities",
+			config: `
+workflows:
+  w:
+    vus: 1
+    setup_queries:
+      - nope
+    queries:
+      - name: missing
+        rate: 1/1s
+activities:
+  a:
+    type: query
+    query: SELECT 1`,
+			exp: []string{
+				`6:9: workflow "w": missing activity: "nope"`,
+				`8:15: workflow "w": missing activity: "missing"`,
+			},
+		},
+		{
+			name: "invalid rate",
+			config: `
+workflows:
+  w:
+    vus: 1
+    queries:
+      - name: a
+        rate: 10-1s
+activities:
+  a:
+    type: query
+    query: SELECT 1`,
+			exp: []string{
+				`7:15: workflow "w" query: invalid rate: "10-1s" (expected <times>/<interval>, e.g. 10/1s)`,
+			},
+		},
+		{
+			name: "unknown fields",
+			config: `
+workflows:
+  w:
+    vu: 1
+    queries:
+      - name: a
+        rate: 1/1s
+activities:
+  a:
+    type: exec
+    args:
+      - type: int
+        min: 1
+        max: 2
+        step: 1
+    query: INSERT INTO t VALUES ($1)`,
+			exp: []string{
+				`4:5: workflows.w: unknown field "vu"`,
+				`15:9: activity "a" arg 0: unknown field "step" (expected one of: max, min, name, type)`,
+			},
+		},
+		{
+			name: "missing generator",
+			config: `
+workflows:
+  w:
+    vus: 1
+    queries:
+      - name: a
+        rate: 1/1s
+activities:
+  a:
+    type: exec
+    args:
+      - type: gen
+        value: emial
+    query: INSERT INTO t VALUES ($1)`,
+			exp: []string{
+				`13:16: activity "a" arg 0: parsing gen arg type: missing generator: "emial"`,
+			},
+		},
+		{
+			name: "placeholder count",
+			config: `
+workflows:
+  w:
+    vus: 1
+    queries:
+      - name: a
+        rate: 1/1s
+activities:
+  a:
+    type: exec
+    args:
+      - type: gen
+        value: email
+    query: INSERT INTO t VALUES ($1, $2)`,
+			exp: []string{
+				`14:12: activity "a": placeholder $2 has no matching arg (1 args)`,
+			},
+		},
+		{
+			name: "ref to query not run by workflow",
+			config: `
+workflows:
+  w:
+    vus: 1
+    queries:
+      - name: a
+        rate: 1/1s
+activities:
+  fetch:
+    type: query
+    query: SELECT id FROM t
+  a:
+    type: exec
+    args:
+      - type: ref
+        query: fetch
+        column: id
+    query: INSERT INTO t VALUES ($1)`,
+			exp: []string{
+				`16:16: activity "a" arg 0: references query "fetch", which workflow "w" doesn't run`,
+			},
+		},
+		{
+			name: "undefined var",
+			config: `
+workflows:
+  w:
+    vus: 1
+    queries:
+      - name: a
+        rate: 1/1s
+activities:
+  a:
+    type: exec
+    args:
+      - type: var
+        value: user_id
+    query: INSERT INTO t VALUES ($1)`,
+			exp: []string{
+				`13:16: activity "a" arg 0: var "user_id" isn't defined or captured by workflow "w"`,
+			},
+		},
+		{
+			name: "var reads var defined after it",
+			config: `
+workflows:
+  w:
+    vus: 1
+    vars:
+      greeting:
+        type: var
+        value: name
+      name:
+        type: const
+        value: a
+    queries:
+      - name: a
+        rate: 1/1s
+activities:
+  a:
+    type: exec
+    args:
+      - type: var
+        value: greeting
+    query: INSERT INTO t VALUES ($1)`,
+		},
+		{
+			name: "vars read each other",
+			config: `
+workflows:
+  w:
+    vus: 1
+    vars:
+      a:
+        type: var
+        value: b
+      b:
+        type: var
+        value: a
+    queries:
+      - name: a
+        rate: 1/1s
+activities:
+  a:
+    type: exec
+    args:
+      - type: var
+        value: a
+    query: INSERT INTO t VALUES ($1)`,
+			exp: []string{
+				`6:7: workflow "w": vars read each other: a -> b -> a`,
+			},
+		},
+		{
+			name: "missing column",
+			config: `
+workflows:
+  w:
+    vus: 1
+    setup_queries:
+      - fetch
+    queries:
+      - name: a
+        rate: 1/1s
+activities:
+  fetch:
+    type: query
+    query: SELECT id FROM t
+  a:
+    type: exec
+    args:
+      - type: ref
+        query: fetch
+        column: idd
+    query: INSERT INTO t VALUES ($1)`,
+			describe: func(string) ([]string, error) {
+				return []string{"id"}, nil
+			},
+			exp: []string{
+				`19:17: activity "a" arg 0: query "fetch" doesn't return column "idd" (returns: id)`,
+			},
+		},
+		{
+			name: "describe error",
+			config: `
+workflows:
+  w:
+    vus: 1
+    queries:
+      - name: fetch
+        rate: 1/1s
+activities:
+  fetch:
+    type: query
+    capture:
+      user_id: id
+    query: SELECT id FROM t`,
+			describe: func(string) ([]string, error) {
+				return nil, errors.New(`relation "t" does not exist`)
+			},
+			exp: []string{
+				`13:12: activity "fetch": describing query: relation "t" does not exist`,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var doc yaml.Node
+			assert.NoError(t, yaml.Unmarshal([]byte(c.config), &doc))
+
+			problems := Validate(&doc, ValidateOptions{Driver: "pgx", Describe: c.describe})
+			act := lo.Map(problems, func(p Problem, _ int) string { return p.String() })
+
+			if len(c.exp) == 0 {
+				assert.Empty(t, act)
+				return
+			}
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestCheckPlaceholders(t *testing.T) {
+	cases := []struct {
+		name   string
+		query  Query
+		driver string
+		expErr error
+	}{
+		{
+			name:  "matching dollar placeholders",
+			query: Query{Query: "SELECT $1, $2", Args: []Arg{{}, {}}},
+		},
+		{
+			name:  "matching question marks",
+			query: Query{Query: "SELECT ?, ?", Args: []Arg{{}, {}}},
+		},
+		{
+			name:  "quoted placeholders ignored",
+			query: Query{Query: "SELECT '$2', $1", Args: []Arg{{}}},
+		},
+		{
+			name:   "too few args",
+			query:  Query{Query: "SELECT $1, $2", Args: []Arg{{}}},
+			expErr: errors.New("placeholder $2 has no matching arg (1 args)"),
+		},
+		{
+			name:   "too many args",
+			query:  Query{Query: "SELECT $1", Args: []Arg{{}, {}}},
+			expErr: errors.New("2 args but placeholders only reference 1"),
+		},
+		{
+			name:   "question mark mismatch",
+			query:  Query{Query: "SELECT ?", Args: []Arg{{}, {}}},
+			expErr: errors.New("1 ? placeholders but 2 args"),
+		},
+		{
+			name:   "no placeholders",
+			query:  Query{Query: "SELECT 1", Args: []Arg{{}}},
+			expErr: errors.New("1 args but no placeholders"),
+		},
+		{
+			name:  "named args",
+			query: Query{Query: "SELECT :a", Args: []Arg{{Name: "a"}}},
+		},
+		{
+			name:  "commented placeholders ignored",
+			query: Query{Query: "SELECT $1 -- not $2\n/* or $3 */", Args: []Arg{{}}},
+		},
+		{
+			name:   "backslash escapes",
+			query:  Query{Query: `SELECT 'it\'s ?', ?`, Args: []Arg{{}}},
+			driver: "mysql",
+		},
+		{
+			name: "driver override mismatch",
+			query: Query{
+				Query:         "SELECT $1",
+				QueryByDriver: map[string]string{"mysql": "SELECT ?, ?"},
+				Args:          []Arg{{}},
+			},
+			expErr: fmt.Errorf("query_by_driver mysql: %w", errors.New("2 ? placeholders but 1 args")),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			driver := c.driver
+			if driver == "" {
+				driver = "pgx"
+			}
+
+			err := checkPlaceholders(c.query, driver)
+			assert.Equal(t, c.expErr, err)
+		})
+	}
+}
@@ -2,26 +2,75 @@ package model
 
 import (
 	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/codingconcepts/drk/pkg/repo"
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
 )
 
 type VU struct {
+	// Results and vars, shared by each of the VU's activities.
+	*vuData
+
+	// Sources of random values, which aren't safe for concurrent use,
+	// so each of the VU's activities has its own.
+	rng   *rand.Rand
+	faker *gofakeit.Faker
+
+	// The Queryer statements are run against, if not the runner's own,
+	// along with the driver and name of the connection it belongs to.
+	db         repo.Queryer
+	driver     string
+	connection string
+
+	// Index of the VU within its workflow.
+	index int
+
+	// Session settings applied to each statement the VU runs.
+	settings map[string]string
+
+	logger *zerolog.Logger
+}
+
+type vuData struct {
 	// Map of query names to columns to rows.
 	dataMu sync.RWMutex
 	data   map[string][]map[string]any
 
-	logger *zerolog.Logger
+	// Map of query names to the way their results are retained.
+	retain map[string]Retain
+
+	// Map of variable names to values that live for the life of the VU.
+	vars map[string]any
 }
 
 func NewVU(logger *zerolog.Logger) *VU {
-	return &VU{
-		data:   map[string][]map[string]any{},
+	vu := VU{
+		vuData: &vuData{
+			data:   map[string][]map[string]any{},
+			retain: map[string]Retain{},
+			vars:   map[string]any{},
+		},
 		logger: logger,
 	}
+
+	return vu.withRand(newRand())
+}
+
+// withRand returns a copy of the VU that shares its results and vars,
+// but draws random values from the given source.
+func (vu *VU) withRand(rng *rand.Rand) *VU {
+	c := *vu
+	c.rng = rng
+	c.faker = gofakeit.NewFaker(rng, false)
+
+	return &c
 }
 
 func (vu *VU) stagger(queries []WorkflowQuery) {
@@ -30,28 +79,211 @@ func (vu *VU) stagger(queries []WorkflowQuery) {
 		return a.Rate.tickerInterval > b.Rate.tickerInterval
 	})
 
-	staggerDuration := Interval(0, maxTicks.Rate.tickerInterval)
+	staggerDuration := Interval(vu.rng, 0, maxTicks.Rate.tickerInterval)
 	time.Sleep(staggerDuration)
 }
 
-func (vu *VU) applyData(query string, data []map[string]any) {
+func (vu *VU) applyData(query string, retain Retain, data []map[string]any) {
+	vu.dataMu.Lock()
+	defer vu.dataMu.Unlock()
+
+	vu.retain[query] = retain
+	vu.data[query] = retain.apply(vu.rng, vu.data[query], data)
+}
+
+// initVars generates the value of each of a workflow's vars, after any
+// vars they read. Ref vars to the same query take their columns from the
+// same row.
+func (vu *VU) initVars(vars map[string]Arg) error {
+	order, err := varOrder(vars)
+	if err != nil {
+		return err
+	}
+
+	picked := map[string]map[string]any{}
+
+	for _, name := range order {
+		arg := vars[name]
+		if !arg.dependencyCheck(vu) {
+			vu.restoreRows(picked)
+			return fmt.Errorf("unmet dependency for var: %q", name)
+		}
+
+		v, err := vu.generateArg(arg, picked)
+		if err != nil {
+			vu.restoreRows(picked)
+			return fmt.Errorf("generating value for var %q: %w", name, err)
+		}
+
+		vu.dataMu.Lock()
+		vu.vars[name] = v
+		vu.dataMu.Unlock()
+	}
+
+	return nil
+}
+
+// varOrder returns the names of a workflow's vars in the order they're
+// initialised: each after any of the others it reads and by name
+// otherwise, so that every VU initialises them in the same order. Vars
+// that read each other can't be initialised, so they're rejected.
+func varOrder(vars map[string]Arg) ([]string, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	var order []string
+	state := map[string]int{}
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("vars read each other: %s", strings.Join(append(path, name), " -> "))
+		}
+
+		state[name] = visiting
+		if dep := vars[name].varName; dep != "" {
+			if _, ok := vars[dep]; ok {
+				if err := visit(dep, append(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = visited
+
+		order = append(order, name)
+		return nil
+	}
+
+	names := lo.Keys(vars)
+	slices.Sort(names)
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// captureVars sets each variable in capture to the value of its column
+// in the row of data, leaving variables unchanged if there are no rows.
+// Queries that capture vars must return at most one row, as there'd be
+// no telling which row's values were captured otherwise.
+func (vu *VU) captureVars(capture map[string]string, data []map[string]any) error {
+	if len(capture) == 0 || len(data) == 0 {
+		return nil
+	}
+	if len(data) > 1 {
+		return fmt.Errorf("capturing vars requires at most one row, got %d", len(data))
+	}
+
 	vu.dataMu.Lock()
 	defer vu.dataMu.Unlock()
 
-	vu.data[query] = data
+	for name, column := range capture {
+		value, ok := data[0][column]
+		if !ok {
+			return fmt.Errorf("missing column for var %q: %q", name, column)
+		}
+
+		vu.vars[name] = value
+	}
+
+	return nil
 }
 
-func (vu *VU) generateArgs(args []Arg) ([]any, error) {
+// generateArgs generates a value for each arg. Ref args to the same
+// query take their columns from the same row, so that they describe the
+// same entity, and the rows picked are returned so that any consumed
+// can be restored if the statement using them fails.
+func (vu *VU) generateArgs(args []Arg) ([]any, map[string]map[string]any, error) {
 	var values []any
+	picked := map[string]map[string]any{}
 
 	for _, arg := range args {
-		v, err := arg.generator(vu)
+		v, err := vu.generateArg(arg, picked)
 		if err != nil {
-			return nil, fmt.Errorf("generating value for arg: %w", err)
+			vu.restoreRows(picked)
+			return nil, nil, fmt.Errorf("generating value for arg: %w", err)
 		}
 
 		values = append(values, v)
 	}
 
-	return values, nil
+	return values, picked, nil
+}
+
+// generateArg generates a value for an arg, taking a ref arg's column
+// from the row already picked from its query, if there is one.
+func (vu *VU) generateArg(arg Arg, picked map[string]map[string]any) (any, error) {
+	if arg.refQuery == "" {
+		return arg.generator(vu)
+	}
+
+	row, ok := picked[arg.refQuery]
+	if !ok {
+		var err error
+		if row, err = vu.pickRow(arg.refQuery); err != nil {
+			return nil, err
+		}
+		picked[arg.refQuery] = row
+	}
+
+	return refColumn(row, arg.refColumn)
+}
+
+// pickRow returns a random row from a query's retained results. Rows of
+// queries retained with RetainConsume are removed as they're picked, so
+// that no two of the VU's activities can pick the same one.
+func (vu *VU) pickRow(query string) (map[string]any, error) {
+	vu.dataMu.Lock()
+	defer vu.dataMu.Unlock()
+
+	rows, ok := vu.data[query]
+	if !ok {
+		return nil, fmt.Errorf("missing query: %q", query)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no data found for %s", query)
+	}
+
+	i := vu.rng.IntN(len(rows))
+	row := rows[i]
+
+	if vu.retain[query].Mode == RetainConsume {
+		vu.data[query] = slices.Delete(rows, i, i+1)
+	}
+
+	return row, nil
+}
+
+// restoreRows returns picked rows to the results of queries retained
+// with RetainConsume, so that a failed statement doesn't lose them.
+func (vu *VU) restoreRows(picked map[string]map[string]any) {
+	vu.dataMu.Lock()
+	defer vu.dataMu.Unlock()
+
+	for query, row := range picked {
+		retain := vu.retain[query]
+		if retain.Mode != RetainConsume {
+			continue
+		}
+
+		vu.data[query] = retain.evict(vu.rng, append(vu.data[query], row))
+	}
+}
+
+func refColumn(row map[string]any, column string) (any, error) {
+	cell, ok := row[column]
+	if !ok {
+		return nil, fmt.Errorf("missing column: %q", column)
+	}
+
+	return cell, nil
 }
@@ -0,0 +1,163 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitVars(t *testing.T) {
+	cases := []struct {
+		name   string
+		vars   map[string]Arg
+		exp    map[string]any
+		expErr error
+	}{
+		{
+			name: "no vars",
+			exp:  map[string]any{},
+		},
+		{
+			name: "generated vars",
+			vars: map[string]Arg{
+				"a": {
+					generator:       func(*VU) (any, error) { return 1, nil },
+					dependencyCheck: dependencyFuncNoop,
+				},
+				"b": {
+					generator:       func(*VU) (any, error) { return "b", nil },
+					dependencyCheck: dependencyFuncNoop,
+				},
+			},
+			exp: map[string]any{"a": 1, "b": "b"},
+		},
+		{
+			name: "var reads var",
+			vars: map[string]Arg{
+				"a": {
+					generator: func(vu *VU) (any, error) {
+						return vu.vars["b"].(int) + 1, nil
+					},
+					dependencyCheck: func(vu *VU) bool {
+						_, ok := vu.vars["b"]
+						return ok
+					},
+					varName: "b",
+				},
+				"b": {
+					generator:       func(*VU) (any, error) { return 1, nil },
+					dependencyCheck: dependencyFuncNoop,
+				},
+			},
+			exp: map[string]any{"a": 2, "b": 1},
+		},
+		{
+			name: "vars read each other",
+			vars: map[string]Arg{
+				"a": {varName: "b"},
+				"b": {varName: "a"},
+			},
+			expErr: fmt.Errorf("vars read each other: a -> b -> a"),
+		},
+		{
+			name: "unmet dependency",
+			vars: map[string]Arg{
+				"a": {
+					generator:       func(*VU) (any, error) { return 1, nil },
+					dependencyCheck: func(*VU) bool { return false },
+				},
+			},
+			expErr: fmt.Errorf("unmet dependency for var: \"a\""),
+		},
+		{
+			name: "generator error",
+			vars: map[string]Arg{
+				"a": {
+					generator:       func(*VU) (any, error) { return nil, errors.New("bad things happened") },
+					dependencyCheck: dependencyFuncNoop,
+				},
+			},
+			expErr: fmt.Errorf("generating value for var \"a\": %w", errors.New("bad things happened")),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			vu := NewVU(&zerolog.Logger{})
+
+			err := vu.initVars(c.vars)
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, vu.vars)
+		})
+	}
+}
+
+func TestCaptureVars(t *testing.T) {
+	cases := []struct {
+		name    string
+		initial map[string]any
+		capture map[string]string
+		data    []map[string]any
+		exp     map[string]any
+		expErr  error
+	}{
+		{
+			name:    "captures row",
+			initial: map[string]any{},
+			capture: map[string]string{"member_id": "id"},
+			data: []map[string]any{
+				{"id": "a"},
+			},
+			exp: map[string]any{"member_id": "a"},
+		},
+		{
+			name:    "multiple rows",
+			initial: map[string]any{},
+			capture: map[string]string{"member_id": "id"},
+			data: []map[string]any{
+				{"id": "a"},
+				{"id": "b"},
+			},
+			expErr: fmt.Errorf("capturing vars requires at most one row, got 2"),
+		},
+		{
+			name:    "no rows leaves vars unchanged",
+			initial: map[string]any{"member_id": "a"},
+			capture: map[string]string{"member_id": "id"},
+			exp:     map[string]any{"member_id": "a"},
+		},
+		{
+			name:    "missing column",
+			initial: map[string]any{},
+			capture: map[string]string{"member_id": "non_existent"},
+			data: []map[string]any{
+				{"id": "a"},
+			},
+			expErr: fmt.Errorf("missing column for var \"member_id\": \"non_existent\""),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			vu := NewVU(&zerolog.Logger{})
+			vu.vars = c.initial
+
+			err := vu.captureVars(c.capture, c.data)
+			if c.expErr != nil {
+				assert.Equal(t, c.expErr, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, vu.vars)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"fmt"
+	"math/rand/v2"
 
 	"github.com/samber/lo"
 )
@@ -60,8 +61,8 @@ func makeWeightedItems(items []weightedItem) weightedItems {
 	return wi
 }
 
-func (wi weightedItems) choose() any {
-	randomWeight := Int(1, wi.totalWeight)
+func (wi weightedItems) choose(rng *rand.Rand) any {
+	randomWeight := Int(rng, 1, wi.totalWeight)
 	for _, i := range wi.items {
 		randomWeight -= i.Weight
 		if randomWeight <= 0 {
@@ -0,0 +1,305 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samber/lo"
+	"golang.org/x/sync/errgroup"
+)
+
+// controlWorkflow is the workflow name that changes made through the
+// control API, and the schema changes it runs, are reported under.
+const controlWorkflow = "ctl"
+
+// workflowState is the live state of a running workflow, which can be
+// changed while it runs.
+type workflowState struct {
+	name     string
+	workflow Workflow
+
+	paused atomic.Bool
+
+	// Multiplier applied to each query's rate, keyed by query name. The
+	// keys are fixed when the state is created, so the map is read
+	// without locking.
+	rates map[string]*atomic.Uint64
+
+	// start starts a VU that runs until stopped or the workflow ends.
+	start func(index int, stop <-chan struct{}, duration time.Duration)
+
+	mu     sync.Mutex
+	end    time.Time
+	ended  bool
+	vus    []chan struct{}
+	nextVU int
+}
+
+// WorkflowStatus describes a running workflow.
+type WorkflowStatus struct {
+	Name      string        `json:"name"`
+	VUs       int           `json:"vus"`
+	ActiveVUs int           `json:"active_vus"`
+	Paused    bool          `json:"paused"`
+	Queries   []QueryStatus `json:"queries"`
+}
+
+// QueryStatus describes the rate a workflow's query runs at.
+type QueryStatus struct {
+	Name       string  `json:"name"`
+	Rate       string  `json:"rate"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+func (r *Runner) runWorkflow(name string, workflow Workflow) error {
+	var eg errgroup.Group
+
+	ws := &workflowState{
+		name:     name,
+		workflow: workflow,
+		rates:    map[string]*atomic.Uint64{},
+		end:      time.Now().Add(r.duration),
+	}
+	for _, q := range workflow.Queries {
+		ws.rates[q.Name] = &atomic.Uint64{}
+	}
+
+	ws.start = func(index int, stop <-chan struct{}, duration time.Duration) {
+		eg.Go(func() error {
+			return r.runVU(ws, index, stop, duration)
+		})
+	}
+
+	r.workflowsMu.Lock()
+	if r.workflows == nil {
+		r.workflows = map[string]*workflowState{}
+	}
+	r.workflows[name] = ws
+	r.workflowsMu.Unlock()
+
+	// Keep the workflow running until its end, even if every VU has been
+	// stopped, so that VUs can be added back. The init workflow finishes
+	// as soon as its VU has, as the other workflows wait for it.
+	if name != initWorkflow {
+		eg.Go(func() error {
+			select {
+			case <-time.After(time.Until(ws.end)):
+			case <-r.stopped:
+			}
+			ws.markEnded()
+			return nil
+		})
+	}
+
+	ws.mu.Lock()
+	for range workflow.Vus {
+		ws.startVU(r.duration)
+	}
+	ws.mu.Unlock()
+
+	err := eg.Wait()
+	ws.markEnded()
+
+	return err
+}
+
+// markEnded stops VUs being added to the workflow.
+func (ws *workflowState) markEnded() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.ended = true
+}
+
+// startVU starts a VU, which must be done with the lock held.
+func (ws *workflowState) startVU(duration time.Duration) {
+	stop := make(chan struct{})
+	ws.vus = append(ws.vus, stop)
+
+	ws.start(ws.nextVU, stop, duration)
+	ws.nextVU++
+}
+
+// rateMultiplier returns the multiplier applied to a query's rate,
+// defaulting to 1.
+func (ws *workflowState) rateMultiplier(queryName string) float64 {
+	if ws == nil {
+		return 1
+	}
+
+	bits := ws.rates[queryName].Load()
+	if bits == 0 {
+		return 1
+	}
+
+	return math.Float64frombits(bits)
+}
+
+func (r *Runner) workflowState(name string) (*workflowState, error) {
+	r.workflowsMu.Lock()
+	defer r.workflowsMu.Unlock()
+
+	ws, ok := r.workflows[name]
+	if !ok {
+		return nil, fmt.Errorf("workflow isn't running: %q", name)
+	}
+
+	return ws, nil
+}
+
+// Workflows returns the status of each running workflow, ordered by name.
+func (r *Runner) Workflows() []WorkflowStatus {
+	r.workflowsMu.Lock()
+	states := make([]*workflowState, 0, len(r.workflows))
+	for _, ws := range r.workflows {
+		states = append(states, ws)
+	}
+	r.workflowsMu.Unlock()
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].name < states[j].name
+	})
+
+	activeVUs := r.ActiveVUs()
+
+	out := make([]WorkflowStatus, 0, len(states))
+	for _, ws := range states {
+		ws.mu.Lock()
+		vus := len(ws.vus)
+		ws.mu.Unlock()
+
+		status := WorkflowStatus{
+			Name:      ws.name,
+			VUs:       vus,
+			ActiveVUs: activeVUs[ws.name],
+			Paused:    ws.paused.Load(),
+		}
+
+		for _, q := range ws.workflow.Queries {
+			status.Queries = append(status.Queries, QueryStatus{
+				Name:       q.Name,
+				Rate:       q.Rate.String(),
+				Multiplier: ws.rateMultiplier(q.Name),
+			})
+		}
+
+		out = append(out, status)
+	}
+
+	return out
+}
+
+// SetVUs starts or stops VUs until a workflow is running the given
+// number. The most recently started VUs are stopped first, once their
+// current activities finish; new VUs run their setup queries and then
+// run until the workflow ends.
+func (r *Runner) SetVUs(workflowName string, n int) error {
+	if n < 0 {
+		return fmt.Errorf("invalid vus: %d", n)
+	}
+
+	ws, err := r.workflowState(workflowName)
+	if err != nil {
+		return err
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.ended {
+		return fmt.Errorf("workflow has ended: %q", workflowName)
+	}
+
+	from := len(ws.vus)
+
+	for len(ws.vus) > n {
+		close(ws.vus[len(ws.vus)-1])
+		ws.vus = ws.vus[:len(ws.vus)-1]
+	}
+
+	for len(ws.vus) < n {
+		ws.startVU(time.Until(ws.end))
+	}
+
+	r.control(workflowName, "set_vus", fmt.Sprintf("vus %d -> %d", from, n))
+	return nil
+}
+
+// ScaleRate sets the multiplier applied to the rate a workflow's query
+// runs at, taking effect from its next tick.
+func (r *Runner) ScaleRate(workflowName, queryName string, m float64) error {
+	if m <= 0 || math.IsInf(m, 0) || math.IsNaN(m) {
+		return fmt.Errorf("invalid rate multiplier: %v", m)
+	}
+
+	ws, err := r.workflowState(workflowName)
+	if err != nil {
+		return err
+	}
+
+	rate, ok := ws.rates[queryName]
+	if !ok {
+		return fmt.Errorf("missing query in workflow %q: %q", workflowName, queryName)
+	}
+	rate.Store(math.Float64bits(m))
+
+	r.control(workflowName, "scale_rate", fmt.Sprintf("%s rate x%v", queryName, m))
+	return nil
+}
+
+// PauseWorkflow stops a workflow's VUs from running activities until
+// ResumeWorkflow is called.
+func (r *Runner) PauseWorkflow(workflowName string) error {
+	return r.setWorkflowPaused(workflowName, true)
+}
+
+// ResumeWorkflow lets a paused workflow's VUs run activities again.
+func (r *Runner) ResumeWorkflow(workflowName string) error {
+	return r.setWorkflowPaused(workflowName, false)
+}
+
+func (r *Runner) setWorkflowPaused(workflowName string, paused bool) error {
+	ws, err := r.workflowState(workflowName)
+	if err != nil {
+		return err
+	}
+	ws.paused.Store(paused)
+
+	r.control(workflowName, lo.Ternary(paused, "pause", "resume"), "")
+	return nil
+}
+
+// RunDDL starts running a schema change against the default connection
+// in the background. Its progress is reported by DDL and its outcome as
+// an event.
+func (r *Runner) RunDDL(stmt string) error {
+	if !isDDL(stmt) {
+		return fmt.Errorf("not a schema change: %q", stmt)
+	}
+
+	query := Query{Type: "exec", Query: stmt}
+	done := r.trackDDL(controlWorkflow, "ddl", query)
+	r.logger.Info().Str("statement", stmt).Msg("running ddl")
+
+	go func() {
+		stats, err := r.db.Exec(stmt)
+		done(err)
+
+		if err != nil {
+			r.logger.Error().Str("statement", stmt).Msgf("error running ddl: %v", err)
+		}
+		r.emit(Event{Workflow: controlWorkflow, Name: "ddl", Duration: stats.Query, Wait: stats.Wait, Node: stats.Node, Control: stmt, Err: err})
+	}()
+
+	return nil
+}
+
+// control logs a change made to a workflow and publishes it as an event.
+func (r *Runner) control(workflowName, action, detail string) {
+	r.logger.Info().Str("workflow", workflowName).Str("action", action).Msg(detail)
+	r.emit(Event{Workflow: workflowName, Name: action, Control: lo.Ternary(detail != "", detail, action)})
+}
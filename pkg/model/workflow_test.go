@@ -0,0 +1,122 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkflowControl(t *testing.T) {
+	cfg := Drk{
+		Activities: map[string]Query{
+			"browse": {Type: "query", Query: "SELECT 1"},
+		},
+	}
+
+	workflow := Workflow{
+		Vus: 1,
+		Queries: []WorkflowQuery{
+			{Name: "browse", Rate: Rate{Times: 1, Interval: 10 * time.Millisecond, tickerInterval: 10 * time.Millisecond}},
+		},
+	}
+
+	db := mockQueryer{
+		query: func(query string, args ...any) ([]map[string]any, repo.Stats, error) {
+			return nil, repo.Stats{}, nil
+		},
+		exec: func(query string, args ...any) (repo.Stats, error) {
+			return repo.Stats{}, nil
+		},
+	}
+
+	r, err := NewRunner(&cfg, &db, "", "", 500*time.Millisecond, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, errors.New(`workflow isn't running: "shop"`), r.SetVUs("shop", 2))
+
+	done := make(chan error)
+	go func() {
+		done <- r.runWorkflow("shop", workflow)
+	}()
+
+	activeVUs := func(n int) func() bool {
+		return func() bool { return r.ActiveVUs()["shop"] == n }
+	}
+
+	assert.Eventually(t, activeVUs(1), time.Second, time.Millisecond)
+
+	assert.NoError(t, r.SetVUs("shop", 3))
+	assert.Eventually(t, activeVUs(3), time.Second, time.Millisecond)
+
+	assert.NoError(t, r.SetVUs("shop", 0))
+	assert.Eventually(t, activeVUs(0), time.Second, time.Millisecond)
+
+	assert.NoError(t, r.SetVUs("shop", 1))
+	assert.NoError(t, r.ScaleRate("shop", "browse", 2))
+	assert.NoError(t, r.PauseWorkflow("shop"))
+
+	assert.Equal(t, errors.New(`missing query in workflow "shop": "missing"`), r.ScaleRate("shop", "missing", 2))
+	assert.Equal(t, errors.New("invalid rate multiplier: -1"), r.ScaleRate("shop", "browse", -1))
+	assert.Equal(t, errors.New("invalid vus: -1"), r.SetVUs("shop", -1))
+
+	assert.Eventually(t, activeVUs(1), time.Second, time.Millisecond)
+	assert.Equal(t, []WorkflowStatus{
+		{
+			Name:      "shop",
+			VUs:       1,
+			ActiveVUs: 1,
+			Paused:    true,
+			Queries:   []QueryStatus{{Name: "browse", Rate: "1/10ms", Multiplier: 2}},
+		},
+	}, r.Workflows())
+
+	assert.NoError(t, <-done)
+	assert.Equal(t, errors.New(`workflow has ended: "shop"`), r.SetVUs("shop", 2))
+
+	// Each change was published as an event.
+	r.closeEvents()
+
+	var controls []string
+	for e := range r.events {
+		if e.Control != "" {
+			controls = append(controls, e.Name+": "+e.Control)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"set_vus: vus 1 -> 3",
+		"set_vus: vus 3 -> 0",
+		"set_vus: vus 0 -> 1",
+		"scale_rate: browse rate x2",
+		"pause: pause",
+	}, controls)
+}
+
+func TestRunDDL(t *testing.T) {
+	executed := make(chan string, 1)
+	db := mockQueryer{
+		exec: func(query string, args ...any) (repo.Stats, error) {
+			executed <- query
+			return repo.Stats{Query: time.Millisecond}, nil
+		},
+	}
+
+	r, err := NewRunner(nil, &db, "", "pgx", 0, &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, errors.New(`not a schema change: "DELETE FROM product"`), r.RunDDL("DELETE FROM product"))
+
+	assert.NoError(t, r.RunDDL("CREATE INDEX ON product (name)"))
+	assert.Equal(t, "CREATE INDEX ON product (name)", <-executed)
+
+	e := <-r.events
+	assert.Equal(t, Event{Workflow: "ctl", Name: "ddl", Duration: time.Millisecond, Control: "CREATE INDEX ON product (name)"}, e)
+
+	running, last := r.DDL()
+	assert.Empty(t, running)
+	assert.Equal(t, "ddl", last.Name)
+}
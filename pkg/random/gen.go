@@ -3,215 +3,216 @@ package random
 import "github.com/brianvoe/gofakeit/v7"
 
 var (
-	// Replacements hold gofakeit functions that generate random data.
-	Replacements = map[string]func() any{
-		"ach_account":                 func() any { return gofakeit.AchAccount() },
-		"ach_routing":                 func() any { return gofakeit.AchRouting() },
-		"adjective_demonstrative":     func() any { return gofakeit.AdjectiveDemonstrative() },
-		"adjective_descriptive":       func() any { return gofakeit.AdjectiveDescriptive() },
-		"adjective_indefinite":        func() any { return gofakeit.AdjectiveIndefinite() },
-		"adjective_interrogative":     func() any { return gofakeit.AdjectiveInterrogative() },
-		"adjective_possessive":        func() any { return gofakeit.AdjectivePossessive() },
-		"adjective_proper":            func() any { return gofakeit.AdjectiveProper() },
-		"adjective_quantitative":      func() any { return gofakeit.AdjectiveQuantitative() },
-		"adjective":                   func() any { return gofakeit.Adjective() },
-		"adverb_degree":               func() any { return gofakeit.AdverbDegree() },
-		"adverb_frequency_definite":   func() any { return gofakeit.AdverbFrequencyDefinite() },
-		"adverb_frequency_indefinite": func() any { return gofakeit.AdverbFrequencyIndefinite() },
-		"adverb_manner":               func() any { return gofakeit.AdverbManner() },
-		"adverb_place":                func() any { return gofakeit.AdverbPlace() },
-		"adverb_time_definite":        func() any { return gofakeit.AdverbTimeDefinite() },
-		"adverb_time_indefinite":      func() any { return gofakeit.AdverbTimeIndefinite() },
-		"adverb":                      func() any { return gofakeit.Adverb() },
-		"animal_type":                 func() any { return gofakeit.AnimalType() },
-		"animal":                      func() any { return gofakeit.Animal() },
-		"app_author":                  func() any { return gofakeit.AppAuthor() },
-		"app_name":                    func() any { return gofakeit.AppName() },
-		"app_version":                 func() any { return gofakeit.AppVersion() },
-		"bitcoin_address":             func() any { return gofakeit.BitcoinAddress() },
-		"bitcoin_private_key":         func() any { return gofakeit.BitcoinPrivateKey() },
-		"book_author":                 func() any { return gofakeit.BookAuthor() },
-		"book_genre":                  func() any { return gofakeit.BookGenre() },
-		"book_title":                  func() any { return gofakeit.BookTitle() },
-		"bool":                        func() any { return gofakeit.Bool() },
-		"breakfast":                   func() any { return gofakeit.Breakfast() },
-		"bs":                          func() any { return gofakeit.BS() },
-		"buzz_word":                   func() any { return gofakeit.BuzzWord() },
-		"car_fuel_type":               func() any { return gofakeit.CarFuelType() },
-		"car_maker":                   func() any { return gofakeit.CarMaker() },
-		"car_model":                   func() any { return gofakeit.CarModel() },
-		"car_transmission_type":       func() any { return gofakeit.CarTransmissionType() },
-		"car_type":                    func() any { return gofakeit.CarType() },
-		"celebrity_actor":             func() any { return gofakeit.CelebrityActor() },
-		"car_business":                func() any { return gofakeit.CelebrityBusiness() },
-		"car_sport":                   func() any { return gofakeit.CelebritySport() },
-		"chrome_user_agent":           func() any { return gofakeit.ChromeUserAgent() },
-		"city":                        func() any { return gofakeit.City() },
-		"color":                       func() any { return gofakeit.Color() },
-		"company_slogan":              func() any { return gofakeit.Slogan() },
-		"company_suffix":              func() any { return gofakeit.CompanySuffix() },
-		"company":                     func() any { return gofakeit.Company() },
-		"connective_casual":           func() any { return gofakeit.ConnectiveCasual() },
-		"connective_complaint":        func() any { return gofakeit.ConnectiveComplaint() },
-		"connective_examplify":        func() any { return gofakeit.ConnectiveExamplify() },
-		"connective_listing":          func() any { return gofakeit.ConnectiveListing() },
-		"connective_time":             func() any { return gofakeit.ConnectiveTime() },
-		"connective":                  func() any { return gofakeit.Connective() },
-		"country_abr":                 func() any { return gofakeit.CountryAbr() },
-		"country":                     func() any { return gofakeit.Country() },
-		"credit_card_cvv":             func() any { return gofakeit.CreditCardCvv() },
-		"credit_card_exp":             func() any { return gofakeit.CreditCardExp() },
-		"credit_card_number":          func() any { return gofakeit.CreditCardNumber(nil) },
-		"credit_card_type":            func() any { return gofakeit.CreditCardType() },
-		"currency_long":               func() any { return gofakeit.CurrencyLong() },
-		"currency_short":              func() any { return gofakeit.CurrencyShort() },
-		"cusip":                       func() any { return gofakeit.Cusip() },
-		"date":                        func() any { return gofakeit.Date() },
-		"day":                         func() any { return gofakeit.Day() },
-		"dessert":                     func() any { return gofakeit.Dessert() },
-		"dinner":                      func() any { return gofakeit.Dinner() },
-		"domain_name":                 func() any { return gofakeit.DomainName() },
-		"domain_suffix":               func() any { return gofakeit.DomainSuffix() },
-		"email":                       func() any { return gofakeit.Email() },
-		"emoji":                       func() any { return gofakeit.Emoji() },
-		"error":                       func() any { return gofakeit.Error() },
-		"error_database":              func() any { return gofakeit.ErrorDatabase() },
-		"error_grpc":                  func() any { return gofakeit.ErrorGRPC() },
-		"error_http":                  func() any { return gofakeit.ErrorHTTP() },
-		"error_http_client":           func() any { return gofakeit.ErrorHTTPClient() },
-		"error_http_server":           func() any { return gofakeit.ErrorHTTPServer() },
-		"error_runtime":               func() any { return gofakeit.ErrorRuntime() },
-		"farm_animal":                 func() any { return gofakeit.FarmAnimal() },
-		"file_extension":              func() any { return gofakeit.FileExtension() },
-		"file_mime_type":              func() any { return gofakeit.FileMimeType() },
-		"firefox_user_agent":          func() any { return gofakeit.FirefoxUserAgent() },
-		"first_name":                  func() any { return gofakeit.FirstName() },
-		"flipacoin":                   func() any { return gofakeit.FlipACoin() },
-		"float32":                     func() any { return gofakeit.Float32() },
-		"float64":                     func() any { return gofakeit.Float64() },
-		"fruit":                       func() any { return gofakeit.Fruit() },
-		"future_date":                 func() any { return gofakeit.FutureDate() },
-		"gender":                      func() any { return gofakeit.Gender() },
-		"hexcolor":                    func() any { return gofakeit.HexColor() },
-		"hipster_word":                func() any { return gofakeit.HipsterWord() },
-		"hipster_sentence":            func() any { return gofakeit.HipsterSentence(100) },
-		"hipster_paragraph":           func() any { return gofakeit.HipsterParagraph(2, 5, 20, " ") },
-		"hobby":                       func() any { return gofakeit.Hobby() },
-		"hour":                        func() any { return gofakeit.Hour() },
-		"http_method":                 func() any { return gofakeit.HTTPMethod() },
-		"http_status_code_simple":     func() any { return gofakeit.HTTPStatusCodeSimple() },
-		"http_status_code":            func() any { return gofakeit.HTTPStatusCode() },
-		"http_version":                func() any { return gofakeit.HTTPVersion() },
-		"image_jpg":                   func() any { return gofakeit.ImageJpeg(256, 256) },
-		"image_png":                   func() any { return gofakeit.ImagePng(256, 256) },
-		"int16":                       func() any { return gofakeit.Int16() },
-		"int32":                       func() any { return gofakeit.Int32() },
-		"int64":                       func() any { return gofakeit.Int64() },
-		"int8":                        func() any { return gofakeit.Int8() },
-		"ipv4_address":                func() any { return gofakeit.IPv4Address() },
-		"ipv6_address":                func() any { return gofakeit.IPv6Address() },
-		"isin":                        func() any { return gofakeit.Isin() },
-		"job_descriptor":              func() any { return gofakeit.JobDescriptor() },
-		"job_level":                   func() any { return gofakeit.JobLevel() },
-		"job_title":                   func() any { return gofakeit.JobTitle() },
-		"language_abbreviation":       func() any { return gofakeit.LanguageAbbreviation() },
-		"language":                    func() any { return gofakeit.Language() },
-		"last_name":                   func() any { return gofakeit.LastName() },
-		"latitude":                    func() any { return gofakeit.Latitude() },
-		"longitude":                   func() any { return gofakeit.Longitude() },
-		"lorem_word":                  func() any { return gofakeit.LoremIpsumWord() },
-		"lorem_sentence":              func() any { return gofakeit.LoremIpsumSentence(100) },
-		"lorem_paragraph":             func() any { return gofakeit.LoremIpsumParagraph(2, 5, 20, " ") },
-		"lunch":                       func() any { return gofakeit.Lunch() },
-		"mac_address":                 func() any { return gofakeit.MacAddress() },
-		"minute":                      func() any { return gofakeit.Minute() },
-		"month_string":                func() any { return gofakeit.MonthString() },
-		"month":                       func() any { return gofakeit.Month() },
-		"movie_genre":                 func() any { return gofakeit.MovieGenre() },
-		"movie_name":                  func() any { return gofakeit.MovieName() },
-		"name_prefix":                 func() any { return gofakeit.NamePrefix() },
-		"name_suffix":                 func() any { return gofakeit.NameSuffix() },
-		"name":                        func() any { return gofakeit.Name() },
-		"nanosecond":                  func() any { return gofakeit.NanoSecond() },
-		"nicecolors":                  func() any { return gofakeit.NiceColors() },
-		"noun_abstract":               func() any { return gofakeit.NounAbstract() },
-		"noun_collective_animal":      func() any { return gofakeit.NounCollectiveAnimal() },
-		"noun_collective_people":      func() any { return gofakeit.NounCollectivePeople() },
-		"noun_collective_thing":       func() any { return gofakeit.NounCollectiveThing() },
-		"noun_common":                 func() any { return gofakeit.NounCommon() },
-		"noun_concrete":               func() any { return gofakeit.NounConcrete() },
-		"noun_countable":              func() any { return gofakeit.NounCountable() },
-		"noun_uncountable":            func() any { return gofakeit.NounUncountable() },
-		"noun":                        func() any { return gofakeit.Noun() },
-		"opera_user_agent":            func() any { return gofakeit.OperaUserAgent() },
-		"past_date":                   func() any { return gofakeit.PastDate() },
-		"password":                    func() any { return gofakeit.Password(true, true, true, true, true, 25) },
-		"pet_name":                    func() any { return gofakeit.PetName() },
-		"phone_formatted":             func() any { return gofakeit.PhoneFormatted() },
-		"phone":                       func() any { return gofakeit.Phone() },
-		"phrase":                      func() any { return gofakeit.Phrase() },
-		"preposition_compound":        func() any { return gofakeit.PrepositionCompound() },
-		"preposition_double":          func() any { return gofakeit.PrepositionDouble() },
-		"preposition_simple":          func() any { return gofakeit.PrepositionSimple() },
-		"preposition":                 func() any { return gofakeit.Preposition() },
-		"price":                       func() any { return gofakeit.Price(1, 100) },
-		"product_name":                func() any { return gofakeit.ProductName() },
-		"product_description":         func() any { return gofakeit.ProductDescription() },
-		"product_category":            func() any { return gofakeit.ProductCategory() },
-		"product_feature":             func() any { return gofakeit.ProductFeature() },
-		"product_material":            func() any { return gofakeit.ProductMaterial() },
-		"programming_language":        func() any { return gofakeit.ProgrammingLanguage() },
-		"pronoun_demonstrative":       func() any { return gofakeit.PronounDemonstrative() },
-		"pronoun_interrogative":       func() any { return gofakeit.PronounInterrogative() },
-		"pronoun_object":              func() any { return gofakeit.PronounObject() },
-		"pronoun_personal":            func() any { return gofakeit.PronounPersonal() },
-		"pronoun_possessive":          func() any { return gofakeit.PronounPossessive() },
-		"pronoun_reflective":          func() any { return gofakeit.PronounReflective() },
-		"pronoun_relative":            func() any { return gofakeit.PronounRelative() },
-		"pronoun":                     func() any { return gofakeit.Pronoun() },
-		"question":                    func() any { return gofakeit.Question() },
-		"quote":                       func() any { return gofakeit.Quote() },
-		"rgbcolor":                    func() any { return gofakeit.RGBColor() },
-		"safari_user_agent":           func() any { return gofakeit.SafariUserAgent() },
-		"safecolor":                   func() any { return gofakeit.SafeColor() },
-		"school":                      func() any { return gofakeit.School() },
-		"second":                      func() any { return gofakeit.Second() },
-		"snack":                       func() any { return gofakeit.Snack() },
-		"ssn":                         func() any { return gofakeit.SSN() },
-		"state_abr":                   func() any { return gofakeit.StateAbr() },
-		"state":                       func() any { return gofakeit.State() },
-		"street_name":                 func() any { return gofakeit.StreetName() },
-		"street_number":               func() any { return gofakeit.StreetNumber() },
-		"street_prefix":               func() any { return gofakeit.StreetPrefix() },
-		"street_suffix":               func() any { return gofakeit.StreetSuffix() },
-		"street":                      func() any { return gofakeit.Street() },
-		"time_zone_abv":               func() any { return gofakeit.TimeZoneAbv() },
-		"time_zone_full":              func() any { return gofakeit.TimeZoneFull() },
-		"time_zone_offset":            func() any { return gofakeit.TimeZoneOffset() },
-		"time_zone_region":            func() any { return gofakeit.TimeZoneRegion() },
-		"time_zone":                   func() any { return gofakeit.TimeZone() },
-		"uint128_hex":                 func() any { return gofakeit.HexUint(128) },
-		"uint16_hex":                  func() any { return gofakeit.HexUint(16) },
-		"uint16":                      func() any { return gofakeit.Uint16() },
-		"uint256_hex":                 func() any { return gofakeit.HexUint(256) },
-		"uint32_hex":                  func() any { return gofakeit.HexUint(32) },
-		"uint32":                      func() any { return gofakeit.Uint32() },
-		"uint64_hex":                  func() any { return gofakeit.HexUint(64) },
-		"uint64":                      func() any { return gofakeit.Uint64() },
-		"uint8_hex":                   func() any { return gofakeit.HexUint(8) },
-		"uint8":                       func() any { return gofakeit.Uint8() },
-		"url":                         func() any { return gofakeit.URL() },
-		"user_agent":                  func() any { return gofakeit.UserAgent() },
-		"username":                    func() any { return gofakeit.Username() },
-		"uuid":                        func() any { return gofakeit.UUID() },
-		"vegetable":                   func() any { return gofakeit.Vegetable() },
-		"verb_action":                 func() any { return gofakeit.VerbAction() },
-		"verb_helping":                func() any { return gofakeit.VerbHelping() },
-		"verb_linking":                func() any { return gofakeit.VerbLinking() },
-		"verb":                        func() any { return gofakeit.Verb() },
-		"weekday":                     func() any { return gofakeit.WeekDay() },
-		"word":                        func() any { return gofakeit.Word() },
-		"year":                        func() any { return gofakeit.Year() },
-		"zip":                         func() any { return gofakeit.Zip() },
+	// Replacements hold gofakeit functions that generate random data,
+	// using the given Faker as their source of randomness.
+	Replacements = map[string]func(*gofakeit.Faker) any{
+		"ach_account":                 func(f *gofakeit.Faker) any { return f.AchAccount() },
+		"ach_routing":                 func(f *gofakeit.Faker) any { return f.AchRouting() },
+		"adjective_demonstrative":     func(f *gofakeit.Faker) any { return f.AdjectiveDemonstrative() },
+		"adjective_descriptive":       func(f *gofakeit.Faker) any { return f.AdjectiveDescriptive() },
+		"adjective_indefinite":        func(f *gofakeit.Faker) any { return f.AdjectiveIndefinite() },
+		"adjective_interrogative":     func(f *gofakeit.Faker) any { return f.AdjectiveInterrogative() },
+		"adjective_possessive":        func(f *gofakeit.Faker) any { return f.AdjectivePossessive() },
+		"adjective_proper":            func(f *gofakeit.Faker) any { return f.AdjectiveProper() },
+		"adjective_quantitative":      func(f *gofakeit.Faker) any { return f.AdjectiveQuantitative() },
+		"adjective":                   func(f *gofakeit.Faker) any { return f.Adjective() },
+		"adverb_degree":               func(f *gofakeit.Faker) any { return f.AdverbDegree() },
+		"adverb_frequency_definite":   func(f *gofakeit.Faker) any { return f.AdverbFrequencyDefinite() },
+		"adverb_frequency_indefinite": func(f *gofakeit.Faker) any { return f.AdverbFrequencyIndefinite() },
+		"adverb_manner":               func(f *gofakeit.Faker) any { return f.AdverbManner() },
+		"adverb_place":                func(f *gofakeit.Faker) any { return f.AdverbPlace() },
+		"adverb_time_definite":        func(f *gofakeit.Faker) any { return f.AdverbTimeDefinite() },
+		"adverb_time_indefinite":      func(f *gofakeit.Faker) any { return f.AdverbTimeIndefinite() },
+		"adverb":                      func(f *gofakeit.Faker) any { return f.Adverb() },
+		"animal_type":                 func(f *gofakeit.Faker) any { return f.AnimalType() },
+		"animal":                      func(f *gofakeit.Faker) any { return f.Animal() },
+		"app_author":                  func(f *gofakeit.Faker) any { return f.AppAuthor() },
+		"app_name":                    func(f *gofakeit.Faker) any { return f.AppName() },
+		"app_version":                 func(f *gofakeit.Faker) any { return f.AppVersion() },
+		"bitcoin_address":             func(f *gofakeit.Faker) any { return f.BitcoinAddress() },
+		"bitcoin_private_key":         func(f *gofakeit.Faker) any { return f.BitcoinPrivateKey() },
+		"book_author":                 func(f *gofakeit.Faker) any { return f.BookAuthor() },
+		"book_genre":                  func(f *gofakeit.Faker) any { return f.BookGenre() },
+		"book_title":                  func(f *gofakeit.Faker) any { return f.BookTitle() },
+		"bool":                        func(f *gofakeit.Faker) any { return f.Bool() },
+		"breakfast":                   func(f *gofakeit.Faker) any { return f.Breakfast() },
+		"bs":                          func(f *gofakeit.Faker) any { return f.BS() },
+		"buzz_word":                   func(f *gofakeit.Faker) any { return f.BuzzWord() },
+		"car_fuel_type":               func(f *gofakeit.Faker) any { return f.CarFuelType() },
+		"car_maker":                   func(f *gofakeit.Faker) any { return f.CarMaker() },
+		"car_model":                   func(f *gofakeit.Faker) any { return f.CarModel() },
+		"car_transmission_type":       func(f *gofakeit.Faker) any { return f.CarTransmissionType() },
+		"car_type":                    func(f *gofakeit.Faker) any { return f.CarType() },
+		"celebrity_actor":             func(f *gofakeit.Faker) any { return f.CelebrityActor() },
+		"car_business":                func(f *gofakeit.Faker) any { return f.CelebrityBusiness() },
+		"car_sport":                   func(f *gofakeit.Faker) any { return f.CelebritySport() },
+		"chrome_user_agent":           func(f *gofakeit.Faker) any { return f.ChromeUserAgent() },
+		"city":                        func(f *gofakeit.Faker) any { return f.City() },
+		"color":                       func(f *gofakeit.Faker) any { return f.Color() },
+		"company_slogan":              func(f *gofakeit.Faker) any { return f.Slogan() },
+		"company_suffix":              func(f *gofakeit.Faker) any { return f.CompanySuffix() },
+		"company":                     func(f *gofakeit.Faker) any { return f.Company() },
+		"connective_casual":           func(f *gofakeit.Faker) any { return f.ConnectiveCasual() },
+		"connective_complaint":        func(f *gofakeit.Faker) any { return f.ConnectiveComplaint() },
+		"connective_examplify":        func(f *gofakeit.Faker) any { return f.ConnectiveExamplify() },
+		"connective_listing":          func(f *gofakeit.Faker) any { return f.ConnectiveListing() },
+		"connective_time":             func(f *gofakeit.Faker) any { return f.ConnectiveTime() },
+		"connective":                  func(f *gofakeit.Faker) any { return f.Connective() },
+		"country_abr":                 func(f *gofakeit.Faker) any { return f.CountryAbr() },
+		"country":                     func(f *gofakeit.Faker) any { return f.Country() },
+		"credit_card_cvv":             func(f *gofakeit.Faker) any { return f.CreditCardCvv() },
+		"credit_card_exp":             func(f *gofakeit.Faker) any { return f.CreditCardExp() },
+		"credit_card_number":          func(f *gofakeit.Faker) any { return f.CreditCardNumber(nil) },
+		"credit_card_type":            func(f *gofakeit.Faker) any { return f.CreditCardType() },
+		"currency_long":               func(f *gofakeit.Faker) any { return f.CurrencyLong() },
+		"currency_short":              func(f *gofakeit.Faker) any { return f.CurrencyShort() },
+		"cusip":                       func(f *gofakeit.Faker) any { return f.Cusip() },
+		"date":                        func(f *gofakeit.Faker) any { return f.Date() },
+		"day":                         func(f *gofakeit.Faker) any { return f.Day() },
+		"dessert":                     func(f *gofakeit.Faker) any { return f.Dessert() },
+		"dinner":                      func(f *gofakeit.Faker) any { return f.Dinner() },
+		"domain_name":                 func(f *gofakeit.Faker) any { return f.DomainName() },
+		"domain_suffix":               func(f *gofakeit.Faker) any { return f.DomainSuffix() },
+		"email":                       func(f *gofakeit.Faker) any { return f.Email() },
+		"emoji":                       func(f *gofakeit.Faker) any { return f.Emoji() },
+		"error":                       func(f *gofakeit.Faker) any { return f.Error() },
+		"error_database":              func(f *gofakeit.Faker) any { return f.ErrorDatabase() },
+		"error_grpc":                  func(f *gofakeit.Faker) any { return f.ErrorGRPC() },
+		"error_http":                  func(f *gofakeit.Faker) any { return f.ErrorHTTP() },
+		"error_http_client":           func(f *gofakeit.Faker) any { return f.ErrorHTTPClient() },
+		"error_http_server":           func(f *gofakeit.Faker) any { return f.ErrorHTTPServer() },
+		"error_runtime":               func(f *gofakeit.Faker) any { return f.ErrorRuntime() },
+		"farm_animal":                 func(f *gofakeit.Faker) any { return f.FarmAnimal() },
+		"file_extension":              func(f *gofakeit.Faker) any { return f.FileExtension() },
+		"file_mime_type":              func(f *gofakeit.Faker) any { return f.FileMimeType() },
+		"firefox_user_agent":          func(f *gofakeit.Faker) any { return f.FirefoxUserAgent() },
+		"first_name":                  func(f *gofakeit.Faker) any { return f.FirstName() },
+		"flipacoin":                   func(f *gofakeit.Faker) any { return f.FlipACoin() },
+		"float32":                     func(f *gofakeit.Faker) any { return f.Float32() },
+		"float64":                     func(f *gofakeit.Faker) any { return f.Float64() },
+		"fruit":                       func(f *gofakeit.Faker) any { return f.Fruit() },
+		"future_date":                 func(f *gofakeit.Faker) any { return f.FutureDate() },
+		"gender":                      func(f *gofakeit.Faker) any { return f.Gender() },
+		"hexcolor":                    func(f *gofakeit.Faker) any { return f.HexColor() },
+		"hipster_word":                func(f *gofakeit.Faker) any { return f.HipsterWord() },
+		"hipster_sentence":            func(f *gofakeit.Faker) any { return f.HipsterSentence(100) },
+		"hipster_paragraph":           func(f *gofakeit.Faker) any { return f.HipsterParagraph(2, 5, 20, " ") },
+		"hobby":                       func(f *gofakeit.Faker) any { return f.Hobby() },
+		"hour":                        func(f *gofakeit.Faker) any { return f.Hour() },
+		"http_method":                 func(f *gofakeit.Faker) any { return f.HTTPMethod() },
+		"http_status_code_simple":     func(f *gofakeit.Faker) any { return f.HTTPStatusCodeSimple() },
+		"http_status_code":            func(f *gofakeit.Faker) any { return f.HTTPStatusCode() },
+		"http_version":                func(f *gofakeit.Faker) any { return f.HTTPVersion() },
+		"image_jpg":                   func(f *gofakeit.Faker) any { return f.ImageJpeg(256, 256) },
+		"image_png":                   func(f *gofakeit.Faker) any { return f.ImagePng(256, 256) },
+		"int16":                       func(f *gofakeit.Faker) any { return f.Int16() },
+		"int32":                       func(f *gofakeit.Faker) any { return f.Int32() },
+		"int64":                       func(f *gofakeit.Faker) any { return f.Int64() },
+		"int8":                        func(f *gofakeit.Faker) any { return f.Int8() },
+		"ipv4_address":                func(f *gofakeit.Faker) any { return f.IPv4Address() },
+		"ipv6_address":                func(f *gofakeit.Faker) any { return f.IPv6Address() },
+		"isin":                        func(f *gofakeit.Faker) any { return f.Isin() },
+		"job_descriptor":              func(f *gofakeit.Faker) any { return f.JobDescriptor() },
+		"job_level":                   func(f *gofakeit.Faker) any { return f.JobLevel() },
+		"job_title":                   func(f *gofakeit.Faker) any { return f.JobTitle() },
+		"language_abbreviation":       func(f *gofakeit.Faker) any { return f.LanguageAbbreviation() },
+		"language":                    func(f *gofakeit.Faker) any { return f.Language() },
+		"last_name":                   func(f *gofakeit.Faker) any { return f.LastName() },
+		"latitude":                    func(f *gofakeit.Faker) any { return f.Latitude() },
+		"longitude":                   func(f *gofakeit.Faker) any { return f.Longitude() },
+		"lorem_word":                  func(f *gofakeit.Faker) any { return f.LoremIpsumWord() },
+		"lorem_sentence":              func(f *gofakeit.Faker) any { return f.LoremIpsumSentence(100) },
+		"lorem_paragraph":             func(f *gofakeit.Faker) any { return f.LoremIpsumParagraph(2, 5, 20, " ") },
+		"lunch":                       func(f *gofakeit.Faker) any { return f.Lunch() },
+		"mac_address":                 func(f *gofakeit.Faker) any { return f.MacAddress() },
+		"minute":                      func(f *gofakeit.Faker) any { return f.Minute() },
+		"month_string":                func(f *gofakeit.Faker) any { return f.MonthString() },
+		"month":                       func(f *gofakeit.Faker) any { return f.Month() },
+		"movie_genre":                 func(f *gofakeit.Faker) any { return f.MovieGenre() },
+		"movie_name":                  func(f *gofakeit.Faker) any { return f.MovieName() },
+		"name_prefix":                 func(f *gofakeit.Faker) any { return f.NamePrefix() },
+		"name_suffix":                 func(f *gofakeit.Faker) any { return f.NameSuffix() },
+		"name":                        func(f *gofakeit.Faker) any { return f.Name() },
+		"nanosecond":                  func(f *gofakeit.Faker) any { return f.NanoSecond() },
+		"nicecolors":                  func(f *gofakeit.Faker) any { return f.NiceColors() },
+		"noun_abstract":               func(f *gofakeit.Faker) any { return f.NounAbstract() },
+		"noun_collective_animal":      func(f *gofakeit.Faker) any { return f.NounCollectiveAnimal() },
+		"noun_collective_people":      func(f *gofakeit.Faker) any { return f.NounCollectivePeople() },
+		"noun_collective_thing":       func(f *gofakeit.Faker) any { return f.NounCollectiveThing() },
+		"noun_common":                 func(f *gofakeit.Faker) any { return f.NounCommon() },
+		"noun_concrete":               func(f *gofakeit.Faker) any { return f.NounConcrete() },
+		"noun_countable":              func(f *gofakeit.Faker) any { return f.NounCountable() },
+		"noun_uncountable":            func(f *gofakeit.Faker) any { return f.NounUncountable() },
+		"noun":                        func(f *gofakeit.Faker) any { return f.Noun() },
+		"opera_user_agent":            func(f *gofakeit.Faker) any { return f.OperaUserAgent() },
+		"past_date":                   func(f *gofakeit.Faker) any { return f.PastDate() },
+		"password":                    func(f *gofakeit.Faker) any { return f.Password(true, true, true, true, true, 25) },
+		"pet_name":                    func(f *gofakeit.Faker) any { return f.PetName() },
+		"phone_formatted":             func(f *gofakeit.Faker) any { return f.PhoneFormatted() },
+		"phone":                       func(f *gofakeit.Faker) any { return f.Phone() },
+		"phrase":                      func(f *gofakeit.Faker) any { return f.Phrase() },
+		"preposition_compound":        func(f *gofakeit.Faker) any { return f.PrepositionCompound() },
+		"preposition_double":          func(f *gofakeit.Faker) any { return f.PrepositionDouble() },
+		"preposition_simple":          func(f *gofakeit.Faker) any { return f.PrepositionSimple() },
+		"preposition":                 func(f *gofakeit.Faker) any { return f.Preposition() },
+		"price":                       func(f *gofakeit.Faker) any { return f.Price(1, 100) },
+		"product_name":                func(f *gofakeit.Faker) any { return f.ProductName() },
+		"product_description":         func(f *gofakeit.Faker) any { return f.ProductDescription() },
+		"product_category":            func(f *gofakeit.Faker) any { return f.ProductCategory() },
+		"product_feature":             func(f *gofakeit.Faker) any { return f.ProductFeature() },
+		"product_material":            func(f *gofakeit.Faker) any { return f.ProductMaterial() },
+		"programming_language":        func(f *gofakeit.Faker) any { return f.ProgrammingLanguage() },
+		"pronoun_demonstrative":       func(f *gofakeit.Faker) any { return f.PronounDemonstrative() },
+		"pronoun_interrogative":       func(f *gofakeit.Faker) any { return f.PronounInterrogative() },
+		"pronoun_object":              func(f *gofakeit.Faker) any { return f.PronounObject() },
+		"pronoun_personal":            func(f *gofakeit.Faker) any { return f.PronounPersonal() },
+		"pronoun_possessive":          func(f *gofakeit.Faker) any { return f.PronounPossessive() },
+		"pronoun_reflective":          func(f *gofakeit.Faker) any { return f.PronounReflective() },
+		"pronoun_relative":            func(f *gofakeit.Faker) any { return f.PronounRelative() },
+		"pronoun":                     func(f *gofakeit.Faker) any { return f.Pronoun() },
+		"question":                    func(f *gofakeit.Faker) any { return f.Question() },
+		"quote":                       func(f *gofakeit.Faker) any { return f.Quote() },
+		"rgbcolor":                    func(f *gofakeit.Faker) any { return f.RGBColor() },
+		"safari_user_agent":           func(f *gofakeit.Faker) any { return f.SafariUserAgent() },
+		"safecolor":                   func(f *gofakeit.Faker) any { return f.SafeColor() },
+		"school":                      func(f *gofakeit.Faker) any { return f.School() },
+		"second":                      func(f *gofakeit.Faker) any { return f.Second() },
+		"snack":                       func(f *gofakeit.Faker) any { return f.Snack() },
+		"ssn":                         func(f *gofakeit.Faker) any { return f.SSN() },
+		"state_abr":                   func(f *gofakeit.Faker) any { return f.StateAbr() },
+		"state":                       func(f *gofakeit.Faker) any { return f.State() },
+		"street_name":                 func(f *gofakeit.Faker) any { return f.StreetName() },
+		"street_number":               func(f *gofakeit.Faker) any { return f.StreetNumber() },
+		"street_prefix":               func(f *gofakeit.Faker) any { return f.StreetPrefix() },
+		"street_suffix":               func(f *gofakeit.Faker) any { return f.StreetSuffix() },
+		"street":                      func(f *gofakeit.Faker) any { return f.Street() },
+		"time_zone_abv":               func(f *gofakeit.Faker) any { return f.TimeZoneAbv() },
+		"time_zone_full":              func(f *gofakeit.Faker) any { return f.TimeZoneFull() },
+		"time_zone_offset":            func(f *gofakeit.Faker) any { return f.TimeZoneOffset() },
+		"time_zone_region":            func(f *gofakeit.Faker) any { return f.TimeZoneRegion() },
+		"time_zone":                   func(f *gofakeit.Faker) any { return f.TimeZone() },
+		"uint128_hex":                 func(f *gofakeit.Faker) any { return f.HexUint(128) },
+		"uint16_hex":                  func(f *gofakeit.Faker) any { return f.HexUint(16) },
+		"uint16":                      func(f *gofakeit.Faker) any { return f.Uint16() },
+		"uint256_hex":                 func(f *gofakeit.Faker) any { return f.HexUint(256) },
+		"uint32_hex":                  func(f *gofakeit.Faker) any { return f.HexUint(32) },
+		"uint32":                      func(f *gofakeit.Faker) any { return f.Uint32() },
+		"uint64_hex":                  func(f *gofakeit.Faker) any { return f.HexUint(64) },
+		"uint64":                      func(f *gofakeit.Faker) any { return f.Uint64() },
+		"uint8_hex":                   func(f *gofakeit.Faker) any { return f.HexUint(8) },
+		"uint8":                       func(f *gofakeit.Faker) any { return f.Uint8() },
+		"url":                         func(f *gofakeit.Faker) any { return f.URL() },
+		"user_agent":                  func(f *gofakeit.Faker) any { return f.UserAgent() },
+		"username":                    func(f *gofakeit.Faker) any { return f.Username() },
+		"uuid":                        func(f *gofakeit.Faker) any { return f.UUID() },
+		"vegetable":                   func(f *gofakeit.Faker) any { return f.Vegetable() },
+		"verb_action":                 func(f *gofakeit.Faker) any { return f.VerbAction() },
+		"verb_helping":                func(f *gofakeit.Faker) any { return f.VerbHelping() },
+		"verb_linking":                func(f *gofakeit.Faker) any { return f.VerbLinking() },
+		"verb":                        func(f *gofakeit.Faker) any { return f.Verb() },
+		"weekday":                     func(f *gofakeit.Faker) any { return f.WeekDay() },
+		"word":                        func(f *gofakeit.Faker) any { return f.Word() },
+		"year":                        func(f *gofakeit.Faker) any { return f.Year() },
+		"zip":                         func(f *gofakeit.Faker) any { return f.Zip() },
 	}
 )
@@ -0,0 +1,226 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// BalanceRoundRobin pins each VU to a node, assigning nodes to VUs
+	// in turn.
+	BalanceRoundRobin = "round_robin"
+
+	// BalanceRandom runs each statement against a random node.
+	BalanceRandom = "random"
+
+	// BalanceLocality pins each VU to a node in the same locality as
+	// its workflow, assigning matching nodes to VUs in turn.
+	BalanceLocality = "locality"
+
+	// downCooldown is how long a node that refused a connection is
+	// skipped for before it's tried again.
+	downCooldown = time.Second * 5
+)
+
+// Balancer is implemented by Queryers that spread statements across
+// nodes and need to know which VU they're serving.
+type Balancer interface {
+	// ForVU returns the Queryer a VU belonging to a workflow in the
+	// given locality should use for its lifetime.
+	ForVU(locality string) Queryer
+}
+
+// Node is a database node that statements can be balanced across.
+type Node struct {
+	Name     string
+	Locality string
+	Queryer  Queryer
+}
+
+// Cluster is a Queryer that balances statements across a number of
+// nodes, failing over to the next node if one refuses connections.
+type Cluster struct {
+	nodes    []Node
+	strategy string
+	next     atomic.Uint64
+
+	downMu sync.RWMutex
+	down   map[int]time.Time
+}
+
+func NewCluster(strategy string, nodes ...Node) (*Cluster, error) {
+	if len(nodes) == 0 {
+		return nil, errors.New("at least one node is required")
+	}
+
+	switch strategy {
+	case BalanceRoundRobin, BalanceRandom, BalanceLocality:
+	default:
+		return nil, fmt.Errorf("unsupported load balancing strategy: %q", strategy)
+	}
+
+	return &Cluster{
+		nodes:    nodes,
+		strategy: strategy,
+		down:     map[int]time.Time{},
+	}, nil
+}
+
+func (c *Cluster) Query(query string, args ...any) ([]map[string]any, Stats, error) {
+	return c.query(rand.IntN(len(c.nodes)), query, args...)
+}
+
+func (c *Cluster) Exec(query string, args ...any) (Stats, error) {
+	return c.exec(rand.IntN(len(c.nodes)), query, args...)
+}
+
+func (c *Cluster) ForVU(locality string) Queryer {
+	switch c.strategy {
+	case BalanceRoundRobin:
+		return &pinnedNode{cluster: c, start: c.nextNode(nil)}
+
+	case BalanceLocality:
+		var candidates []int
+		for i, n := range c.nodes {
+			if n.Locality == locality {
+				candidates = append(candidates, i)
+			}
+		}
+		return &pinnedNode{cluster: c, start: c.nextNode(candidates)}
+
+	default:
+		return c
+	}
+}
+
+// Close closes the Queryer of each node that can be closed.
+func (c *Cluster) Close() error {
+	var errs []error
+	for _, n := range c.nodes {
+		if closer, ok := n.Queryer.(interface{ Close() error }); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// nextNode returns the next node to assign in turn from a set of
+// candidate nodes, or from all nodes if there are no candidates.
+func (c *Cluster) nextNode(candidates []int) int {
+	n := c.next.Add(1) - 1
+
+	if len(candidates) == 0 {
+		return int(n % uint64(len(c.nodes)))
+	}
+	return candidates[n%uint64(len(candidates))]
+}
+
+func (c *Cluster) query(start int, query string, args ...any) ([]map[string]any, Stats, error) {
+	var data []map[string]any
+	stats, err := c.failover(start, func(n Node) (Stats, error) {
+		var err error
+		var stats Stats
+		data, stats, err = n.Queryer.Query(query, args...)
+		return stats, err
+	})
+
+	return data, stats, err
+}
+
+func (c *Cluster) exec(start int, query string, args ...any) (Stats, error) {
+	return c.failover(start, func(n Node) (Stats, error) {
+		return n.Queryer.Exec(query, args...)
+	})
+}
+
+// failover runs f against each node in turn, starting with the node at
+// index start, until one accepts a connection. Nodes that have recently
+// refused connections are only tried once all other nodes have been.
+func (c *Cluster) failover(start int, f func(Node) (Stats, error)) (Stats, error) {
+	var skipped []int
+	var err error
+
+	try := func(i int) (Stats, bool) {
+		var stats Stats
+		stats, err = f(c.nodes[i])
+
+		var connErr ConnErr
+		if errors.As(err, &connErr) {
+			c.markDown(i)
+			return Stats{}, false
+		}
+
+		stats.Node = c.nodes[i].Name
+		return stats, true
+	}
+
+	for offset := range c.nodes {
+		i := (start + offset) % len(c.nodes)
+		if c.isDown(i) {
+			skipped = append(skipped, i)
+			continue
+		}
+
+		if stats, ok := try(i); ok {
+			return stats, err
+		}
+	}
+
+	for _, i := range skipped {
+		if stats, ok := try(i); ok {
+			return stats, err
+		}
+	}
+
+	return Stats{}, fmt.Errorf("no nodes available: %w", err)
+}
+
+func (c *Cluster) markDown(i int) {
+	c.downMu.Lock()
+	defer c.downMu.Unlock()
+
+	c.down[i] = time.Now().Add(downCooldown)
+}
+
+func (c *Cluster) isDown(i int) bool {
+	c.downMu.RLock()
+	defer c.downMu.RUnlock()
+
+	return time.Now().Before(c.down[i])
+}
+
+// pinnedNode is a Queryer that sends statements to a single node of a
+// cluster, failing over to other nodes if it refuses connections.
+type pinnedNode struct {
+	cluster *Cluster
+	start   int
+}
+
+func (p *pinnedNode) Query(query string, args ...any) ([]map[string]any, Stats, error) {
+	return p.cluster.query(p.start, query, args...)
+}
+
+func (p *pinnedNode) Exec(query string, args ...any) (Stats, error) {
+	return p.cluster.exec(p.start, query, args...)
+}
+
+func (c *Cluster) PoolStats() map[string]PoolStats {
+	out := map[string]PoolStats{}
+	for _, n := range c.nodes {
+		p, ok := n.Queryer.(PoolStatser)
+		if !ok {
+			continue
+		}
+
+		for _, s := range p.PoolStats() {
+			out[n.Name] = s
+		}
+	}
+
+	return out
+}
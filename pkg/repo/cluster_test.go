@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeQueryer struct {
+	err   error
+	calls int
+}
+
+func (f *fakeQueryer) Query(query string, args ...any) ([]map[string]any, Stats, error) {
+	f.calls++
+	return nil, Stats{}, f.err
+}
+
+func (f *fakeQueryer) Exec(query string, args ...any) (Stats, error) {
+	f.calls++
+	return Stats{}, f.err
+}
+
+func TestNewCluster(t *testing.T) {
+	_, err := NewCluster(BalanceRandom)
+	assert.Equal(t, errors.New("at least one node is required"), err)
+
+	_, err = NewCluster("invalid", Node{Name: "a", Queryer: &fakeQueryer{}})
+	assert.Equal(t, errors.New(`unsupported load balancing strategy: "invalid"`), err)
+}
+
+func TestClusterForVU(t *testing.T) {
+	cases := []struct {
+		name     string
+		strategy string
+		locality string
+		expNodes []string
+	}{
+		{
+			name:     "round robin",
+			strategy: BalanceRoundRobin,
+			expNodes: []string{"a", "b", "c", "a"},
+		},
+		{
+			name:     "locality",
+			strategy: BalanceLocality,
+			locality: "eu",
+			expNodes: []string{"b", "c", "b", "c"},
+		},
+		{
+			name:     "locality without matching nodes",
+			strategy: BalanceLocality,
+			locality: "ap",
+			expNodes: []string{"a", "b", "c", "a"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cluster, err := NewCluster(
+				c.strategy,
+				Node{Name: "a", Locality: "us", Queryer: &fakeQueryer{}},
+				Node{Name: "b", Locality: "eu", Queryer: &fakeQueryer{}},
+				Node{Name: "c", Locality: "eu", Queryer: &fakeQueryer{}},
+			)
+			assert.NoError(t, err)
+
+			var act []string
+			for range c.expNodes {
+				_, stats, err := cluster.ForVU(c.locality).Query("SELECT 1")
+				assert.NoError(t, err)
+				act = append(act, stats.Node)
+			}
+
+			assert.Equal(t, c.expNodes, act)
+		})
+	}
+}
+
+func TestClusterRandomForVU(t *testing.T) {
+	cluster, err := NewCluster(BalanceRandom, Node{Name: "a", Queryer: &fakeQueryer{}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, cluster, cluster.ForVU(""))
+}
+
+func TestClusterFailover(t *testing.T) {
+	down := &fakeQueryer{err: ConnErr{Err: errors.New("connection refused")}}
+	up := &fakeQueryer{}
+
+	cluster, err := NewCluster(
+		BalanceRoundRobin,
+		Node{Name: "down", Queryer: down},
+		Node{Name: "up", Queryer: up},
+	)
+	assert.NoError(t, err)
+
+	vu := cluster.ForVU("")
+
+	stats, err := vu.Exec("SELECT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "up", stats.Node)
+	assert.Equal(t, 1, down.calls)
+
+	// The down node is skipped while cooling down.
+	stats, err = vu.Exec("SELECT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "up", stats.Node)
+	assert.Equal(t, 1, down.calls)
+	assert.Equal(t, 2, up.calls)
+}
+
+func TestClusterStatementErrorsDontFailover(t *testing.T) {
+	bad := &fakeQueryer{err: errors.New("syntax error")}
+	other := &fakeQueryer{}
+
+	cluster, err := NewCluster(
+		BalanceRoundRobin,
+		Node{Name: "bad", Queryer: bad},
+		Node{Name: "other", Queryer: other},
+	)
+	assert.NoError(t, err)
+
+	stats, err := cluster.ForVU("").Exec("SELECT")
+	assert.Equal(t, errors.New("syntax error"), err)
+	assert.Equal(t, "bad", stats.Node)
+	assert.Equal(t, 0, other.calls)
+}
+
+func TestClusterAllNodesDown(t *testing.T) {
+	connErr := ConnErr{Err: errors.New("connection refused")}
+
+	cluster, err := NewCluster(
+		BalanceRandom,
+		Node{Name: "a", Queryer: &fakeQueryer{err: connErr}},
+		Node{Name: "b", Queryer: &fakeQueryer{err: connErr}},
+	)
+	assert.NoError(t, err)
+
+	_, err = cluster.Exec("SELECT 1")
+	assert.ErrorIs(t, err, connErr.Err)
+	assert.Equal(t, "no nodes available: acquiring connection: connection refused", err.Error())
+}
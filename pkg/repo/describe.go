@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/samber/lo"
+)
+
+// Describer is implemented by Queryers that can learn the columns a query
+// returns by preparing it, without running it.
+type Describer interface {
+	Columns(query string) ([]string, error)
+}
+
+// errDescribeUnsupported is returned when the driver behind a connection
+// can't describe a query's columns.
+var errDescribeUnsupported = errors.New("describing queries is only supported by the pgx driver")
+
+func (r *PgxRepo) Columns(query string) ([]string, error) {
+	conn, err := r.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, ConnErr{Err: err}
+	}
+	defer conn.Release()
+
+	return describe(conn.Conn(), query)
+}
+
+func (r *DBRepo) Columns(query string) ([]string, error) {
+	conn, err := r.db.Conn(context.Background())
+	if err != nil {
+		return nil, ConnErr{Err: err}
+	}
+	defer conn.Close()
+
+	var columns []string
+	err = conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(interface{ Conn() *pgx.Conn })
+		if !ok {
+			return errDescribeUnsupported
+		}
+
+		columns, err = describe(c.Conn(), query)
+		return err
+	})
+
+	return columns, err
+}
+
+// Columns describes the query against the first node, as every node
+// shares a schema.
+func (c *Cluster) Columns(query string) ([]string, error) {
+	d, ok := c.nodes[0].Queryer.(Describer)
+	if !ok {
+		return nil, errDescribeUnsupported
+	}
+
+	return d.Columns(query)
+}
+
+func describe(conn *pgx.Conn, query string) ([]string, error) {
+	sd, err := conn.Prepare(context.Background(), "", query)
+	if err != nil {
+		return nil, fmt.Errorf("preparing query: %w", err)
+	}
+
+	return lo.Map(sd.Fields, func(f pgconn.FieldDescription, _ int) string {
+		return f.Name
+	}), nil
+}
@@ -0,0 +1,132 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PgxRepo is a Queryer backed by a native pgx connection pool, which
+// avoids the overhead of database/sql and returns pgx's native types.
+type PgxRepo struct {
+	pool *pgxpool.Pool
+}
+
+// NewPgxRepo connects to the database at url using a pgxpool configured
+// with the given pool settings.
+func NewPgxRepo(url string, cfg PoolConfig) (*PgxRepo, error) {
+	poolCfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, fmt.Errorf("parsing url: %w", err)
+	}
+
+	if cfg.MaxConns > math.MaxInt32 || cfg.MinConns > math.MaxInt32 {
+		return nil, fmt.Errorf("max_conns and min_conns must be at most %d", math.MaxInt32)
+	}
+
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = int32(cfg.MaxConns)
+	}
+	if cfg.MinConns > 0 {
+		poolCfg.MinConns = int32(cfg.MinConns)
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		poolCfg.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating pool: %w", err)
+	}
+
+	return &PgxRepo{
+		pool: pool,
+	}, nil
+}
+
+func (r *PgxRepo) Query(query string, args ...any) ([]map[string]any, Stats, error) {
+	start := time.Now()
+
+	conn, err := r.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, Stats{}, ConnErr{Err: err}
+	}
+	defer conn.Release()
+	wait := time.Since(start)
+
+	data, stats, err := (&pgxConn{conn: conn}).Query(query, args...)
+	stats.Wait = wait
+
+	return data, stats, err
+}
+
+func (r *PgxRepo) Exec(query string, args ...any) (Stats, error) {
+	start := time.Now()
+
+	conn, err := r.pool.Acquire(context.Background())
+	if err != nil {
+		return Stats{}, ConnErr{Err: err}
+	}
+	defer conn.Release()
+	wait := time.Since(start)
+
+	stats, err := (&pgxConn{conn: conn}).Exec(query, args...)
+	stats.Wait = wait
+
+	return stats, err
+}
+
+// Close closes all connections in the pool.
+func (r *PgxRepo) Close() error {
+	r.pool.Close()
+	return nil
+}
+
+func readPgxRows(rows pgx.Rows) ([]map[string]any, error) {
+	defer rows.Close()
+
+	fields := rows.FieldDescriptions()
+
+	var results []map[string]any
+
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+
+		result := make(map[string]any, len(fields))
+		for i, f := range fields {
+			result[f.Name] = values[i]
+		}
+
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+func (r *PgxRepo) PoolStats() map[string]PoolStats {
+	s := r.pool.Stat()
+
+	return map[string]PoolStats{
+		"": {
+			MaxConns:     int(s.MaxConns()),
+			OpenConns:    int(s.TotalConns()),
+			InUse:        int(s.AcquiredConns()),
+			Idle:         int(s.IdleConns()),
+			WaitCount:    s.EmptyAcquireCount(),
+			WaitDuration: s.AcquireDuration(),
+		},
+	}
+}
@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"fmt"
+	"time"
+)
+
+// PoolConfig holds connection pool settings common to all backends,
+// other than MinConns, which only the pgxpool backend supports. Zero
+// values leave the backend's defaults in place.
+type PoolConfig struct {
+	MaxConns          int           `yaml:"max_conns"`
+	MinConns          int           `yaml:"min_conns"`
+	MaxConnLifetime   time.Duration `yaml:"max_conn_lifetime"`
+	MaxConnIdleTime   time.Duration `yaml:"max_conn_idle_time"`
+	HealthCheckPeriod time.Duration `yaml:"health_check_period"`
+}
+
+// Stats describes the execution of a statement, breaking the time taken
+// down into the time spent waiting for a connection from the pool and
+// the time spent running it.
+type Stats struct {
+	Wait  time.Duration
+	Query time.Duration
+
+	// Node is the name of the node that served the statement, if the
+	// statement was run against a Cluster.
+	Node string
+
+	// RowsAffected is the number of rows changed by an Exec.
+	RowsAffected int64
+}
+
+// Total returns the end-to-end time taken by a statement.
+func (t Stats) Total() time.Duration {
+	return t.Wait + t.Query
+}
+
+// ConnErr is returned when a connection to the database can't be
+// acquired, as opposed to a statement failing once connected.
+type ConnErr struct {
+	Err error
+}
+
+func (err ConnErr) Error() string {
+	return fmt.Sprintf("acquiring connection: %v", err.Err)
+}
+
+func (err ConnErr) Unwrap() error {
+	return err.Err
+}
+
+// BrokenConnErr is returned when a statement fails because its connection
+// broke, e.g. because the node restarted. Unlike a ConnErr, the statement
+// may have run, so it isn't retried on another node.
+type BrokenConnErr struct {
+	Err error
+}
+
+func (err BrokenConnErr) Error() string {
+	return fmt.Sprintf("connection broken: %v", err.Err)
+}
+
+func (err BrokenConnErr) Unwrap() error {
+	return err.Err
+}
+
+// PoolStats is a point-in-time view of a connection pool.
+type PoolStats struct {
+	MaxConns     int
+	OpenConns    int
+	InUse        int
+	Idle         int
+	WaitCount    int64
+	WaitDuration time.Duration
+}
+
+// PoolStatser is implemented by Queryers backed by connection pools.
+type PoolStatser interface {
+	// PoolStats returns the stats of each pool, keyed by the name of
+	// the node it connects to, or an empty string if there's only one.
+	PoolStats() map[string]PoolStats
+}
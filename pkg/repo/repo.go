@@ -1,50 +1,109 @@
 package repo
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
+
+	"github.com/rs/zerolog"
 )
 
 type Queryer interface {
-	Query(query string, args ...any) ([]map[string]any, time.Duration, error)
-	Exec(query string, args ...any) (time.Duration, error)
+	Query(query string, args ...any) ([]map[string]any, Stats, error)
+	Exec(query string, args ...any) (Stats, error)
 }
 
 type DBRepo struct {
-	db *sql.DB
+	db     *sql.DB
+	done   chan struct{}
+	logger *zerolog.Logger
 }
 
-func NewDBRepo(db *sql.DB) *DBRepo {
-	return &DBRepo{
-		db: db,
+// NewDBRepo returns a Queryer backed by a database/sql connection pool,
+// configured with the given pool settings. database/sql has no minimum
+// number of connections, so MinConns isn't supported.
+func NewDBRepo(db *sql.DB, cfg PoolConfig, logger *zerolog.Logger) (*DBRepo, error) {
+	if cfg.MinConns > 0 {
+		return nil, fmt.Errorf("min_conns isn't supported by the sql backend, use the pgxpool backend")
+	}
+
+	if cfg.MaxConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxConns)
+	}
+	if cfg.MaxConnLifetime > 0 {
+		db.SetConnMaxLifetime(cfg.MaxConnLifetime)
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		db.SetConnMaxIdleTime(cfg.MaxConnIdleTime)
+	}
+
+	r := DBRepo{
+		db:     db,
+		done:   make(chan struct{}),
+		logger: logger,
 	}
+
+	if cfg.HealthCheckPeriod > 0 {
+		go r.healthCheck(cfg.HealthCheckPeriod)
+	}
+
+	return &r, nil
 }
 
-func (r *DBRepo) Query(query string, args ...any) ([]map[string]any, time.Duration, error) {
+func (r *DBRepo) Query(query string, args ...any) ([]map[string]any, Stats, error) {
 	start := time.Now()
 
-	rows, err := r.db.Query(query, args...)
+	conn, err := r.db.Conn(context.Background())
 	if err != nil {
-		return nil, 0, fmt.Errorf("running query: %w", err)
+		return nil, Stats{}, ConnErr{Err: err}
 	}
+	defer conn.Close()
+	wait := time.Since(start)
 
-	data, err := readRows(rows)
-	if err != nil {
-		return nil, 0, fmt.Errorf("reading rows: %w", err)
-	}
-	return data, time.Since(start), nil
+	data, stats, err := (&sqlConn{conn: conn}).Query(query, args...)
+	stats.Wait = wait
+
+	return data, stats, err
 }
 
-func (r *DBRepo) Exec(query string, args ...any) (time.Duration, error) {
+func (r *DBRepo) Exec(query string, args ...any) (Stats, error) {
 	start := time.Now()
 
-	_, err := r.db.Exec(query, args...)
+	conn, err := r.db.Conn(context.Background())
 	if err != nil {
-		return 0, fmt.Errorf("running query: %w", err)
+		return Stats{}, ConnErr{Err: err}
 	}
+	defer conn.Close()
+	wait := time.Since(start)
 
-	return time.Since(start), nil
+	stats, err := (&sqlConn{conn: conn}).Exec(query, args...)
+	stats.Wait = wait
+
+	return stats, err
+}
+
+// Close stops health checks and closes the underlying pool.
+func (r *DBRepo) Close() error {
+	close(r.done)
+	return r.db.Close()
+}
+
+func (r *DBRepo) healthCheck(period time.Duration) {
+	ticks := time.NewTicker(period)
+	defer ticks.Stop()
+
+	for {
+		select {
+		case <-ticks.C:
+			if err := r.db.Ping(); err != nil {
+				r.logger.Error().Msgf("health check failed: %v", err)
+			}
+
+		case <-r.done:
+			return
+		}
+	}
 }
 
 func readRows(rows *sql.Rows) ([]map[string]any, error) {
@@ -78,3 +137,18 @@ func readRows(rows *sql.Rows) ([]map[string]any, error) {
 
 	return results, nil
 }
+
+func (r *DBRepo) PoolStats() map[string]PoolStats {
+	s := r.db.Stats()
+
+	return map[string]PoolStats{
+		"": {
+			MaxConns:     s.MaxOpenConnections,
+			OpenConns:    s.OpenConnections,
+			InUse:        s.InUse,
+			Idle:         s.Idle,
+			WaitCount:    s.WaitCount,
+			WaitDuration: s.WaitDuration,
+		},
+	}
+}
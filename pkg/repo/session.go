@@ -0,0 +1,372 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Session is a Queryer that runs all of its statements on a single,
+// dedicated connection, so session settings and temporary state carry
+// across statements. Statements are run one at a time, with the time
+// spent waiting for the connection reported as Stats.Wait.
+type Session interface {
+	Queryer
+	Close() error
+
+	// Locked runs f with exclusive use of the session's connection, so
+	// that a sequence of statements (e.g. a transaction) isn't
+	// interleaved with statements from elsewhere.
+	Locked(f func(Queryer) error) error
+}
+
+// Sessioner is implemented by Queryers that can provide a dedicated
+// connection.
+type Sessioner interface {
+	Session() (Session, error)
+}
+
+// lockedSession serialises access to a connection that can't be used
+// concurrently.
+type lockedSession struct {
+	mu    sync.Mutex
+	conn  Queryer
+	close func() error
+}
+
+func (s *lockedSession) Query(query string, args ...any) ([]map[string]any, Stats, error) {
+	start := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wait := time.Since(start)
+
+	data, stats, err := s.conn.Query(query, args...)
+	stats.Wait += wait
+
+	return data, stats, err
+}
+
+func (s *lockedSession) Exec(query string, args ...any) (Stats, error) {
+	start := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wait := time.Since(start)
+
+	stats, err := s.conn.Exec(query, args...)
+	stats.Wait += wait
+
+	return stats, err
+}
+
+func (s *lockedSession) Locked(f func(Queryer) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return f(s.conn)
+}
+
+func (s *lockedSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.close()
+}
+
+func (r *DBRepo) Session() (Session, error) {
+	conn, err := r.db.Conn(context.Background())
+	if err != nil {
+		return nil, ConnErr{Err: err}
+	}
+
+	return &lockedSession{
+		conn:  &sqlConn{conn: conn},
+		close: conn.Close,
+	}, nil
+}
+
+func (r *PgxRepo) Session() (Session, error) {
+	conn, err := r.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, ConnErr{Err: err}
+	}
+
+	return &lockedSession{
+		conn: &pgxConn{conn: conn},
+		close: func() error {
+			conn.Release()
+			return nil
+		},
+	}, nil
+}
+
+func (c *Cluster) Session() (Session, error) {
+	return c.session(c.nextNode(nil))
+}
+
+func (p *pinnedNode) Session() (Session, error) {
+	return p.cluster.session(p.start)
+}
+
+// session opens a session on the node at index start, failing over to
+// the next node if it refuses connections.
+func (c *Cluster) session(start int) (Session, error) {
+	var sess Session
+	var node string
+
+	_, err := c.failover(start, func(n Node) (Stats, error) {
+		s, ok := n.Queryer.(Sessioner)
+		if !ok {
+			return Stats{}, fmt.Errorf("node %q doesn't support sessions", n.Name)
+		}
+
+		var err error
+		sess, err = s.Session()
+		node = n.Name
+		return Stats{}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &nodeSession{Session: sess, node: node}, nil
+}
+
+// nodeSession reports the node a session was opened on against each of
+// its statements.
+type nodeSession struct {
+	Session
+	node string
+}
+
+func (s *nodeSession) Query(query string, args ...any) ([]map[string]any, Stats, error) {
+	data, stats, err := s.Session.Query(query, args...)
+	stats.Node = s.node
+
+	return data, stats, err
+}
+
+func (s *nodeSession) Exec(query string, args ...any) (Stats, error) {
+	stats, err := s.Session.Exec(query, args...)
+	stats.Node = s.node
+
+	return stats, err
+}
+
+// reconnectingSession is a Session that reopens its connection once it
+// breaks, e.g. because the node it was on restarted, rather than failing
+// every statement for the rest of its life. The statement that found the
+// connection broken fails, as it may or may not have run, and the next
+// statement reopens the session and initialises it before running.
+type reconnectingSession struct {
+	mu   sync.Mutex
+	sess Session
+
+	open func() (Session, error)
+	init func(Queryer) error
+}
+
+// NewReconnectingSession opens a session, running init against it, and
+// reopens it the same way whenever its connection breaks. Sessions opened
+// through a Cluster fail over to another node if theirs is down.
+func NewReconnectingSession(open func() (Session, error), init func(Queryer) error) (Session, error) {
+	s := reconnectingSession{
+		open: open,
+		init: init,
+	}
+
+	if _, err := s.session(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *reconnectingSession) Query(query string, args ...any) ([]map[string]any, Stats, error) {
+	sess, err := s.session()
+	if err != nil {
+		return nil, Stats{}, err
+	}
+
+	data, stats, err := sess.Query(query, args...)
+	s.checkBroken(sess, err)
+
+	return data, stats, err
+}
+
+func (s *reconnectingSession) Exec(query string, args ...any) (Stats, error) {
+	sess, err := s.session()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats, err := sess.Exec(query, args...)
+	s.checkBroken(sess, err)
+
+	return stats, err
+}
+
+func (s *reconnectingSession) Locked(f func(Queryer) error) error {
+	sess, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	err = sess.Locked(f)
+	s.checkBroken(sess, err)
+
+	return err
+}
+
+func (s *reconnectingSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sess == nil {
+		return nil
+	}
+
+	err := s.sess.Close()
+	s.sess = nil
+
+	return err
+}
+
+// session returns the open session, reopening it if its connection broke.
+func (s *reconnectingSession) session() (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sess != nil {
+		return s.sess, nil
+	}
+
+	sess, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.init(sess); err != nil {
+		sess.Close()
+		return nil, fmt.Errorf("initialising session: %w", err)
+	}
+
+	s.sess = sess
+	return sess, nil
+}
+
+// checkBroken discards a session if a statement run on it found its
+// connection broken, so that the next statement reopens it.
+func (s *reconnectingSession) checkBroken(sess Session, err error) {
+	var connErr ConnErr
+	var brokenErr BrokenConnErr
+	if !errors.As(err, &connErr) && !errors.As(err, &brokenErr) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sess == sess {
+		sess.Close()
+		s.sess = nil
+	}
+}
+
+// sqlConn runs statements on a single database/sql connection.
+type sqlConn struct {
+	conn *sql.Conn
+}
+
+func (c *sqlConn) Query(query string, args ...any) ([]map[string]any, Stats, error) {
+	start := time.Now()
+
+	rows, err := c.conn.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, Stats{}, c.err(err)
+	}
+	defer rows.Close()
+
+	data, err := readRows(rows)
+	if err != nil {
+		return nil, Stats{}, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return data, Stats{Query: time.Since(start)}, nil
+}
+
+func (c *sqlConn) Exec(query string, args ...any) (Stats, error) {
+	start := time.Now()
+
+	res, err := c.conn.ExecContext(context.Background(), query, args...)
+	if err != nil {
+		return Stats{}, c.err(err)
+	}
+
+	stats := Stats{Query: time.Since(start)}
+
+	// Not every driver reports rows affected, in which case it's left
+	// as zero.
+	stats.RowsAffected, _ = res.RowsAffected()
+
+	return stats, nil
+}
+
+// err returns the error a statement failed with, as a BrokenConnErr if
+// it failed because the connection is broken.
+func (c *sqlConn) err(err error) error {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return BrokenConnErr{Err: err}
+	}
+
+	return fmt.Errorf("running query: %w", err)
+}
+
+// pgxConn runs statements on a single pgxpool connection.
+type pgxConn struct {
+	conn *pgxpool.Conn
+}
+
+func (c *pgxConn) Query(query string, args ...any) ([]map[string]any, Stats, error) {
+	start := time.Now()
+
+	rows, err := c.conn.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, Stats{}, c.err(err)
+	}
+
+	data, err := readPgxRows(rows)
+	if err != nil {
+		return nil, Stats{}, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return data, Stats{Query: time.Since(start)}, nil
+}
+
+func (c *pgxConn) Exec(query string, args ...any) (Stats, error) {
+	start := time.Now()
+
+	tag, err := c.conn.Exec(context.Background(), query, args...)
+	if err != nil {
+		return Stats{}, c.err(err)
+	}
+
+	return Stats{Query: time.Since(start), RowsAffected: tag.RowsAffected()}, nil
+}
+
+// err returns the error a statement failed with, as a BrokenConnErr if
+// it failed because the connection is broken, which pgx closes it for.
+func (c *pgxConn) err(err error) error {
+	if c.conn.Conn().IsClosed() {
+		return BrokenConnErr{Err: err}
+	}
+
+	return fmt.Errorf("running query: %w", err)
+}
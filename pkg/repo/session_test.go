@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSessioner struct {
+	fakeQueryer
+	sessionErr error
+}
+
+func (f *fakeSessioner) Session() (Session, error) {
+	if f.sessionErr != nil {
+		return nil, f.sessionErr
+	}
+
+	return &lockedSession{
+		conn:  &f.fakeQueryer,
+		close: func() error { return nil },
+	}, nil
+}
+
+func TestClusterSession(t *testing.T) {
+	down := &fakeSessioner{sessionErr: ConnErr{Err: errors.New("connection refused")}}
+	up := &fakeSessioner{}
+
+	cluster, err := NewCluster(
+		BalanceRoundRobin,
+		Node{Name: "down", Queryer: down},
+		Node{Name: "up", Queryer: up},
+	)
+	assert.NoError(t, err)
+
+	sess, err := cluster.ForVU("").(Sessioner).Session()
+	assert.NoError(t, err)
+
+	stats, err := sess.Exec("SELECT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "up", stats.Node)
+	assert.Equal(t, 1, up.calls)
+
+	assert.NoError(t, sess.Close())
+}
+
+func TestClusterSessionUnsupported(t *testing.T) {
+	cluster, err := NewCluster(BalanceRandom, Node{Name: "a", Queryer: &fakeQueryer{}})
+	assert.NoError(t, err)
+
+	_, err = cluster.Session()
+	assert.Equal(t, `node "a" doesn't support sessions`, err.Error())
+}
+
+func TestReconnectingSession(t *testing.T) {
+	conn := &fakeQueryer{}
+
+	var opens, inits int
+	open := func() (Session, error) {
+		opens++
+		return &lockedSession{
+			conn:  conn,
+			close: func() error { return nil },
+		}, nil
+	}
+	init := func(q Queryer) error {
+		inits++
+		_, err := q.Exec("SET application_name = 'drk'")
+		return err
+	}
+
+	sess, err := NewReconnectingSession(open, init)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, opens)
+	assert.Equal(t, 1, inits)
+
+	// The statement that finds the connection broken fails.
+	conn.err = BrokenConnErr{Err: errors.New("connection reset by peer")}
+	_, err = sess.Exec("SELECT 1")
+	assert.ErrorAs(t, err, &BrokenConnErr{})
+	assert.Equal(t, 1, opens)
+
+	// The next statement reopens and initialises the session first.
+	conn.err = nil
+	_, err = sess.Exec("SELECT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, opens)
+	assert.Equal(t, 2, inits)
+
+	// Other errors leave the session open.
+	conn.err = errors.New("syntax error")
+	_, err = sess.Exec("SELEC 1")
+	assert.Error(t, err)
+	_, err = sess.Exec("SELECT 1")
+	assert.Equal(t, 2, opens)
+
+	assert.NoError(t, sess.Close())
+}
+
+func TestReconnectingSessionInitFails(t *testing.T) {
+	open := func() (Session, error) {
+		return &lockedSession{
+			conn:  &fakeQueryer{err: errors.New("permission denied")},
+			close: func() error { return nil },
+		}, nil
+	}
+	init := func(q Queryer) error {
+		_, err := q.Exec("SET ROLE app")
+		return err
+	}
+
+	_, err := NewReconnectingSession(open, init)
+	assert.Equal(t, "initialising session: permission denied", err.Error())
+}
@@ -0,0 +1,319 @@
+package tui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/model"
+	"github.com/codingconcepts/ring"
+	"github.com/samber/lo"
+)
+
+const (
+	// Number of intervals shown in each sparkline.
+	historySize = 30
+
+	rateStep    = 0.1
+	minRate     = 0.1
+	keyCtrlC    = 3
+	clearScreen = "\033[H\033[2J"
+)
+
+// Run is the part of a run the dashboard reads from and controls,
+// implemented by model.Runner.
+type Run interface {
+	Harvest() []model.QueryStats
+	ActiveVUs() map[string]int
+	DDL() ([]model.DDL, *model.DDL)
+
+	Pause()
+	Resume()
+	Paused() bool
+
+	RateMultiplier() float64
+	SetRateMultiplier(float64) error
+}
+
+// Dashboard draws the progress of a run each second and lets it be
+// paused, resumed and sped up or slowed down from the keyboard.
+type Dashboard struct {
+	run   Run
+	out   io.Writer
+	keys  <-chan byte
+	quit  func()
+	start time.Time
+
+	prev       map[string]model.QueryStats
+	throughput map[string]*ring.Ring[float64]
+	p99        map[string]*ring.Ring[float64]
+
+	nodeCounts        map[string]int
+	connectionCounts  map[string]int
+	connectionLatency map[string]time.Duration
+}
+
+// New returns a dashboard that draws the run to out, reading key presses
+// from keys and calling quit if asked to stop.
+func New(run Run, out io.Writer, keys <-chan byte, quit func(), start time.Time) *Dashboard {
+	return &Dashboard{
+		run:   run,
+		out:   out,
+		keys:  keys,
+		quit:  quit,
+		start: start,
+
+		prev:       map[string]model.QueryStats{},
+		throughput: map[string]*ring.Ring[float64]{},
+		p99:        map[string]*ring.Ring[float64]{},
+
+		nodeCounts:        map[string]int{},
+		connectionCounts:  map[string]int{},
+		connectionLatency: map[string]time.Duration{},
+	}
+}
+
+// Consume counts the requests served by each node and connection from
+// the run's events, redrawing the dashboard each second until the event
+// stream closes.
+func (d *Dashboard) Consume(events <-chan model.Event) error {
+	ticks := time.NewTicker(time.Second)
+	defer ticks.Stop()
+
+	last := d.start
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			d.add(e)
+
+		case key, ok := <-d.keys:
+			if !ok {
+				d.keys = nil
+				continue
+			}
+			d.handleKey(key)
+			d.draw(time.Now())
+
+		case now := <-ticks.C:
+			d.update(now.Sub(last))
+			last = now
+			d.draw(now)
+		}
+	}
+}
+
+func (d *Dashboard) add(e model.Event) {
+	if e.Err != nil {
+		var assertionErr model.AssertionErr
+		if !errors.As(e.Err, &assertionErr) {
+			return
+		}
+	}
+
+	if e.Node != "" {
+		d.nodeCounts[e.Node]++
+	}
+
+	if e.Connection != "" {
+		d.connectionCounts[e.Connection]++
+		d.connectionLatency[e.Connection] += e.Duration
+	}
+}
+
+func (d *Dashboard) handleKey(key byte) {
+	switch key {
+	case 'p', ' ':
+		if d.run.Paused() {
+			d.run.Resume()
+		} else {
+			d.run.Pause()
+		}
+
+	case '+', '=':
+		d.setRate(d.run.RateMultiplier() + rateStep)
+
+	case '-', '_':
+		d.setRate(d.run.RateMultiplier() - rateStep)
+
+	case '0':
+		d.setRate(1)
+
+	case 'q', keyCtrlC:
+		d.quit()
+	}
+}
+
+func (d *Dashboard) setRate(m float64) {
+	// Round away the error that repeated steps accumulate.
+	m = math.Round(m/rateStep) * rateStep
+
+	// The multiplier is always valid, so there's no error to handle.
+	_ = d.run.SetRateMultiplier(max(m, minRate))
+}
+
+// update adds the throughput and p99 latency of each query over the last
+// interval to its history.
+func (d *Dashboard) update(interval time.Duration) {
+	for _, qs := range d.run.Harvest() {
+		key := qs.Workflow + "." + qs.Name
+
+		delta := qs.Sub(d.prev[key])
+		d.prev[key] = qs
+
+		if _, ok := d.throughput[key]; !ok {
+			d.throughput[key] = ring.New[float64](historySize)
+			d.p99[key] = ring.New[float64](historySize)
+		}
+
+		d.throughput[key].Add(delta.Throughput(interval))
+		d.p99[key].Add(float64(delta.Percentile(99)))
+	}
+}
+
+func (d *Dashboard) draw(now time.Time) {
+	var buf bytes.Buffer
+	buf.WriteString(clearScreen)
+
+	d.render(&buf, now)
+
+	// Written at once to avoid flickering.
+	d.out.Write(buf.Bytes())
+}
+
+func (d *Dashboard) render(out io.Writer, now time.Time) {
+	stats := d.run.Harvest()
+
+	state := lo.Ternary(d.run.Paused(), "PAUSED", "running")
+	fmt.Fprintf(out, "drk · %s · %s elapsed · rate ×%.1f\n", state, now.Sub(d.start).Truncate(time.Second), d.run.RateMultiplier())
+	fmt.Fprintf(out, "DDL: %s\n\n", d.ddlStatus(now))
+
+	w := tabwriter.NewWriter(out, 1, 1, 3, ' ', 0)
+
+	fmt.Fprintln(w, "Workflow\tActive VUs")
+	fmt.Fprintln(w, "--------\t----------")
+	activeVUs := d.run.ActiveVUs()
+	for _, workflow := range sortedKeys(activeVUs) {
+		fmt.Fprintf(w, "%s\t%d\n", workflow, activeVUs[workflow])
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Query\tRequests\tErrors\tFailed Assertions\tSkipped\tThroughput\t\tp99\t")
+	fmt.Fprintln(w, "-----\t--------\t------\t-----------------\t-------\t----------\t\t---\t")
+	for _, qs := range stats {
+		if strings.HasPrefix(qs.Workflow, "*") {
+			continue
+		}
+
+		key := qs.Workflow + "." + qs.Name
+		throughput := d.history(d.throughput, key)
+		p99 := d.history(d.p99, key)
+
+		fmt.Fprintf(
+			w,
+			"%s%s\t%d\t%d\t%d\t%d\t%s\t%.1f/s\t%s\t%s\n",
+			key,
+			lo.Ternary(qs.Stale, " (as of)", ""),
+			qs.Count,
+			qs.Errors,
+			qs.AssertionFailures,
+			qs.Skipped,
+			sparkline(throughput, historySize),
+			last(throughput),
+			sparkline(p99, historySize),
+			time.Duration(last(p99)).Round(time.Microsecond),
+		)
+	}
+
+	setup := lo.Filter(stats, func(qs model.QueryStats, _ int) bool {
+		return strings.HasPrefix(qs.Workflow, "*")
+	})
+	if len(setup) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Setup query\tRequests\tErrors\tAverage Latency")
+		fmt.Fprintln(w, "-----------\t--------\t------\t---------------")
+		for _, qs := range setup {
+			fmt.Fprintf(w, "%s.%s\t%d\t%d\t%s\n", strings.TrimPrefix(qs.Workflow, "*"), qs.Name, qs.Count, qs.Errors, qs.Mean())
+		}
+	}
+
+	if len(d.connectionCounts) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Connection\tRequests\tAverage Latency")
+		fmt.Fprintln(w, "----------\t--------\t---------------")
+		for _, conn := range sortedKeys(d.connectionCounts) {
+			n := d.connectionCounts[conn]
+			fmt.Fprintf(w, "%s\t%d\t%s\n", conn, n, d.connectionLatency[conn]/time.Duration(n))
+		}
+	}
+
+	if len(d.nodeCounts) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Node\tRequests")
+		fmt.Fprintln(w, "----\t--------")
+		for _, node := range sortedKeys(d.nodeCounts) {
+			fmt.Fprintf(w, "%s\t%d\n", node, d.nodeCounts[node])
+		}
+	}
+
+	w.Flush()
+
+	fmt.Fprintf(out, "\n[p] pause/resume   [+/-] rate   [0] reset rate   [q] quit\n")
+}
+
+// ddlStatus describes the schema changes that are running, or the last
+// one to finish if none are.
+func (d *Dashboard) ddlStatus(now time.Time) string {
+	running, finished := d.run.DDL()
+
+	if len(running) > 0 {
+		first := running[0]
+		status := fmt.Sprintf("running %s.%s for %s", strings.TrimPrefix(first.Workflow, "*"), first.Name, now.Sub(first.Start).Truncate(time.Second))
+		if len(running) > 1 {
+			status += fmt.Sprintf(" (+%d more)", len(running)-1)
+		}
+		return status
+	}
+
+	if finished == nil {
+		return "none"
+	}
+
+	name := strings.TrimPrefix(finished.Workflow, "*") + "." + finished.Name
+	took := finished.End.Sub(finished.Start).Round(time.Millisecond)
+	ago := now.Sub(finished.End).Truncate(time.Second)
+
+	if finished.Err != nil {
+		return fmt.Sprintf("%s FAILED after %s (%s ago): %v", name, took, ago, finished.Err)
+	}
+	return fmt.Sprintf("%s completed in %s (%s ago)", name, took, ago)
+}
+
+func (d *Dashboard) history(series map[string]*ring.Ring[float64], key string) []float64 {
+	if r, ok := series[key]; ok {
+		return r.Slice()
+	}
+	return nil
+}
+
+func last(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	return values[len(values)-1]
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := lo.Keys(m)
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,151 @@
+package tui
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockRun struct {
+	stats      []model.QueryStats
+	running    []model.DDL
+	finished   *model.DDL
+	paused     bool
+	multiplier float64
+}
+
+func (m *mockRun) Harvest() []model.QueryStats       { return m.stats }
+func (m *mockRun) ActiveVUs() map[string]int         { return map[string]int{"shop": 4} }
+func (m *mockRun) DDL() ([]model.DDL, *model.DDL)    { return m.running, m.finished }
+func (m *mockRun) Pause()                            { m.paused = true }
+func (m *mockRun) Resume()                           { m.paused = false }
+func (m *mockRun) Paused() bool                      { return m.paused }
+func (m *mockRun) RateMultiplier() float64           { return m.multiplier }
+func (m *mockRun) SetRateMultiplier(v float64) error { m.multiplier = v; return nil }
+
+func TestSparkline(t *testing.T) {
+	cases := []struct {
+		name   string
+		values []float64
+		width  int
+		exp    string
+	}{
+		{name: "empty", width: 3, exp: "   "},
+		{name: "zeros", values: []float64{0, 0}, width: 2, exp: "▁▁"},
+		{name: "scaled to highest", values: []float64{0, 50, 100}, width: 3, exp: "▁▄█"},
+		{name: "padded", values: []float64{1}, width: 3, exp: "  █"},
+		{name: "truncated", values: []float64{100, 0, 100}, width: 2, exp: "▁█"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, sparkline(c.values, c.width))
+		})
+	}
+}
+
+func TestDashboardKeys(t *testing.T) {
+	run := &mockRun{multiplier: 1}
+
+	var quit bool
+	d := New(run, &bytes.Buffer{}, nil, func() { quit = true }, time.Now())
+
+	d.handleKey('p')
+	assert.True(t, run.paused)
+	d.handleKey(' ')
+	assert.False(t, run.paused)
+
+	d.handleKey('+')
+	d.handleKey('+')
+	assert.InDelta(t, 1.2, run.multiplier, 1e-9)
+
+	for range 20 {
+		d.handleKey('-')
+	}
+	assert.InDelta(t, minRate, run.multiplier, 1e-9)
+
+	d.handleKey('0')
+	assert.Equal(t, 1.0, run.multiplier)
+
+	d.handleKey('q')
+	assert.True(t, quit)
+}
+
+func TestDashboardRender(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(90 * time.Second)
+
+	run := &mockRun{
+		multiplier: 1.5,
+		paused:     true,
+		stats: []model.QueryStats{
+			{Workflow: "*shop", Name: "setup", Count: 4},
+			{Workflow: "shop", Name: "browse", Count: 10, Errors: 1, AssertionFailures: 2},
+		},
+		finished: &model.DDL{Workflow: "shop", Name: "add_index", Start: now.Add(-5 * time.Second), End: now.Add(-2 * time.Second), Err: errors.New("boom")},
+	}
+
+	d := New(run, &bytes.Buffer{}, nil, func() {}, start)
+	d.update(time.Second)
+	d.add(model.Event{Workflow: "shop", Name: "browse", Node: "a", Connection: "primary", Duration: time.Millisecond})
+	d.add(model.Event{Workflow: "shop", Name: "browse", Node: "a", Err: errors.New("refused")})
+
+	var buf bytes.Buffer
+	d.render(&buf, now)
+	out := buf.String()
+
+	for _, exp := range []string{
+		"drk · PAUSED · 1m30s elapsed · rate ×1.5",
+		"DDL: shop.add_index FAILED after 3s (2s ago): boom",
+		"shop       4",
+		"shop.browse",
+		"9.0/s",
+		"shop.setup",
+		"primary",
+	} {
+		assert.Contains(t, out, exp)
+	}
+
+	assert.NotContains(t, out, "*shop")
+}
+
+func TestDDLStatus(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		running  []model.DDL
+		finished *model.DDL
+		exp      string
+	}{
+		{
+			name: "none",
+			exp:  "none",
+		},
+		{
+			name: "running",
+			running: []model.DDL{
+				{Workflow: "*shop", Name: "create_table", Start: now.Add(-3 * time.Second)},
+				{Workflow: "shop", Name: "add_index", Start: now.Add(-time.Second)},
+			},
+			finished: &model.DDL{Workflow: "shop", Name: "drop_index"},
+			exp:      "running shop.create_table for 3s (+1 more)",
+		},
+		{
+			name:     "completed",
+			finished: &model.DDL{Workflow: "shop", Name: "add_index", Start: now.Add(-2 * time.Second), End: now.Add(-time.Second)},
+			exp:      "shop.add_index completed in 1s (1s ago)",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := New(&mockRun{running: c.running, finished: c.finished}, &bytes.Buffer{}, nil, func() {}, now)
+			assert.Equal(t, c.exp, d.ddlStatus(now))
+		})
+	}
+}
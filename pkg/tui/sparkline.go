@@ -0,0 +1,31 @@
+package tui
+
+import "strings"
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws values as a row of bars scaled to the highest value,
+// right-aligned within width characters.
+func sparkline(values []float64, width int) string {
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+
+	var highest float64
+	for _, v := range values {
+		highest = max(highest, v)
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", width-len(values)))
+
+	for _, v := range values {
+		i := 0
+		if highest > 0 {
+			i = int(v / highest * float64(len(sparks)-1))
+		}
+		b.WriteRune(sparks[min(max(i, 0), len(sparks)-1)])
+	}
+
+	return b.String()
+}
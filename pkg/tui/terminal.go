@@ -0,0 +1,106 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+const (
+	enterAltScreen = "\033[?1049h\033[?25l"
+	leaveAltScreen = "\033[?25h\033[?1049l"
+)
+
+// IsTerminal returns true if both stdin and stdout are attached to a
+// terminal, which the dashboard needs to draw itself and read keys.
+func IsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// Terminal is stdout, switched to an alternate screen, and stdin, put
+// into raw mode so key presses can be read as they're made.
+type Terminal struct {
+	state *term.State
+	keys  chan byte
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// OpenTerminal prepares the terminal for the dashboard. Close must be
+// called to restore it.
+func OpenTerminal() (*Terminal, error) {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("putting terminal into raw mode: %w", err)
+	}
+
+	t := Terminal{
+		state: state,
+		keys:  make(chan byte, 16),
+	}
+
+	fmt.Fprint(os.Stdout, enterAltScreen)
+
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(t.keys)
+				return
+			}
+			for _, b := range buf[:n] {
+				t.keys <- b
+			}
+		}
+	}()
+
+	return &t, nil
+}
+
+// Keys returns the keys pressed.
+func (t *Terminal) Keys() <-chan byte {
+	return t.keys
+}
+
+// Write writes to stdout, translating line feeds into the carriage
+// return and line feed a terminal in raw mode needs. Writes made after
+// Close are discarded, so that a dashboard still running while the run
+// winds down doesn't draw over what's printed after it.
+func (t *Terminal) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return len(p), nil
+	}
+
+	if _, err := os.Stdout.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close restores the terminal to the state it was in when opened.
+func (t *Terminal) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+
+	fmt.Fprint(os.Stdout, leaveAltScreen)
+
+	if err := term.Restore(int(os.Stdin.Fd()), t.state); err != nil {
+		return fmt.Errorf("restoring terminal: %w", err)
+	}
+
+	return nil
+}